@@ -0,0 +1,13 @@
+// Command fakestata is a stand-in for the Stata executable in tests; see package fakestata.
+// Install it as stata-mp in a directory named by STATA_PATH to use it with gostata.
+package main
+
+import (
+	"os"
+
+	"github.com/drgo/gostata/fakestata"
+)
+
+func main() {
+	os.Exit(fakestata.Main(os.Args[1:], os.Stdin, os.Stdout))
+}
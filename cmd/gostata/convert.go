@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/drgo/gostata"
+)
+
+var missingStyles = map[string]gostata.MissingStyle{
+	"empty": gostata.MissingEmpty,
+	"dot":   gostata.MissingDot,
+	"null":  gostata.MissingNull,
+	"codes": gostata.MissingCodes,
+}
+
+// convert converts a file to another format, chosen by the extensions of the files.
+func convert(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("convert", stderr)
+	vars := fs.String("vars", "", "comma-separated `names` of the variables to convert from a dta file")
+	labels := fs.Bool("labels", false, "write value labels instead of codes to csv, tsv and jsonl")
+	missing := fs.String("missing", "empty", "how to write missing values to csv, tsv and jsonl: empty, dot, null or codes")
+	dates := fs.String("dates", "", "time `layout` of dates written to csv, tsv and jsonl (default 2006-01-02)")
+	rawDates := fs.Bool("rawdates", false, "write dates as Stata numbers to csv, tsv and jsonl")
+	noHeader := fs.Bool("noheader", false, "omit the header row of csv and tsv")
+	sample := fs.Int("sample", 0, "infer the types of csv columns from the first `n` rows (default all)")
+	na := fs.String("na", strings.Join(gostata.DefaultNA, ","), "comma-separated `tokens` read as missing values from csv")
+	label := fs.String("label", "", "dataset label of a dta file converted from csv")
+	if err := parseFlags(fs, args, 2, 2); err != nil {
+		return err
+	}
+	in, out := fs.Arg(0), fs.Arg(1)
+	inExt, outExt := strings.ToLower(filepath.Ext(in)), strings.ToLower(filepath.Ext(out))
+	switch {
+	case inExt == ".csv" && outExt == ".dta":
+		opts := &gostata.CSVOptions{SampleRows: *sample, Label: *label}
+		if isFlagSet(fs, "na") {
+			opts.NA = append([]string{}, splitList(*na)...) // non-nil: no tokens if empty
+		}
+		_, err := gostata.ConvertCSV(out, in, opts)
+		return err
+	case inExt == ".dct" && outExt == ".dta":
+		ds, err := gostata.ImportDictionary(in)
+		if err != nil {
+			return err
+		}
+		return ds.WriteFile(out)
+	case inExt != ".dta":
+		return fmt.Errorf("cannot convert %s files to %s", inExt, outExt)
+	case outExt == ".dta" || outExt == ".dct":
+		ds, err := gostata.ReadFile(in)
+		if err != nil {
+			return err
+		}
+		if *vars != "" {
+			if err := keepVars(ds, splitList(*vars)); err != nil {
+				return err
+			}
+		}
+		if outExt == ".dct" {
+			return ds.ExportFixedWidth(strings.TrimSuffix(out, filepath.Ext(out))+".raw", out)
+		}
+		return ds.WriteFile(out)
+	}
+	style, ok := missingStyles[*missing]
+	if !ok {
+		return fmt.Errorf("unknown missing value style %q", *missing)
+	}
+	return gostata.ExportFile(in, out, &gostata.ExportOptions{
+		Vars:        splitList(*vars),
+		ValueLabels: *labels,
+		DateLayout:  *dates,
+		RawDates:    *rawDates,
+		Missing:     style,
+		NoHeader:    *noHeader,
+	})
+}
+
+// keepVars drops the variables of ds that are not named and orders the others as named.
+func keepVars(ds *gostata.Dataset, names []string) error {
+	keep := make(map[string]bool, len(names))
+	for _, name := range names {
+		if ds.Var(name) == nil {
+			return fmt.Errorf("variable %s not found", name)
+		}
+		keep[name] = true
+	}
+	var drop []string
+	for _, name := range ds.VarNames() {
+		if !keep[name] {
+			drop = append(drop, name)
+		}
+	}
+	if len(drop) > 0 {
+		if err := ds.Drop(drop...); err != nil {
+			return err
+		}
+	}
+	return ds.Order(names...)
+}
+
+// splitList splits a comma-separated list, ignoring blanks around the items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/drgo/gostata"
+)
+
+const rule = "-------------------------------------------------------------------------------"
+
+// describe prints the header and the variables of a dta file, like Stata's describe.
+// Only the header and descriptors are read.
+func describe(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("describe", stderr)
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dr, err := gostata.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(0), err)
+	}
+	fmt.Fprintf(stdout, "Contains data from %s\n", fs.Arg(0))
+	fmt.Fprintln(stdout, strings.TrimRight(fmt.Sprintf(" Observations: %9d                  %s", dr.NumObs, dr.DataLabel), " "))
+	fmt.Fprintln(stdout, strings.TrimRight(fmt.Sprintf("    Variables: %9d                  %s", dr.NumVars, dr.TimeStamp), " "))
+	fmt.Fprintf(stdout, "       Format: %9d\n", dr.Version)
+	fmt.Fprintln(stdout, rule)
+	fmt.Fprintln(stdout, "Variable        Storage  Display     Value")
+	fmt.Fprintln(stdout, "    name        type     format      label       Variable label")
+	fmt.Fprintln(stdout, rule)
+	for _, v := range dr.Vars() {
+		line := fmt.Sprintf("%-15s %-8s %-11s %-11s %s", v.Name, v.TypeName(), v.Format, v.ValueLabel, v.Label)
+		fmt.Fprintln(stdout, strings.TrimRight(line, " "))
+	}
+	fmt.Fprintln(stdout, rule)
+	return nil
+}
+
+// head lists the first observations of a dta file, like Stata's list in 1/n.
+func head(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("head", stderr)
+	n := fs.Int("n", 10, "number of observations to list")
+	noLabel := fs.Bool("nolabel", false, "list the codes of labelled values instead of their labels")
+	if err := parseFlags(fs, args, 1, -1); err != nil {
+		return err
+	}
+	ds, vars, err := readVars(fs.Arg(0), fs.Args()[1:])
+	if err != nil {
+		return err
+	}
+	rows := [][]string{{""}}
+	for _, v := range vars {
+		rows[0] = append(rows[0], v.Name)
+	}
+	for i := 0; i < min(*n, ds.NumObs()); i++ {
+		row := []string{strconv.Itoa(i+1) + "."}
+		for _, v := range vars {
+			text := v.Str(i)
+			if !v.IsString() {
+				text = displayValue(ds, v, v.Float(i), !*noLabel)
+			}
+			row = append(row, text)
+		}
+		rows = append(rows, row)
+	}
+	return writeTable(stdout, "", "", rows, 1)
+}
+
+// codebook describes the values of the variables of a dta file, like Stata's codebook.
+func codebook(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("codebook", stderr)
+	if err := parseFlags(fs, args, 1, -1); err != nil {
+		return err
+	}
+	ds, vars, err := readVars(fs.Arg(0), fs.Args()[1:])
+	if err != nil {
+		return err
+	}
+	for _, v := range vars {
+		if err := codebookVar(stdout, ds, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxTabulated is the largest number of distinct values that codebook tabulates.
+const maxTabulated = 9
+
+func codebookVar(w io.Writer, ds *gostata.Dataset, v *gostata.Variable) error {
+	t, err := ds.Tabulate(false, v.Name)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, rule)
+	if v.Label != "" {
+		fmt.Fprintf(w, "%s%*s\n", v.Name, len(rule)-len(v.Name), v.Label)
+	} else {
+		fmt.Fprintln(w, v.Name)
+	}
+	fmt.Fprintln(w, rule)
+	fmt.Fprintln(w)
+	field := func(name, format string, a ...any) {
+		fmt.Fprintf(w, "%22s: %s\n", name, fmt.Sprintf(format, a...))
+	}
+	switch v.Kind() {
+	case gostata.StringVar:
+		field("Type", "String (%s)", v.TypeName())
+	case gostata.DateVar:
+		field("Type", "Numeric daily date (%s)", v.TypeName())
+	default:
+		field("Type", "Numeric (%s)", v.TypeName())
+	}
+	if v.ValueLabel != "" {
+		field("Label", "%s", v.ValueLabel)
+	}
+	fmt.Fprintln(w)
+	if !v.IsString() && t.Total > 0 {
+		sums, err := ds.Summarize(v.Name)
+		if err != nil {
+			return err
+		}
+		s := sums[0]
+		field("Range", "[%s,%s]", displayValue(ds, v, s.Min, false), displayValue(ds, v, s.Max, false))
+		if len(t.Rows) > maxTabulated && v.Kind() == gostata.NumericVar {
+			field("Mean", "%.6g", s.Mean)
+			if !gostata.IsMissing(s.SD) {
+				field("Std. dev.", "%.6g", s.SD)
+			}
+		}
+	}
+	field("Unique values", "%d", len(t.Rows))
+	missing := "Missing ."
+	if v.IsString() {
+		missing = `Missing ""`
+	}
+	field(missing, "%d/%d", ds.NumObs()-t.Total, ds.NumObs())
+	fmt.Fprintln(w)
+	switch {
+	case len(t.Rows) == 0:
+	case len(t.Rows) <= maxTabulated:
+		rows := [][]string{{"Freq.", "Value"}}
+		if v.ValueLabel != "" {
+			rows[0] = append(rows[0], "Label")
+		}
+		for i, c := range t.Rows {
+			value := strconv.Quote(c.Str)
+			if !v.IsString() {
+				value = displayValue(ds, v, c.Num, false)
+			}
+			rows = append(rows, []string{strconv.Itoa(t.RowTotal(i)), value, c.Label})
+		}
+		if err := writeTable(w, fmt.Sprintf("%22s: ", "Tabulation"), strings.Repeat(" ", 24), rows, 2); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+	case v.IsString() || v.Kind() == gostata.DateVar:
+		// evenly spaced distinct values, as Stata shows examples
+		examples := make([]string, 4)
+		for k := range examples {
+			c := t.Rows[k*(len(t.Rows)-1)/(len(examples)-1)]
+			examples[k] = strconv.Quote(c.Str)
+			if !v.IsString() {
+				examples[k] = displayValue(ds, v, c.Num, false)
+			}
+		}
+		field("Examples", "%s", examples[0])
+		for _, e := range examples[1:] {
+			fmt.Fprintf(w, "%24s%s\n", "", e)
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// writeTable writes rows as a table with aligned columns, the first line prefixed by first
+// and the others by rest. The first right columns are aligned right.
+func writeTable(w io.Writer, first, rest string, rows [][]string, right int) error {
+	var widths []int
+	for _, row := range rows {
+		for k, cell := range row {
+			if k == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[k] = max(widths[k], utf8.RuneCountInString(cell))
+		}
+	}
+	var sb strings.Builder
+	for i, row := range rows {
+		sb.Reset()
+		if i == 0 {
+			sb.WriteString(first)
+		} else {
+			sb.WriteString(rest)
+		}
+		for k, cell := range row {
+			if k > 0 {
+				sb.WriteString("  ")
+			}
+			pad := strings.Repeat(" ", widths[k]-utf8.RuneCountInString(cell))
+			if k < right {
+				sb.WriteString(pad + cell)
+			} else {
+				sb.WriteString(cell + pad)
+			}
+		}
+		if _, err := fmt.Fprintln(w, strings.TrimRight(sb.String(), " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readVars reads the dta file fileName and returns it with the named variables, or all
+// variables if there are no names.
+func readVars(fileName string, names []string) (*gostata.Dataset, []*gostata.Variable, error) {
+	ds, err := gostata.ReadFile(fileName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	if len(names) == 0 {
+		return ds, ds.Vars(), nil
+	}
+	vars := make([]*gostata.Variable, len(names))
+	for k, name := range names {
+		if vars[k] = ds.Var(name); vars[k] == nil {
+			return nil, nil, fmt.Errorf("variable %s not found in %s", name, fileName)
+		}
+	}
+	return ds, vars, nil
+}
+
+// displayValue formats the value x of the numeric variable v: missing values as . or .a
+// to .z, dates in ISO 8601, and labelled values by their label if labels is true.
+func displayValue(ds *gostata.Dataset, v *gostata.Variable, x float64, labels bool) string {
+	if code := gostata.MissingCode(x); code != 0 {
+		if code == '.' {
+			return "."
+		}
+		return "." + string(code)
+	}
+	if labels && v.ValueLabel != "" && x == math.Trunc(x) && math.Abs(x) <= math.MaxInt32 {
+		if vl := ds.ValueLabel(v.ValueLabel); vl != nil {
+			if label, ok := vl.Label(int32(x)); ok {
+				return label
+			}
+		}
+	}
+	switch {
+	case v.Kind() == gostata.DateVar:
+		return gostata.TimeFromStataDate(x).Format("2006-01-02")
+	case strings.HasPrefix(v.Format, "%tc") || strings.HasPrefix(v.Format, "%tC"):
+		return gostata.TimeFromStataClock(x).Format("2006-01-02 15:04:05.999")
+	case v.Type() == gostata.StataFloatId:
+		return strconv.FormatFloat(x, 'g', -1, 32)
+	}
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
@@ -0,0 +1,122 @@
+// Command gostata inspects and converts Stata dta files without Stata.
+//
+// Usage:
+//
+//	gostata describe file.dta
+//	gostata head [-n 10] [-nolabel] file.dta [var...]
+//	gostata codebook file.dta [var...]
+//	gostata convert [flags] in out
+//	gostata validate [-strict] file.dta...
+//
+// convert chooses the formats by extension: .csv and .dct files convert to .dta, and .dta
+// files to .csv, .tsv, .jsonl, .dct (with the data in a .raw file) or .dta, which rewrites
+// a format 114 or 115 file in format 113.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// command is a subcommand of gostata.
+type command struct {
+	name  string
+	args  string // synopsis of the arguments
+	short string // one-line description
+	run   func(args []string, stdout, stderr io.Writer) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"describe", "file.dta", "describe the variables of a dataset", describe},
+		{"head", "[-n 10] [-nolabel] file.dta [var...]", "list the first observations", head},
+		{"codebook", "file.dta [var...]", "describe the values of variables", codebook},
+		{"convert", "[flags] in out", "convert between dta, csv, tsv, jsonl and dct files", convert},
+		{"validate", "[-strict] file.dta...", "check the structure of dta files", validate},
+	}
+}
+
+// errUsage reports bad arguments, after the usage of the command has been printed.
+var errUsage = errors.New("usage")
+
+// run runs the gostata command line args and returns the exit status:
+// 0 on success, 1 on failure and 2 for bad usage.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "-help" {
+		usage(stderr)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		switch err := cmd.run(args[1:], stdout, stderr); {
+		case err == nil:
+			return 0
+		case errors.Is(err, flag.ErrHelp):
+			return 0
+		case errors.Is(err, errUsage):
+			return 2
+		default:
+			fmt.Fprintf(stderr, "gostata %s: %v\n", cmd.name, err)
+			return 1
+		}
+	}
+	fmt.Fprintf(stderr, "gostata: unknown command %q\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: gostata command [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-9s %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `run "gostata command -h" for the arguments of a command`)
+}
+
+// newFlagSet returns the flag set of the named command, printing its usage to stderr.
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		for _, cmd := range commands {
+			if cmd.name == name {
+				fmt.Fprintf(stderr, "usage: gostata %s %s\n", name, cmd.args)
+			}
+		}
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args with fs and checks that at least min and at most max arguments
+// follow the flags; max < 0 means no maximum.
+func parseFlags(fs *flag.FlagSet, args []string, min, max int) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() < min || max >= 0 && fs.NArg() > max {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
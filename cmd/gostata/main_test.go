@@ -0,0 +1,239 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drgo/gostata"
+)
+
+// writeSurvey writes a small labelled dataset to dir and returns its file name.
+func writeSurvey(t *testing.T, dir string) string {
+	t.Helper()
+	ds := gostata.NewDataset()
+	ds.Label = "Survey"
+	id, _ := ds.AddNumeric("id", gostata.StataIntId, []float64{1, 2, 3})
+	id.Label = "Respondent"
+	ds.AddString("name", []string{"Ann", "", "Bob"})
+	yes, _ := ds.AddNumeric("yes", gostata.StataByteId, []float64{1, 0, gostata.ExtendedMissing('a')})
+	yes.ValueLabel = "yesno"
+	ds.AddDate("born", []time.Time{
+		time.Date(1960, 1, 2, 0, 0, 0, 0, time.UTC),
+		time.Date(1990, 6, 30, 0, 0, 0, 0, time.UTC),
+		time.Date(1959, 12, 31, 0, 0, 0, 0, time.UTC),
+	})
+	vl := gostata.NewValueLabel("yesno")
+	vl.Set(0, "No")
+	vl.Set(1, "Yes")
+	if err := ds.DefineLabel(vl); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "survey.dta")
+	if err := ds.WriteFile(name); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func runCmd(t *testing.T, args ...string) (stdout, stderr string, status int) {
+	t.Helper()
+	var out, errs strings.Builder
+	status = run(args, &out, &errs)
+	return out.String(), errs.String(), status
+}
+
+func TestDescribe(t *testing.T) {
+	dta := writeSurvey(t, t.TempDir())
+	out, stderr, status := runCmd(t, "describe", dta)
+	if status != 0 {
+		t.Fatalf("status %d: %s", status, stderr)
+	}
+	for _, want := range []string{
+		" Observations:         3                  Survey\n",
+		"    Variables:         4",
+		"       Format:       113\n",
+		"id              int      %8.0g                   Respondent\n",
+		"yes             byte     %8.0g       yesno\n",
+		"born            long     %td\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestHead(t *testing.T) {
+	dta := writeSurvey(t, t.TempDir())
+	out, stderr, status := runCmd(t, "head", "-n", "2", dta)
+	if status != 0 {
+		t.Fatalf("status %d: %s", status, stderr)
+	}
+	want := "    id  name  yes  born\n" +
+		"1.  1   Ann   Yes  1960-01-02\n" +
+		"2.  2         No   1990-06-30\n"
+	if out != want {
+		t.Errorf("got\n%s\nwant\n%s", out, want)
+	}
+	out, _, _ = runCmd(t, "head", "-nolabel", dta, "yes", "id")
+	want = "    yes  id\n" +
+		"1.  1    1\n" +
+		"2.  0    2\n" +
+		"3.  .a   3\n"
+	if out != want {
+		t.Errorf("got\n%s\nwant\n%s", out, want)
+	}
+	if _, stderr, status := runCmd(t, "head", dta, "nosuch"); status != 1 || !strings.Contains(stderr, "nosuch") {
+		t.Errorf("unknown variable: status %d, %s", status, stderr)
+	}
+}
+
+func TestCodebook(t *testing.T) {
+	dta := writeSurvey(t, t.TempDir())
+	out, stderr, status := runCmd(t, "codebook", dta, "yes", "name")
+	if status != 0 {
+		t.Fatalf("status %d: %s", status, stderr)
+	}
+	for _, want := range []string{
+		"                  Type: Numeric (byte)\n                 Label: yesno\n",
+		"                 Range: [0,1]\n         Unique values: 2\n             Missing .: 1/3\n",
+		"            Tabulation: Freq.  Value  Label\n" +
+			"                            1      0  No\n" +
+			"                            1      1  Yes\n",
+		"                  Type: String (str3)\n",
+		`            Missing "": 1/3`,
+		`                            1  "Ann"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "born") {
+		t.Error("unnamed variable described")
+	}
+}
+
+func TestConvert(t *testing.T) {
+	dir := t.TempDir()
+	dta := writeSurvey(t, dir)
+	jsonl := filepath.Join(dir, "survey.jsonl")
+	if _, stderr, status := runCmd(t, "convert", "-labels", "-missing", "codes", "-vars", "yes,born", dta, jsonl); status != 0 {
+		t.Fatalf("status %d: %s", status, stderr)
+	}
+	b, err := os.ReadFile(jsonl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"yes":"Yes","born":"1960-01-02"}
+{"yes":"No","born":"1990-06-30"}
+{"yes":".a","born":"1959-12-31"}
+`
+	if string(b) != want {
+		t.Errorf("got\n%s\nwant\n%s", b, want)
+	}
+
+	// empty and null missing values differ in JSON Lines
+	for style, want := range map[string]string{"empty": `{"yes":""}`, "null": `{"yes":null}`} {
+		if _, stderr, status := runCmd(t, "convert", "-missing", style, "-vars", "yes", dta, jsonl); status != 0 {
+			t.Fatalf("status %d: %s", status, stderr)
+		}
+		if b, err = os.ReadFile(jsonl); err != nil {
+			t.Fatal(err)
+		}
+		if lines := strings.Split(string(b), "\n"); lines[2] != want {
+			t.Errorf("-missing %s: got %s, want %s", style, lines[2], want)
+		}
+	}
+
+	csv := filepath.Join(dir, "in.csv")
+	if err := os.WriteFile(csv, []byte("x,s\n1,a\n-,b\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out.dta")
+	if _, stderr, status := runCmd(t, "convert", "-na", "-", "-label", "From CSV", csv, out); status != 0 {
+		t.Fatalf("status %d: %s", status, stderr)
+	}
+	ds, err := gostata.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.Label != "From CSV" || ds.Var("x").Float(1) != gostata.Missing || ds.Var("s").Str(1) != "b" {
+		t.Errorf("label %q, x[2] = %v", ds.Label, ds.Var("x").Float(1))
+	}
+
+	subset := filepath.Join(dir, "subset.dta")
+	if _, stderr, status := runCmd(t, "convert", "-vars", "born,id", dta, subset); status != 0 {
+		t.Fatalf("status %d: %s", status, stderr)
+	}
+	if ds, err = gostata.ReadFile(subset); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(ds.VarNames(), " "); got != "born id" {
+		t.Errorf("variables %s", got)
+	}
+
+	if _, stderr, status := runCmd(t, "convert", csv, filepath.Join(dir, "out.jsonl")); status != 1 || !strings.Contains(stderr, "cannot convert") {
+		t.Errorf("csv to jsonl: status %d, %s", status, stderr)
+	}
+	if _, _, status := runCmd(t, "convert", "-missing", "none", dta, jsonl); status != 1 {
+		t.Errorf("unknown missing style: status %d", status)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	dta := writeSurvey(t, dir)
+	b, err := os.ReadFile(dta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := filepath.Join(dir, "bad.dta")
+	if err := os.WriteFile(bad, b[:200], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, stderr, status := runCmd(t, "validate", dta, bad)
+	if status != 1 || !strings.Contains(stderr, "1 of 2 files invalid") {
+		t.Errorf("status %d: %s", status, stderr)
+	}
+	want := dta + ": ok, format 113, 4 variables, 3 observations\n" +
+		bad + ": offset 109: descriptors: error: file ends 91 bytes into the 650 bytes of the descriptors of 4 variables\n"
+	if out != want {
+		t.Errorf("got\n%s\nwant\n%s", out, want)
+	}
+
+	// a string format on a numeric variable is only a warning
+	copy(b[109+4+4*33+2*5:], "%9s\x00")
+	if err := os.WriteFile(bad, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, _, status = runCmd(t, "validate", bad)
+	if status != 0 || !strings.Contains(out, `: offset 255: descriptors: warning: variable id: format "%9s" does not suit type int`) {
+		t.Errorf("status %d, output:\n%s", status, out)
+	}
+	if _, _, status := runCmd(t, "validate", "-strict", bad); status != 1 {
+		t.Errorf("-strict: status %d", status)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	tests := []struct {
+		args   []string
+		status int
+		want   string
+	}{
+		{nil, 2, "usage: gostata command"},
+		{[]string{"help"}, 0, "codebook"},
+		{[]string{"nosuch"}, 2, `unknown command "nosuch"`},
+		{[]string{"describe"}, 2, "usage: gostata describe file.dta"},
+		{[]string{"head", "-n"}, 2, "usage: gostata head"},
+		{[]string{"convert", "-h"}, 0, "-missing"},
+	}
+	for _, tt := range tests {
+		_, stderr, status := runCmd(t, tt.args...)
+		if status != tt.status || !strings.Contains(stderr, tt.want) {
+			t.Errorf("%v: status %d, stderr\n%s", tt.args, status, stderr)
+		}
+	}
+}
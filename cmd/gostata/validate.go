@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/drgo/gostata"
+)
+
+// validate checks the structure of each dta file and lists its problems with their byte
+// offsets. Files with errors, or with warnings if -strict is set, fail.
+func validate(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("validate", stderr)
+	strict := fs.Bool("strict", false, "fail files with warnings, eg non-canonical missing values")
+	if err := parseFlags(fs, args, 1, -1); err != nil {
+		return err
+	}
+	failed := 0
+	for _, fileName := range fs.Args() {
+		problems, err := gostata.ValidateFile(fileName)
+		if err != nil {
+			fmt.Fprintf(stdout, "%s: %v\n", fileName, err)
+			failed++
+			continue
+		}
+		for _, p := range problems {
+			fmt.Fprintf(stdout, "%s: %v\n", fileName, p)
+		}
+		switch {
+		case gostata.HasErrors(problems), *strict && len(problems) > 0:
+			failed++
+		case len(problems) == 0:
+			if err := summarizeFile(stdout, fileName); err != nil {
+				return err
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files invalid", failed, fs.NArg())
+	}
+	return nil
+}
+
+// summarizeFile prints the format and dimensions of a valid dta file.
+func summarizeFile(w io.Writer, fileName string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dr, err := gostata.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fileName, err)
+	}
+	fmt.Fprintf(w, "%s: ok, format %d, %d variables, %d observations\n", fileName, dr.Version, dr.NumVars, dr.NumObs)
+	return nil
+}
@@ -0,0 +1,355 @@
+package gostata
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AppendOptions modify Dataset.Append. A nil *AppendOptions uses the defaults.
+type AppendOptions struct {
+	Generate string // if set, name of a new byte variable: 0 for master observations, 1 for appended ones
+	NoLabel  bool   // do not copy value label definitions from the using dataset
+	Force    bool   // allow string/numeric mismatches; the mismatched using values become missing
+}
+
+// Append adds the observations of using to the end of ds, like Stata's append.
+// Variables found only in using are added with missing values in the master observations.
+// Variables found in both keep the master's labels and formats and are promoted to a type
+// that holds both (eg byte and float give float, long and float give double, str5 and str8 give str8).
+// Value labels defined in using are copied unless ds already has a label with the same name.
+func (ds *Dataset) Append(using *Dataset, opts *AppendOptions) error {
+	if opts == nil {
+		opts = &AppendOptions{}
+	}
+	if opts.Generate != "" {
+		if err := ds.checkNewName(opts.Generate); err != nil {
+			return err
+		}
+		if using.Var(opts.Generate) != nil {
+			return fmt.Errorf("variable %s already defined in using data", opts.Generate)
+		}
+	}
+	types := make(map[string]byte)
+	for _, v := range ds.vars {
+		types[v.Name] = v.typ
+		if uv := using.Var(v.Name); uv != nil {
+			typ, err := widerType(v.typ, uv.typ)
+			if err != nil {
+				if !opts.Force {
+					return fmt.Errorf("variable %s is %s in master but %s in using data", v.Name, v.TypeName(), uv.TypeName())
+				}
+				typ = v.typ
+			}
+			types[v.Name] = typ
+		}
+	}
+
+	n, m := ds.nobs, using.nobs
+	masterRows, usingRows := make([]int, n+m), make([]int, n+m)
+	for i := range masterRows {
+		masterRows[i], usingRows[i] = -1, -1
+		if i < n {
+			masterRows[i] = i
+		} else {
+			usingRows[i] = i - n
+		}
+	}
+	vars := make([]*Variable, 0, len(ds.vars)+len(using.vars))
+	for _, v := range ds.vars {
+		nv := v.take(masterRows, types[v.Name])
+		if uv := using.Var(v.Name); uv != nil && uv.IsString() == v.IsString() {
+			nv.fill(uv, usingRows)
+		}
+		vars = append(vars, nv)
+	}
+	for _, uv := range using.vars {
+		if ds.Var(uv.Name) == nil {
+			vars = append(vars, uv.take(usingRows, uv.typ))
+		}
+	}
+	ds.vars = vars
+	ds.nobs = n + m
+	if opts.Generate != "" {
+		source := make([]float64, ds.nobs)
+		for i := n; i < ds.nobs; i++ {
+			source[i] = 1
+		}
+		if _, err := ds.AddNumeric(opts.Generate, StataByteId, source); err != nil {
+			return err
+		}
+	}
+	if !opts.NoLabel {
+		ds.copyLabels(using)
+	}
+	return nil
+}
+
+// MergeKind is the relationship between the key values of the master and using datasets.
+type MergeKind int
+
+const (
+	OneToOne  MergeKind = iota // 1:1 keys are unique in both datasets
+	ManyToOne                  // m:1 keys are unique in the using dataset
+	OneToMany                  // 1:m keys are unique in the master dataset
+)
+
+func (k MergeKind) String() string {
+	switch k {
+	case ManyToOne:
+		return "m:1"
+	case OneToMany:
+		return "1:m"
+	}
+	return "1:1"
+}
+
+// Codes stored in the merge indicator variable.
+const (
+	MergeMasterOnly = 1
+	MergeUsingOnly  = 2
+	MergeMatched    = 3
+)
+
+// MergeOptions modify Dataset.Merge. A nil *MergeOptions uses the defaults.
+type MergeOptions struct {
+	Generate   string   // name of the indicator variable; defaults to _merge
+	NoGenerate bool     // do not create the indicator variable
+	KeepUsing  []string // using variables to add; defaults to all
+	NoLabel    bool     // do not copy value label definitions from the using dataset
+}
+
+// Merge joins using to ds on the key variables, like Stata's merge.
+// The result holds matched observations, unmatched master observations and unmatched
+// using observations, sorted by the keys. For variables found in both datasets the master
+// values are kept. The indicator variable (default _merge) records the source of each observation:
+// MergeMasterOnly (1), MergeUsingOnly (2) or MergeMatched (3).
+// As in Stata, it is an error if the keys are not unique where kind requires them to be.
+func (ds *Dataset) Merge(kind MergeKind, keys []string, using *Dataset, opts *MergeOptions) error {
+	if opts == nil {
+		opts = &MergeOptions{}
+	}
+	generate := opts.Generate
+	if generate == "" {
+		generate = "_merge"
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("merge %s: no key variables", kind)
+	}
+	if !opts.NoGenerate {
+		if err := ds.checkNewName(generate); err != nil {
+			return err
+		}
+		if using.Var(generate) != nil {
+			return fmt.Errorf("variable %s already defined in using data", generate)
+		}
+	}
+	masterKeys, err := keyVars(ds, keys, "master")
+	if err != nil {
+		return err
+	}
+	usingKeys, err := keyVars(using, keys, "using")
+	if err != nil {
+		return err
+	}
+	keyTypes := make(map[string]byte)
+	for i, name := range keys {
+		typ, err := widerType(masterKeys[i].typ, usingKeys[i].typ)
+		if err != nil {
+			return fmt.Errorf("key variable %s is %s in master but %s in using data", name, masterKeys[i].TypeName(), usingKeys[i].TypeName())
+		}
+		keyTypes[name] = typ
+	}
+	if kind != ManyToOne {
+		if err := checkUniqueKeys(masterKeys, ds.nobs, keys, "master"); err != nil {
+			return err
+		}
+	}
+	if kind != OneToMany {
+		if err := checkUniqueKeys(usingKeys, using.nobs, keys, "using"); err != nil {
+			return err
+		}
+	}
+	addVars := using.vars
+	if opts.KeepUsing != nil {
+		addVars = nil
+		for _, name := range opts.KeepUsing {
+			uv := using.Var(name)
+			if uv == nil {
+				return fmt.Errorf("variable %s not found in using data", name)
+			}
+			addVars = append(addVars, uv)
+		}
+	}
+
+	// pair master and using observations
+	index := make(map[string][]int, using.nobs)
+	for j := 0; j < using.nobs; j++ {
+		k := keyString(usingKeys, j)
+		index[k] = append(index[k], j)
+	}
+	var masterRows, usingRows, codes []int
+	matched := make([]bool, using.nobs)
+	for i := 0; i < ds.nobs; i++ {
+		rows := index[keyString(masterKeys, i)]
+		if len(rows) == 0 {
+			masterRows, usingRows, codes = append(masterRows, i), append(usingRows, -1), append(codes, MergeMasterOnly)
+		}
+		for _, j := range rows {
+			matched[j] = true
+			masterRows, usingRows, codes = append(masterRows, i), append(usingRows, j), append(codes, MergeMatched)
+		}
+	}
+	for j := 0; j < using.nobs; j++ {
+		if !matched[j] {
+			masterRows, usingRows, codes = append(masterRows, -1), append(usingRows, j), append(codes, MergeUsingOnly)
+		}
+	}
+
+	keep := make(map[string]bool, len(addVars))
+	for _, uv := range addVars {
+		keep[uv.Name] = true
+	}
+	vars := make([]*Variable, 0, len(ds.vars)+len(addVars)+1)
+	for _, v := range ds.vars {
+		if typ, isKey := keyTypes[v.Name]; isKey {
+			nv := v.take(masterRows, typ)
+			nv.fill(using.Var(v.Name), usingRows)
+			vars = append(vars, nv)
+			continue
+		}
+		uv := using.Var(v.Name)
+		if uv == nil || !keep[v.Name] {
+			vars = append(vars, v.take(masterRows, v.typ))
+			continue
+		}
+		// shared variable: master values win, using-only observations take the using values
+		typ, err := widerType(v.typ, uv.typ)
+		if err != nil {
+			return fmt.Errorf("variable %s is %s in master but %s in using data", v.Name, v.TypeName(), uv.TypeName())
+		}
+		nv := v.take(masterRows, typ)
+		for i, row := range usingRows {
+			if masterRows[i] < 0 {
+				nv.fillObs(i, uv, row)
+			}
+		}
+		vars = append(vars, nv)
+	}
+	for _, uv := range addVars {
+		if _, isKey := keyTypes[uv.Name]; isKey || ds.Var(uv.Name) != nil {
+			continue
+		}
+		vars = append(vars, uv.take(usingRows, uv.typ))
+	}
+	ds.vars = vars
+	ds.nobs = len(codes)
+	if !opts.NoLabel {
+		ds.copyLabels(using)
+	}
+	if !opts.NoGenerate {
+		values := make([]float64, len(codes))
+		for i, c := range codes {
+			values[i] = float64(c)
+		}
+		v, err := ds.AddNumeric(generate, StataByteId, values)
+		if err != nil {
+			return err
+		}
+		if ds.ValueLabel(generate) == nil {
+			vl := NewValueLabel(generate)
+			vl.Set(MergeMasterOnly, "master only (1)")
+			vl.Set(MergeUsingOnly, "using only (2)")
+			vl.Set(MergeMatched, "matched (3)")
+			ds.DefineLabel(vl)
+		}
+		v.ValueLabel = generate
+	}
+	return ds.Sort(keys...)
+}
+
+// fill copies the observations of src listed in rows into v, skipping negative rows.
+func (v *Variable) fill(src *Variable, rows []int) {
+	for i, row := range rows {
+		if row >= 0 {
+			v.fillObs(i, src, row)
+		}
+	}
+}
+
+// fillObs copies observation row of src into observation i of v.
+func (v *Variable) fillObs(i int, src *Variable, row int) {
+	if v.IsString() {
+		v.strs[i] = src.strs[row]
+	} else {
+		v.nums[i] = src.nums[row]
+	}
+}
+
+// copyLabels copies the value labels of src that are not defined in ds.
+func (ds *Dataset) copyLabels(src *Dataset) {
+	for name, vl := range src.labels {
+		if _, ok := ds.labels[name]; !ok {
+			ds.labels[name] = vl.clone()
+		}
+	}
+}
+
+func (vl *ValueLabel) clone() *ValueLabel {
+	c := NewValueLabel(vl.Name)
+	for v, text := range vl.labels {
+		c.labels[v] = text
+	}
+	return c
+}
+
+func keyVars(ds *Dataset, keys []string, which string) ([]*Variable, error) {
+	vars := make([]*Variable, len(keys))
+	for i, name := range keys {
+		if vars[i] = ds.Var(name); vars[i] == nil {
+			return nil, fmt.Errorf("key variable %s not found in %s data", name, which)
+		}
+	}
+	return vars, nil
+}
+
+func checkUniqueKeys(keys []*Variable, nobs int, names []string, which string) error {
+	seen := make(map[string]bool, nobs)
+	for i := 0; i < nobs; i++ {
+		k := keyString(keys, i)
+		if seen[k] {
+			return fmt.Errorf("variable(s) %s do not uniquely identify observations in the %s data", strings.Join(names, " "), which)
+		}
+		seen[k] = true
+	}
+	return nil
+}
+
+// keyString returns a map key identifying the values of keys in observation i.
+func keyString(keys []*Variable, i int) string {
+	var sb strings.Builder
+	for _, v := range keys {
+		if v.IsString() {
+			sb.WriteString(v.strs[i])
+		} else {
+			sb.WriteString(strconv.FormatFloat(v.nums[i], 'g', -1, 64))
+		}
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
+
+// widerType returns the storage type that can hold values of types a and b.
+// It fails if one type is a string and the other is numeric.
+func widerType(a, b byte) (byte, error) {
+	switch {
+	case isStrType(a) != isStrType(b):
+		return 0, fmt.Errorf("type mismatch")
+	case isStrType(a):
+		return max(a, b), nil
+	case a == StataLongId && b == StataFloatId, a == StataFloatId && b == StataLongId:
+		// a float cannot hold every long
+		return StataDoubleId, nil
+	}
+	return max(a, b), nil
+}
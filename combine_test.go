@@ -0,0 +1,141 @@
+package gostata
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestAppend(t *testing.T) {
+	is := is.New(t)
+	master := NewDataset()
+	_, err := master.AddNumeric("id", StataByteId, []float64{1, 2})
+	is.NoErr(err)
+	x, err := master.AddNumeric("x", StataLongId, []float64{10, 20})
+	is.NoErr(err)
+	x.Label = "master label"
+	_, err = master.AddString("s", []string{"a", "b"})
+	is.NoErr(err)
+	vl := NewValueLabel("lbl")
+	vl.Set(1, "one")
+	is.NoErr(master.DefineLabel(vl))
+
+	using := NewDataset()
+	_, err = using.AddNumeric("id", StataByteId, []float64{3})
+	is.NoErr(err)
+	ux, err := using.AddNumeric("x", StataFloatId, []float64{1.5})
+	is.NoErr(err)
+	ux.Label = "using label"
+	_, err = using.AddString("s", []string{"longer"})
+	is.NoErr(err)
+	_, err = using.AddNumeric("y", StataIntId, []float64{7})
+	is.NoErr(err)
+	uvl := NewValueLabel("lbl")
+	uvl.Set(1, "uno")
+	is.NoErr(using.DefineLabel(uvl))
+	is.NoErr(using.DefineLabel(NewValueLabel("other")))
+
+	is.NoErr(master.Append(using, &AppendOptions{Generate: "src"}))
+	is.Equal(master.NumObs(), 3)
+	is.Equal(master.VarNames(), []string{"id", "x", "s", "y", "src"})
+	is.Equal(master.Var("x").TypeName(), "double") // long + float
+	is.Equal(master.Var("x").Label, "master label")
+	is.Equal(master.Var("x").Float(2), 1.5)
+	is.Equal(master.Var("s").TypeName(), "str6")
+	is.Equal(master.Var("s").Str(2), "longer")
+	is.True(IsMissing(master.Var("y").Float(0)))
+	is.Equal(master.Var("y").Float(2), 7.0)
+	is.Equal(master.Var("src").Float(0), 0.0)
+	is.Equal(master.Var("src").Float(2), 1.0)
+	text, _ := master.ValueLabel("lbl").Label(1)
+	is.Equal(text, "one") // master definition wins
+	is.True(master.ValueLabel("other") != nil)
+
+	bad := NewDataset()
+	_, err = bad.AddNumeric("s", StataByteId, []float64{1})
+	is.NoErr(err)
+	is.True(master.Append(bad, nil) != nil)
+	is.NoErr(master.Append(bad, &AppendOptions{Force: true}))
+	is.Equal(master.Var("s").Str(3), "")
+}
+
+func TestMerge(t *testing.T) {
+	is := is.New(t)
+	newMaster := func() *Dataset {
+		ds := NewDataset()
+		_, err := ds.AddNumeric("id", StataByteId, []float64{3, 1, 2, 2})
+		is.NoErr(err)
+		_, err = ds.AddNumeric("v", StataByteId, []float64{30, 10, 20, 21})
+		is.NoErr(err)
+		return ds
+	}
+	using := NewDataset()
+	_, err := using.AddNumeric("id", StataIntId, []float64{2, 4, 1})
+	is.NoErr(err)
+	_, err = using.AddString("name", []string{"two", "four", "one"})
+	is.NoErr(err)
+	_, err = using.AddNumeric("v", StataByteId, []float64{-2, -4, -1})
+	is.NoErr(err)
+
+	master := newMaster()
+	err = master.Merge(OneToOne, []string{"id"}, using, nil)
+	is.True(err != nil) // id is not unique in master
+
+	master = newMaster()
+	is.NoErr(master.Merge(ManyToOne, []string{"id"}, using, nil))
+	is.Equal(master.VarNames(), []string{"id", "v", "name", "_merge"})
+	is.Equal(master.Var("id").TypeName(), "int")
+	is.Equal(master.NumObs(), 5)
+	wantID := []float64{1, 2, 2, 3, 4}
+	wantV := []float64{10, 20, 21, 30, -4}
+	wantName := []string{"one", "two", "two", "", "four"}
+	wantMerge := []float64{3, 3, 3, 1, 2}
+	for i := range wantID {
+		is.Equal(master.Var("id").Float(i), wantID[i])
+		is.Equal(master.Var("v").Float(i), wantV[i])
+		is.Equal(master.Var("name").Str(i), wantName[i])
+		is.Equal(master.Var("_merge").Float(i), wantMerge[i])
+	}
+	text, _ := master.ValueLabel("_merge").Label(MergeMatched)
+	is.Equal(text, "matched (3)")
+	is.Equal(master.Var("_merge").ValueLabel, "_merge")
+
+	// 1:m from the unique side
+	lookup := NewDataset()
+	_, err = lookup.AddNumeric("id", StataByteId, []float64{2})
+	is.NoErr(err)
+	is.NoErr(lookup.Merge(OneToMany, []string{"id"}, newMaster(), &MergeOptions{Generate: "m", KeepUsing: []string{"v"}}))
+	is.Equal(lookup.VarNames(), []string{"id", "v", "m"})
+	is.Equal(lookup.NumObs(), 4)
+	is.Equal(lookup.Var("m").Float(1), 3.0)
+	is.Equal(lookup.Var("m").Float(0), 2.0)
+
+	// a bad indicator name fails before the master is changed
+	for _, generate := range []string{"bad name", "v", "name"} {
+		master = newMaster()
+		is.True(master.Merge(ManyToOne, []string{"id"}, using, &MergeOptions{Generate: generate}) != nil)
+		is.Equal(master.VarNames(), []string{"id", "v"})
+		is.Equal(master.NumObs(), 4)
+		is.Equal(master.Var("id").Float(0), 3.0)
+	}
+
+	strKey := NewDataset()
+	_, err = strKey.AddString("id", []string{"1"})
+	is.NoErr(err)
+	is.True(newMaster().Merge(ManyToOne, []string{"id"}, strKey, nil) != nil)
+}
+
+func TestSort(t *testing.T) {
+	is := is.New(t)
+	ds := NewDataset()
+	_, err := ds.AddNumeric("a", StataByteId, []float64{2, Missing, 1, 2})
+	is.NoErr(err)
+	_, err = ds.AddString("b", []string{"y", "z", "x", "w"})
+	is.NoErr(err)
+	is.NoErr(ds.Sort("a", "b"))
+	is.Equal(ds.Var("b").Str(0), "x")
+	is.Equal(ds.Var("b").Str(1), "w")
+	is.Equal(ds.Var("b").Str(2), "y")
+	is.Equal(ds.Var("b").Str(3), "z")
+	is.True(ds.Sort("nope") != nil)
+}
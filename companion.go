@@ -0,0 +1,167 @@
+package gostata
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DoFile returns a do-file that loads dataFile and applies the metadata of ds: the dataset
+// label, variable labels, display formats, value labels, notes and characteristics. It lets
+// users of any Stata version recover the metadata from plain data, eg from a CSV file
+// written by WriteCSV. Files with extension .dta are loaded with use, .csv files with
+// insheet and other files with insheet as tab-separated text.
+//
+// insheet guesses the type of each column: variables that are strings in ds but hold
+// numbers are converted back with tostring, which loses leading zeros.
+func (ds *Dataset) DoFile(dataFile string) (string, error) {
+	s := NewScript()
+	q, err := QuoteString(dataFile)
+	if err != nil {
+		return "", err
+	}
+	switch strings.ToLower(filepath.Ext(dataFile)) {
+	case ".dta":
+		s.Raw("use " + q + ", clear")
+	case ".csv":
+		s.Raw("insheet using " + q + ", comma names clear")
+	default:
+		s.Raw("insheet using " + q + ", tab names clear")
+	}
+	if !strings.EqualFold(filepath.Ext(dataFile), ".dta") {
+		for _, v := range ds.vars {
+			// insheet may lowercase the names in the header
+			if lower := strings.ToLower(v.Name); lower != v.Name {
+				s.Raw("capture rename " + lower + " " + v.Name)
+			}
+			if v.IsString() {
+				s.Raw("capture confirm string variable " + v.Name)
+				s.Raw("if _rc {")
+				s.Raw("	tostring " + v.Name + ", replace")
+				s.Raw("	replace " + v.Name + ` = "" if ` + v.Name + ` == "."`)
+				s.Raw("}")
+			}
+		}
+	}
+	if ds.Label != "" {
+		s.LabelData(ds.Label)
+	}
+	for _, note := range ds.Notes {
+		s.Note("", note)
+	}
+	for _, name := range sortedKeys(ds.Chars) {
+		s.Char("", name, ds.Chars[name])
+	}
+	for _, v := range ds.vars {
+		if v.Label != "" {
+			s.LabelVariable(v.Name, v.Label)
+		}
+		if v.Format != "" {
+			s.Format(v.Format, v.Name)
+		}
+		for _, note := range v.Notes {
+			s.Note(v.Name, note)
+		}
+		for _, name := range sortedKeys(v.Chars) {
+			s.Char(v.Name, name, v.Chars[name])
+		}
+	}
+	for _, vl := range ds.ValueLabels() {
+		if vl.Len() > 0 {
+			s.LabelDefine(vl)
+		}
+	}
+	for _, v := range ds.vars {
+		if v.ValueLabel != "" {
+			s.LabelValues(v.ValueLabel, v.Name)
+		}
+	}
+	return s.Build()
+}
+
+// DoFile returns a do-file that loads dataFile and applies the labels, formats, notes and
+// characteristics of the fields of sf, like Dataset.DoFile.
+func (sf *File) DoFile(dataFile string) (string, error) {
+	ds := NewDataset()
+	ds.Label = cString(sf.DataLabel[:])
+	for _, fld := range sf.fields {
+		v, err := ds.AddVar(fld.Name, fld.FieldType)
+		if err != nil {
+			return "", err
+		}
+		v.Label, v.ValueLabel = fld.Label, fld.ValueLabel
+		if fld.Format != "" {
+			v.Format = fld.Format
+		}
+		v.Notes, v.Chars = splitNotes(sf.chars[fld.Name])
+	}
+	ds.Notes, ds.Chars = splitNotes(sf.chars["_dta"])
+	for _, vl := range sf.valueLabels {
+		if err := ds.DefineLabel(vl); err != nil {
+			return "", err
+		}
+	}
+	return ds.DoFile(dataFile)
+}
+
+// WriteCSV writes the data of ds to w as CSV with a header of variable names.
+// Numbers are written in full precision, dates as Stata dates (days since 01jan1960) and
+// missing values as empty fields. Labels are not written: see DoFile.
+func (ds *Dataset) WriteCSV(w io.Writer) error {
+	return ds.ExportCSV(w, &ExportOptions{RawDates: true})
+}
+
+// ExportWithDoFile writes ds to dataFile, as CSV if its extension is .csv and in dta
+// format otherwise, and a do-file with the same name and extension .do that loads it
+// and applies the metadata of ds (see DoFile).
+func (ds *Dataset) ExportWithDoFile(dataFile string) error {
+	doFile := strings.TrimSuffix(dataFile, filepath.Ext(dataFile)) + ".do"
+	if doFile == dataFile {
+		return fmt.Errorf("data file %s has extension .do", dataFile)
+	}
+	script, err := ds.DoFile(filepath.Base(dataFile))
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(dataFile), ".csv") {
+		err = writeFileWith(dataFile, ds.WriteCSV)
+	} else {
+		err = ds.WriteFile(dataFile)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(doFile, []byte(script), 0o644)
+}
+
+// writeFileWith creates fileName and writes it with write.
+func writeFileWith(fileName string, write func(w io.Writer) error) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	if err := write(bw); err != nil {
+		f.Close()
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,218 @@
+package gostata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func companionDataset(t *testing.T) *Dataset {
+	t.Helper()
+	ds := NewDataset()
+	ds.Label = "Survey 2024"
+	ds.Notes = []string{"Collected in $region"}
+	ds.Chars = map[string]string{"source": "field team"}
+	id, err := ds.AddNumeric("ID", StataLongId, []float64{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id.Label = "Respondent"
+	zip, err := ds.AddString("zip", []string{"02134", "", "x1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zip.Notes = []string{"5 digits"}
+	if _, err := ds.AddNumeric("score", StataFloatId, []float64{0.1, Missing, ExtendedMissing('a')}); err != nil {
+		t.Fatal(err)
+	}
+	yes, err := ds.AddNumeric("yes", StataByteId, []float64{1, 0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	yes.ValueLabel = "yesno"
+	yes.Chars = map[string]string{"question": "Q`1'"}
+	born, err := ds.AddDate("born", []time.Time{time.Date(1960, 1, 2, 0, 0, 0, 0, time.UTC), {}, time.Date(1959, 12, 31, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	born.Format = "%tdCCYY-NN-DD"
+	vl := NewValueLabel("yesno")
+	vl.Set(0, "No")
+	vl.Set(1, "Yes")
+	if err := ds.DefineLabel(vl); err != nil {
+		t.Fatal(err)
+	}
+	return ds
+}
+
+func TestDoFile(t *testing.T) {
+	ds := companionDataset(t)
+	got, err := ds.DoFile("survey.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "insheet using `\"survey.csv\"', comma names clear\n" +
+		"capture rename id ID\n" +
+		"capture confirm string variable zip\n" +
+		"if _rc {\n" +
+		"\ttostring zip, replace\n" +
+		"\treplace zip = \"\" if zip == \".\"\n" +
+		"}\n" +
+		"label data `\"Survey 2024\"'\n" +
+		"notes: Collected in \\$region\n" +
+		"char _dta[source] field team\n" +
+		"label variable ID `\"Respondent\"'\n" +
+		"format ID %12.0g\n" +
+		"format zip %5s\n" +
+		"notes zip: 5 digits\n" +
+		"format score %10.0g\n" +
+		"format yes %8.0g\n" +
+		"char yes[question] Q\\`1'\n" +
+		"format born %tdCCYY-NN-DD\n" +
+		"label define yesno 0 `\"No\"' 1 `\"Yes\"', replace\n" +
+		"label values yes yesno\n"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	got, err = ds.DoFile("survey.dta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(got, "use `\"survey.dta\"', clear\nlabel data") {
+		t.Errorf("dta do-file:\n%s", got)
+	}
+
+	ds.Notes = []string{"two\nlines"}
+	if _, err := ds.DoFile("survey.csv"); err == nil {
+		t.Error("note with a line break accepted")
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	ds := companionDataset(t)
+	var sb strings.Builder
+	if err := ds.WriteCSV(&sb); err != nil {
+		t.Fatal(err)
+	}
+	want := "ID,zip,score,yes,born\n" +
+		"1,02134,0.1,1,1\n" +
+		"2,,,0,\n" +
+		"3,x1,,1,-1\n"
+	if got := sb.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExportWithDoFile(t *testing.T) {
+	ds := companionDataset(t)
+	dir := t.TempDir()
+	for _, name := range []string{"survey.csv", "survey.dta"} {
+		if err := ds.ExportWithDoFile(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	back, err := ReadFile(filepath.Join(dir, "survey.dta"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.NumObs() != 3 || back.Var("zip").Str(0) != "02134" {
+		t.Errorf("dta not written: %d observations", back.NumObs())
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "survey.do"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), "use `\"survey.dta\"', clear\n") {
+		t.Errorf("do-file does not load the data file by its base name:\n%s", b)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "survey.csv")); err != nil {
+		t.Error(err)
+	}
+	if err := ds.ExportWithDoFile(filepath.Join(dir, "survey.do")); err == nil {
+		t.Error("data file with extension .do accepted")
+	}
+}
+
+func TestFileDoFile(t *testing.T) {
+	sf := NewFile()
+	sf.DataLabel = stataLabel{}
+	fld := sf.AddField("sex", "Sex", []Byte{1, 2})
+	fld.ValueLabel = "sexlbl"
+	vl := NewValueLabel("sexlbl")
+	vl.Set(1, "Male")
+	vl.Set(2, "Female")
+	sf.AddValueLabel(vl)
+	got, err := sf.DoFile("people.dta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "use `\"people.dta\"', clear\n" +
+		"label variable sex `\"Sex\"'\n" +
+		"format sex %9.0g\n" +
+		"label define sexlbl 1 `\"Male\"' 2 `\"Female\"', replace\n" +
+		"label values sex sexlbl\n"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestNotesAndCharsRoundTrip(t *testing.T) {
+	ds := companionDataset(t)
+	ds.Notes = append(ds.Notes, "Second note")
+	name := filepath.Join(t.TempDir(), "survey.dta")
+	if err := ds.WriteFile(name); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := ValidateFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range problems {
+		if p.Section == "characteristics" {
+			t.Errorf("invalid expansion field: %v", p)
+		}
+	}
+	back, err := ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(back.Notes, "|"); got != "Collected in $region|Second note" || back.Chars["source"] != "field team" {
+		t.Errorf("dataset notes %q, chars %v", back.Notes, back.Chars)
+	}
+	if zip := back.Var("zip"); len(zip.Notes) != 1 || zip.Notes[0] != "5 digits" || zip.Chars != nil {
+		t.Errorf("zip notes %q, chars %v", zip.Notes, zip.Chars)
+	}
+	if got := back.Var("yes").Chars["question"]; got != "Q`1'" {
+		t.Errorf("char yes[question] = %q", got)
+	}
+	script, err := back.DoFile("survey.dta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"notes: Collected in \\$region\n",
+		"notes: Second note\n",
+		"char _dta[source] field team\n",
+		"notes zip: 5 digits\n",
+		"char yes[question] Q\\`1'\n",
+	} {
+		if !strings.Contains(script, line) {
+			t.Errorf("do-file lacks %q:\n%s", line, script)
+		}
+	}
+
+	sf, err := NewFileFromDataset(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromFile, err := sf.DoFile("survey.dta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := ds.DoFile("survey.dta"); fromFile != want {
+		t.Errorf("File.DoFile\n%s\nwant\n%s", fromFile, want)
+	}
+}
@@ -0,0 +1,353 @@
+package gostata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// dtaSpec describes a dta file in its on-disk representation. encode lays it out
+// byte by byte following the format documentation, independently of File and Reader.
+type dtaSpec struct {
+	version byte
+	order   binary.ByteOrder
+	label   string
+	stamp   string
+	vars    []specVar
+	rows    [][]interface{} // int8, int16, int32, float32, float64 or string as stored
+	labels  []specLabel
+}
+
+type specVar struct {
+	name, format, vlabel, label string
+	typ                         byte
+}
+
+type specLabel struct {
+	name   string
+	values []int32
+	texts  []string
+}
+
+func (s *dtaSpec) encode() []byte {
+	var buf bytes.Buffer
+	put := func(data interface{}) { binary.Write(&buf, s.order, data) }
+	str := func(v string, n int) {
+		b := make([]byte, n)
+		copy(b, v)
+		buf.Write(b)
+	}
+	byteOrder := byte(2)
+	if s.order == binary.BigEndian {
+		byteOrder = 1
+	}
+	buf.Write([]byte{s.version, byteOrder, 1, 0})
+	put(int16(len(s.vars)))
+	put(int32(len(s.rows)))
+	str(s.label, 81)
+	str(s.stamp, 18)
+	for _, v := range s.vars {
+		buf.WriteByte(v.typ)
+	}
+	for _, v := range s.vars {
+		str(v.name, 33)
+	}
+	str("", 2*(len(s.vars)+1))
+	fmtLen := 12
+	if s.version > 113 {
+		fmtLen = 49
+	}
+	for _, v := range s.vars {
+		str(v.format, fmtLen)
+	}
+	for _, v := range s.vars {
+		str(v.vlabel, 33)
+	}
+	for _, v := range s.vars {
+		str(v.label, 81)
+	}
+	str("", 5)
+	for _, row := range s.rows {
+		for j, x := range row {
+			if v, ok := x.(string); ok {
+				str(v, int(s.vars[j].typ))
+				continue
+			}
+			put(x)
+		}
+	}
+	for _, vl := range s.labels {
+		var txt []byte
+		off := make([]int32, len(vl.texts))
+		for i, t := range vl.texts {
+			off[i] = int32(len(txt))
+			txt = append(append(txt, t...), 0)
+		}
+		put(int32(8 + 8*len(vl.values) + len(txt)))
+		str(vl.name, 33)
+		str("", 3)
+		put(int32(len(vl.values)))
+		put(int32(len(txt)))
+		put(off)
+		put(vl.values)
+		buf.Write(txt)
+	}
+	return buf.Bytes()
+}
+
+// conformanceSpec is the reference file: every storage type with extreme and missing values.
+func conformanceSpec(version byte, order binary.ByteOrder) *dtaSpec {
+	f32 := math.Float32frombits
+	f64 := math.Float64frombits
+	return &dtaSpec{
+		version: version,
+		order:   order,
+		label:   "conformance",
+		stamp:   "01 Jan 2020 12:30",
+		vars: []specVar{
+			{"b", "%8.0g", "blab", "byte var", StataByteId},
+			{"i", "%8.0g", "", "int var", StataIntId},
+			{"l", "%12.0g", "", "long var", StataLongId},
+			{"f", "%9.0g", "", "float var", StataFloatId},
+			{"d", "%10.0g", "", "double var", StataDoubleId},
+			{"s", "%5s", "", "string var", 5},
+			{"dt", "%td", "", "date var", StataLongId},
+		},
+		rows: [][]interface{}{
+			{int8(1), int16(1000), int32(100000), float32(1.5), float64(math.Pi), "a", int32(0)},
+			{int8(-127), int16(-32767), int32(-2147483647), float32(-3.25), float64(-1e300), "hello", int32(21915)},
+			{int8(100), int16(32740), int32(2147483620), f32(0x7effffff), f64(0x7fdfffffffffffff), "", int32(-1)},
+			{int8(101), int16(32741), int32(2147483621), f32(0x7f000000), f64(0x7fe0000000000000), "x y", int32(2147483621)},
+			{int8(127), int16(32742), int32(2147483647), f32(0x7f000800), f64(0x7fe0030000000000), "zz", int32(1)},
+		},
+		labels: []specLabel{{"blab", []int32{1, 100}, []string{"one", "hundred"}}},
+	}
+}
+
+// conformanceDataset builds the dataset described by conformanceSpec through the Dataset API.
+func conformanceDataset(t *testing.T) *Dataset {
+	is := is.New(t)
+	ds := NewDataset()
+	ds.Label = "conformance"
+	ds.TimeStamp = time.Date(2020, 1, 1, 12, 30, 0, 0, time.UTC)
+	add := func(name, label string, typ byte, values ...float64) *Variable {
+		v, err := ds.AddNumeric(name, typ, values)
+		is.NoErr(err)
+		is.Equal(v.Type(), typ)
+		v.Label = label
+		return v
+	}
+	b := add("b", "byte var", StataByteId, 1, -127, 100, Missing, ExtendedMissing('z'))
+	b.ValueLabel = "blab"
+	add("i", "int var", StataIntId, 1000, -32767, 32740, Missing, ExtendedMissing('a'))
+	add("l", "long var", StataLongId, 100000, -2147483647, 2147483620, Missing, ExtendedMissing('z'))
+	add("f", "float var", StataFloatId, 1.5, -3.25, DtaMaxFloat, Missing, ExtendedMissing('a'))
+	add("d", "double var", StataDoubleId, math.Pi, -1e300, DtaMaxDouble, Missing, ExtendedMissing('c'))
+	s, err := ds.AddString("s", []string{"a", "hello", "", "x y", "zz"})
+	is.NoErr(err)
+	s.Label = "string var"
+	dt := add("dt", "date var", StataLongId, 0, 21915, -1, Missing, 1)
+	dt.Format = "%td"
+	vl := NewValueLabel("blab")
+	vl.Set(100, "hundred")
+	vl.Set(1, "one")
+	is.NoErr(ds.DefineLabel(vl))
+	return ds
+}
+
+// checkConformanceDataset verifies that ds holds the values of conformanceSpec.
+func checkConformanceDataset(t *testing.T, ds *Dataset) {
+	t.Helper()
+	want := conformanceDataset(t)
+	is := is.New(t)
+	is.Equal(ds.Label, want.Label)
+	is.Equal(ds.NumObs(), want.NumObs())
+	is.Equal(ds.VarNames(), want.VarNames())
+	for _, wv := range want.Vars() {
+		v := ds.Var(wv.Name)
+		is.Equal(v.Type(), wv.Type())
+		is.Equal(v.Format, wv.Format)
+		is.Equal(v.Label, wv.Label)
+		is.Equal(v.ValueLabel, wv.ValueLabel)
+		is.Equal(v.Kind(), wv.Kind())
+		for i := 0; i < want.NumObs(); i++ {
+			is.Equal(v.Str(i), wv.Str(i))
+			is.Equal(math.Float64bits(v.Float(i)), math.Float64bits(wv.Float(i)))
+		}
+	}
+	is.Equal(ds.Var("dt").Time(1), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	vl := ds.ValueLabel("blab")
+	is.True(vl != nil)
+	is.Equal(vl.Values(), []int32{1, 100})
+	text, _ := vl.Label(100)
+	is.Equal(text, "hundred")
+}
+
+func goldenFile(t *testing.T, name string, got []byte) []byte {
+	t.Helper()
+	fileName := filepath.Join("testdata", "golden", name)
+	if *update {
+		if err := os.WriteFile(fileName, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	return want
+}
+
+// TestConformanceWriter compares the writer output byte for byte with the spec encoding
+// and with the golden file.
+func TestConformanceWriter(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := conformanceDataset(t).WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.Bytes()
+	if want := conformanceSpec(113, binary.LittleEndian).encode(); !bytes.Equal(got, want) {
+		t.Errorf("writer output differs from the spec encoding at byte %d", firstDiff(got, want))
+	}
+	if want := goldenFile(t, "conformance-113.dta", got); !bytes.Equal(got, want) {
+		t.Errorf("writer output differs from testdata/golden/conformance-113.dta at byte %d", firstDiff(got, want))
+	}
+}
+
+// TestConformanceReader reads the reference file in every supported version and byte order.
+func TestConformanceReader(t *testing.T) {
+	for _, version := range []byte{113, 114, 115} {
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			t.Run(fmt.Sprintf("%d-%s", version, order), func(t *testing.T) {
+				data := conformanceSpec(version, order).encode()
+				ds, err := ReadDataset(bytes.NewReader(data))
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkConformanceDataset(t, ds)
+			})
+		}
+	}
+	ds, err := ReadFile(filepath.Join("testdata", "golden", "conformance-113.dta"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkConformanceDataset(t, ds)
+}
+
+// TestConformanceStataFiles reads files saved by Stata itself.
+func TestConformanceStataFiles(t *testing.T) {
+	is := is.New(t)
+	// see testdata/stata/nonint.do
+	ds, err := ReadFile(filepath.Join("testdata", "stata", "nonint.dta"))
+	is.NoErr(err)
+	is.Equal(ds.NumObs(), 2)
+	is.Equal(ds.TimeStamp, time.Date(2016, 7, 12, 0, 54, 0, 0, time.UTC))
+	v1 := ds.Var("v1")
+	is.Equal(v1.TypeName(), "double")
+	is.Equal(v1.Format, "%10.0g")
+	is.Equal(v1.ValueLabel, "v1")
+	is.Equal(v1.Float(0), 1.0)
+	is.Equal(v1.Float(1), 1.2)
+	text, _ := ds.ValueLabel("v1").Label(1)
+	is.Equal(text, "one")
+
+	ds, err = ReadFile(filepath.Join("testdata", "stata", "encodecp.dta"))
+	is.NoErr(err)
+	is.Equal(ds.NumObs(), 6)
+	is.Equal(ds.VarNames(), []string{"num", "chr"})
+	is.Equal(ds.Var("num").ValueLabel, "numlabel")
+	is.Equal(ds.Var("chr").TypeName(), "str3")
+	is.Equal(ds.Var("chr").Str(0), "\xe4") // ä in CP1252
+	is.Equal(ds.Var("chr").Str(4), "EUR")
+	is.Equal(ds.ValueLabel("numlabel").Len(), 6)
+	tab, err := ds.Tabulate(false, "num")
+	is.NoErr(err)
+	is.Equal(tab.Total, 6)
+}
+
+// TestConformanceRoundTrip checks that reading a written file gives back the same dataset
+// and that writing it again gives the same bytes.
+func TestConformanceRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(30))
+	types := []byte{StataByteId, StataIntId, StataLongId, StataFloatId, StataDoubleId, 8}
+	for round := 0; round < 20; round++ {
+		ds := NewDataset()
+		ds.TimeStamp = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		nobs := r.Intn(50)
+		for k := 0; k < 1+r.Intn(10); k++ {
+			name := "v" + string(rune('a'+k))
+			typ := types[r.Intn(len(types))]
+			if isStrType(typ) {
+				values := make([]string, nobs)
+				for i := range values {
+					values[i] = string(rune('a' + r.Intn(26)))[:r.Intn(2)]
+				}
+				if _, err := ds.AddString(name, values); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			values := make([]float64, nobs)
+			for i := range values {
+				switch r.Intn(5) {
+				case 0:
+					values[i] = ExtendedMissing(byte('a' + r.Intn(27)))
+				case 1:
+					values[i] = r.NormFloat64()
+				default:
+					values[i] = float64(r.Intn(200) - 100)
+				}
+			}
+			if _, err := ds.AddNumeric(name, typ, values); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var first, second bytes.Buffer
+		if _, err := ds.WriteTo(&first); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadDataset(bytes.NewReader(first.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range ds.Vars() {
+			gv := got.Var(v.Name)
+			for i := 0; i < nobs; i++ {
+				want := v.Float(i)
+				if v.Type() == StataFloatId {
+					want = decodeFloat(encodeFloat(want))
+				}
+				if gv.Str(i) != v.Str(i) || math.Float64bits(gv.Float(i)) != math.Float64bits(want) {
+					t.Fatalf("round %d: %s[%d] = %v %q, want %v %q", round, v.Name, i, gv.Float(i), gv.Str(i), want, v.Str(i))
+				}
+			}
+		}
+		if _, err := got.WriteTo(&second); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(first.Bytes(), second.Bytes()) {
+			t.Fatalf("round %d: rewriting differs at byte %d", round, firstDiff(first.Bytes(), second.Bytes()))
+		}
+	}
+}
+
+func firstDiff(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return min(len(a), len(b))
+}
@@ -0,0 +1,365 @@
+package gostata
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultNA are the tokens read as missing values by ConvertCSV, in addition to empty fields.
+var DefaultNA = []string{"NA", "N/A", "NULL", "."}
+
+// DefaultDateLayouts are the layouts of the dates recognized by ConvertCSV.
+var DefaultDateLayouts = []string{"2006-01-02", "2006-01-02 15:04:05", time.RFC3339}
+
+// CSVOptions modify ConvertCSV. A nil *CSVOptions uses the defaults.
+type CSVOptions struct {
+	Comma       rune     // field delimiter; defaults to ','
+	NA          []string // tokens read as missing values; nil means DefaultNA
+	DateLayouts []string // time layouts of date columns; nil means DefaultDateLayouts, empty disables dates
+	SampleRows  int      // rows read to infer the types; 0 reads the whole file twice
+	Label       string   // dataset label
+}
+
+// CSVColumn describes a column of a CSV file converted by ConvertCSV.
+type CSVColumn struct {
+	Header     string // column heading
+	Name       string // variable name: the heading if it is a valid name, otherwise v1, v2...
+	Type       byte
+	Format     string
+	DateLayout string // layout of the dates, for %td and %tc columns
+}
+
+// csvColumnState accumulates what the values of a column could be.
+type csvColumnState struct {
+	numeric, date bool
+	numType       byte // smallest type holding the numbers, never float
+	float         bool // all numbers are exact in a float
+	layout        string
+	clock         bool // some date has a time of day
+	width         int
+	seen          bool // some value is not missing
+}
+
+// ConvertCSV converts csvFile, whose first row holds the column headings, to dtaFile.
+// The type of each column is inferred from its values: the smallest numeric type holding
+// them exactly (byte, int, long, float or double), a date (%td, or %tc if some value has a
+// time of day) if they all parse with one of the date layouts, or else a string of the
+// longest value's width. Empty fields, NA tokens and Stata's missing values (. and .a to
+// .z) are missing.
+//
+// With SampleRows set the types are inferred from the first rows only and the file is
+// read once; a later value that does not fit its column is an error. Otherwise the file
+// is read twice. Either way observations are written as they are read, without holding
+// the data in memory.
+func ConvertCSV(dtaFile, csvFile string, opts *CSVOptions) ([]CSVColumn, error) {
+	if opts == nil {
+		opts = &CSVOptions{}
+	}
+	f, err := os.Open(csvFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cols, err := InferCSV(f, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", csvFile, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := writeCSVData(dtaFile, f, cols, opts); err != nil {
+		return nil, fmt.Errorf("%s: %w", csvFile, err)
+	}
+	return cols, nil
+}
+
+// InferCSV reads CSV data from r and returns the columns ConvertCSV would create.
+func InferCSV(r io.Reader, opts *CSVOptions) ([]CSVColumn, error) {
+	if opts == nil {
+		opts = &CSVOptions{}
+	}
+	cr := newCSVReader(r, opts)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("no header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+	cols := csvColumns(header)
+	states := make([]csvColumnState, len(cols))
+	for k := range states {
+		states[k] = csvColumnState{numeric: true, date: true, numType: StataByteId, float: true}
+	}
+	na := naSet(opts)
+	layouts := opts.DateLayouts
+	if layouts == nil {
+		layouts = DefaultDateLayouts
+	}
+	for n := 0; opts.SampleRows <= 0 || n < opts.SampleRows; n++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for k, s := range record {
+			states[k].add(s, na, layouts)
+		}
+	}
+	for k := range cols {
+		if err := states[k].column(&cols[k]); err != nil {
+			return nil, err
+		}
+	}
+	return cols, nil
+}
+
+func newCSVReader(r io.Reader, opts *CSVOptions) *csv.Reader {
+	cr := csv.NewReader(bufio.NewReaderSize(r, 64*1024))
+	if opts.Comma != 0 {
+		cr.Comma = opts.Comma
+	}
+	cr.ReuseRecord = true
+	return cr
+}
+
+func naSet(opts *CSVOptions) map[string]bool {
+	tokens := opts.NA
+	if tokens == nil {
+		tokens = DefaultNA
+	}
+	na := map[string]bool{"": true}
+	for _, t := range tokens {
+		na[t] = true
+	}
+	return na
+}
+
+// csvColumns names the columns after the headings, like Stata's import delimited:
+// headings that are not valid or unique names are replaced by v1, v2... after the column
+// number, or the next unused number if a heading took that name.
+func csvColumns(header []string) []CSVColumn {
+	cols := make([]CSVColumn, len(header))
+	used := make(map[string]bool)
+	for k, h := range header {
+		if k == 0 {
+			h = strings.TrimPrefix(h, "\ufeff")
+		}
+		name := strings.TrimSpace(h)
+		if ValidateName(name) != nil || used[name] {
+			name = "" // named once all headings have claimed theirs
+		} else {
+			used[name] = true
+		}
+		cols[k] = CSVColumn{Header: h, Name: name}
+	}
+	for k := range cols {
+		if cols[k].Name != "" {
+			continue
+		}
+		n := k + 1
+		for used["v"+strconv.Itoa(n)] {
+			n++
+		}
+		cols[k].Name = "v" + strconv.Itoa(n)
+		used[cols[k].Name] = true
+	}
+	return cols
+}
+
+func (st *csvColumnState) add(s string, na map[string]bool, layouts []string) {
+	if na[s] || na[strings.TrimSpace(s)] {
+		return
+	}
+	// missing values do not decide the type, but fit in a string column
+	st.width = max(st.width, len(s))
+	if isMissingToken(strings.TrimSpace(s)) {
+		return
+	}
+	st.seen = true
+	if st.numeric {
+		if x, ok := parseCSVNumber(s); ok {
+			st.numType = exactNumeric(st.numType, x)
+			st.float = st.float && exactInFloat(x)
+		} else {
+			st.numeric = false
+		}
+	}
+	if st.date {
+		if st.layout == "" {
+			for _, layout := range layouts {
+				if _, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+					st.layout = layout
+					break
+				}
+			}
+		}
+		t, err := time.Parse(st.layout, strings.TrimSpace(s))
+		if st.layout == "" || err != nil {
+			st.date = false
+		} else if !st.clock {
+			st.clock = t.Hour() != 0 || t.Minute() != 0 || t.Second() != 0 || t.Nanosecond() != 0
+		}
+	}
+}
+
+// column sets the type and format of col.
+func (st *csvColumnState) column(col *CSVColumn) error {
+	switch {
+	case !st.seen:
+		col.Type = StataByteId
+	case st.date && st.clock:
+		col.Type, col.Format, col.DateLayout = StataDoubleId, "%tc", st.layout
+		return nil
+	case st.date:
+		col.Type, col.Format, col.DateLayout = StataLongId, "%td", st.layout
+		return nil
+	case st.numeric && st.numType == StataDoubleId && st.float:
+		col.Type = StataFloatId
+	case st.numeric:
+		col.Type = st.numType
+	case st.width > maxStrWidth:
+		return fmt.Errorf("column %s: strings of %d bytes, maximum is %d", col.Name, st.width, maxStrWidth)
+	default:
+		col.Type = byte(st.width)
+	}
+	col.Format = defaultFormat(col.Type)
+	return nil
+}
+
+// isMissingToken reports whether s is one of Stata's missing values: . or .a to .z
+func isMissingToken(s string) bool {
+	return s == "." || len(s) == 2 && s[0] == '.' && s[1] >= 'a' && s[1] <= 'z'
+}
+
+// parseCSVNumber parses a decimal number. Hexadecimal, infinite and NaN values, which
+// strconv accepts, are not numbers in a CSV file.
+func parseCSVNumber(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if strings.ContainsAny(s, "xXnN_") {
+		return 0, false
+	}
+	x, err := strconv.ParseFloat(s, 64)
+	if err != nil || IsMissing(x) {
+		return 0, false
+	}
+	return x, true
+}
+
+// writeCSVData writes the records of the CSV data in r to dtaFile with the types of cols.
+func writeCSVData(dtaFile string, r io.Reader, cols []CSVColumn, opts *CSVOptions) (err error) {
+	sf := NewFile()
+	sf.DataLabel = stataLabel{}
+	copy(sf.DataLabel[:maxLabelLen], opts.Label)
+	for _, col := range cols {
+		label := ""
+		if strings.TrimSpace(col.Header) != col.Name {
+			label = col.Header
+		}
+		fld := sf.AddFieldMeta(col.Name, label, col.Type)
+		fld.Format = col.Format
+	}
+	if err := sf.BeginWrite(dtaFile); err != nil {
+		if sf.f != nil {
+			sf.f.Close()
+		}
+		return err
+	}
+	defer func() {
+		if err != nil {
+			sf.f.Close()
+			os.Remove(dtaFile)
+		}
+	}()
+	cr := newCSVReader(r, opts)
+	if _, err := cr.Read(); err != nil {
+		return err
+	}
+	na := naSet(opts)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		for k, s := range record {
+			if err := appendCSVValue(sf, cols[k], s, na); err != nil {
+				line, _ := cr.FieldPos(k)
+				if opts.SampleRows > 0 {
+					err = fmt.Errorf("%w (type inferred from the first %d rows)", err, opts.SampleRows)
+				}
+				return fmt.Errorf("line %d, column %s: %w", line, cols[k].Name, err)
+			}
+		}
+		if err := sf.RecordEnd(); err != nil {
+			return err
+		}
+	}
+	return sf.EndWrite()
+}
+
+// errCSVFit reports a value that does not fit the type of its column.
+var errCSVFit = errors.New("value does not fit the column type")
+
+// appendCSVValue appends value s of column col to the current record.
+func appendCSVValue(sf *File, col CSVColumn, s string, na map[string]bool) error {
+	if isStrType(col.Type) {
+		if na[s] || na[strings.TrimSpace(s)] {
+			s = ""
+		}
+		if len(s) > int(col.Type) {
+			return fmt.Errorf("%w: %q is longer than %d bytes", errCSVFit, s, col.Type)
+		}
+		sf.AppendStringN(s, int(col.Type))
+		return nil
+	}
+	x := Missing
+	trimmed := strings.TrimSpace(s)
+	switch {
+	case na[s] || na[trimmed] || trimmed == ".":
+	case isMissingToken(trimmed):
+		x = ExtendedMissing(trimmed[1])
+	case col.DateLayout != "":
+		t, err := time.Parse(col.DateLayout, trimmed)
+		if err != nil {
+			return fmt.Errorf("%w: %q is not a date in layout %s", errCSVFit, s, col.DateLayout)
+		}
+		if col.Format == "%tc" {
+			x = StataClock(t)
+		} else if x = StataDate(t); StataClock(t) != x*86400000 {
+			return fmt.Errorf("%w: %q has a time of day", errCSVFit, s)
+		}
+	default:
+		var ok bool
+		if x, ok = parseCSVNumber(s); !ok {
+			return fmt.Errorf("%w: %q is not a number", errCSVFit, s)
+		}
+		if exactNumeric(col.Type, x) != col.Type {
+			return fmt.Errorf("%w: %q does not fit in a %s", errCSVFit, s, typeName(col.Type))
+		}
+	}
+	switch col.Type {
+	case StataByteId:
+		sf.AppendByte(encodeByte(x))
+	case StataIntId:
+		sf.AppendInt(encodeInt(x))
+	case StataLongId:
+		sf.AppendLong(encodeLong(x))
+	case StataFloatId:
+		sf.AppendFloat(encodeFloat(x))
+	default:
+		sf.AppendDouble(encodeDouble(x))
+	}
+	return nil
+}
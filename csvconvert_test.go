@@ -0,0 +1,196 @@
+package gostata
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const convertCSV = "\ufeffid,Big Number,price,ratio,when,stamp,name,code,empty,flag\n" +
+	"1,100000,1.1,0.5,2024-01-31,2024-01-31 10:30:00,Ann,007,,NA\n" +
+	"2,-5,2.25,1.25,NA,2024-02-01 00:00:00,\"Smith, Bob\",.a,,1\n" +
+	"3,.,NA,.b,1959-12-31,,,12,,0\n"
+
+func writeTempCSV(t *testing.T, text string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(name, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestConvertCSV(t *testing.T) {
+	src := writeTempCSV(t, convertCSV)
+	dst := filepath.Join(filepath.Dir(src), "data.dta")
+	cols, err := ConvertCSV(dst, src, &CSVOptions{Label: "Converted"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, c := range cols {
+		types = append(types, c.Name+":"+typeName(c.Type)+c.Format)
+	}
+	want := "id:byte%8.0g v2:long%12.0g price:double%10.0g ratio:float%9.0g when:long%td " +
+		"stamp:double%tc name:str10%10s code:byte%8.0g empty:byte%8.0g flag:byte%8.0g"
+	if got := strings.Join(types, " "); got != want {
+		t.Errorf("columns\n%s\nwant\n%s", got, want)
+	}
+
+	ds, err := ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.NumObs() != 3 || ds.Label != "Converted" {
+		t.Fatalf("%d observations, label %q", ds.NumObs(), ds.Label)
+	}
+	if got := ds.Var("v2").Label; got != "Big Number" {
+		t.Errorf("label of v2 = %q", got)
+	}
+	checks := []struct {
+		name string
+		want []float64
+	}{
+		{"id", []float64{1, 2, 3}},
+		{"v2", []float64{100000, -5, Missing}},
+		{"price", []float64{1.1, 2.25, Missing}},
+		{"ratio", []float64{0.5, 1.25, ExtendedMissing('b')}},
+		{"when", []float64{StataDate(time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)), Missing, -1}},
+		{"stamp", []float64{StataClock(time.Date(2024, 1, 31, 10, 30, 0, 0, time.UTC)), StataClock(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)), Missing}},
+		{"code", []float64{7, ExtendedMissing('a'), 12}},
+		{"empty", []float64{Missing, Missing, Missing}},
+		{"flag", []float64{Missing, 1, 0}},
+	}
+	for _, c := range checks {
+		v := ds.Var(c.name)
+		for i, x := range c.want {
+			if got := v.Float(i); got != x {
+				t.Errorf("%s[%d] = %v, want %v", c.name, i, got, x)
+			}
+		}
+	}
+	name := ds.Var("name")
+	if name.Str(0) != "Ann" || name.Str(1) != "Smith, Bob" || name.Str(2) != "" {
+		t.Errorf("name = %q %q %q", name.Str(0), name.Str(1), name.Str(2))
+	}
+	if ds.Var("when").Kind() != DateVar {
+		t.Error("when is not a date")
+	}
+	if got := TimeFromStataClock(ds.Var("stamp").Float(0)); !got.Equal(time.Date(2024, 1, 31, 10, 30, 0, 0, time.UTC)) {
+		t.Errorf("stamp = %v", got)
+	}
+}
+
+func TestConvertCSVExact(t *testing.T) {
+	// a float cannot hold 16777217 or 123456.789, whatever the order of the values
+	src := writeTempCSV(t, "a,b,c,d\n0.5,1.1,0.5,16777217\n16777217,123456.789,100000,0.5\n")
+	dst := filepath.Join(filepath.Dir(src), "data.dta")
+	cols, err := ConvertCSV(dst, src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, c := range cols {
+		types = append(types, typeName(c.Type))
+	}
+	if got := strings.Join(types, " "); got != "double double float double" {
+		t.Errorf("types %s", got)
+	}
+	ds, err := ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string][]float64{
+		"a": {0.5, 16777217},
+		"b": {1.1, 123456.789},
+		"c": {0.5, 100000},
+		"d": {16777217, 0.5},
+	} {
+		for i, x := range want {
+			if got := ds.Var(name).Float(i); got != x {
+				t.Errorf("%s[%d] = %v, want %v", name, i, got, x)
+			}
+		}
+	}
+
+	// with the types inferred from a sample, a value a float would round does not fit
+	_, err = ConvertCSV(dst, src, &CSVOptions{SampleRows: 1})
+	if !errors.Is(err, errCSVFit) {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestConvertCSVSample(t *testing.T) {
+	src := writeTempCSV(t, "n,s\n1,a\n2,b\n1000,c\n")
+	dst := filepath.Join(filepath.Dir(src), "data.dta")
+	_, err := ConvertCSV(dst, src, &CSVOptions{SampleRows: 2})
+	if !errors.Is(err, errCSVFit) || !strings.Contains(err.Error(), "line 4, column n") {
+		t.Fatalf("got error %v", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("partial dta file left behind: %v", err)
+	}
+	// a single pass over all rows infers the right type
+	if _, err := ConvertCSV(dst, src, &CSVOptions{SampleRows: 3}); err != nil {
+		t.Fatal(err)
+	}
+	ds, err := ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ds.Var("n"); v.TypeName() != "int" || v.Float(2) != 1000 || ds.Var("s").Str(2) != "c" {
+		t.Errorf("n is %s, n[3] = %v", v.TypeName(), v.Float(2))
+	}
+}
+
+func TestInferCSVOptions(t *testing.T) {
+	text := "d;x;-;x\n31/01/2024;missing;1;a\n01/02/2024;2.5;2;b\n"
+	cols, err := InferCSV(strings.NewReader(text), &CSVOptions{
+		Comma:       ';',
+		NA:          []string{"missing"},
+		DateLayouts: []string{"02/01/2006"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range cols {
+		got = append(got, c.Name+":"+typeName(c.Type)+c.Format+c.DateLayout)
+	}
+	want := "d:long%td02/01/2006 x:float%9.0g v3:byte%8.0g v4:str1%1s"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got %s, want %s", strings.Join(got, " "), want)
+	}
+
+	cols, err = InferCSV(strings.NewReader("d\n2024-01-31\n"), &CSVOptions{DateLayouts: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cols[0].Type != 10 {
+		t.Errorf("dates not disabled: type %s", typeName(cols[0].Type))
+	}
+	if _, err := InferCSV(strings.NewReader(""), nil); err == nil {
+		t.Error("empty file accepted")
+	}
+
+	// generated names do not repeat the headings
+	for text, want := range map[string]string{
+		"v2,bad name\n1,2\n":      "v2 v3",
+		"bad name,v1,v1\n1,2,3\n": "v2 v1 v3",
+	} {
+		cols, err := InferCSV(strings.NewReader(text), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, c := range cols {
+			names = append(names, c.Name)
+		}
+		if got := strings.Join(names, " "); got != want {
+			t.Errorf("%q: names %s, want %s", text, got, want)
+		}
+	}
+}
@@ -0,0 +1,709 @@
+package gostata
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	maxNameLen  = 32  // variable and value label names
+	maxLabelLen = 80  // dataset and variable labels
+	maxStrWidth = 244 // str1 ... str244
+)
+
+// VarKind classifies a Variable as numeric, string or date.
+type VarKind int
+
+const (
+	NumericVar VarKind = iota
+	StringVar
+	DateVar
+)
+
+// Variable is a named, typed column of a Dataset.
+// Numeric and date columns hold doubles using Stata's missing values (see Missing);
+// string columns hold strings of at most Type() bytes.
+type Variable struct {
+	Name       string
+	Label      string
+	Format     string            // Stata display format eg %9.0g, %td, %10s
+	ValueLabel string            // name of the value label attached to the variable, if any
+	Notes      []string          // notes, as added by notes varname: text
+	Chars      map[string]string // characteristics, as set by char varname[name] text
+	typ        byte
+	nums       []float64
+	strs       []string
+}
+
+// Type returns the Stata storage type code (StataByteId ... StataDoubleId, or 1-244 for strN).
+func (v *Variable) Type() byte { return v.typ }
+
+// TypeName returns the Stata name of the storage type eg "byte" or "str12".
+func (v *Variable) TypeName() string { return typeName(v.typ) }
+
+// Kind returns whether the variable is numeric, string or a date (a numeric variable with a %td format).
+func (v *Variable) Kind() VarKind {
+	switch {
+	case isStrType(v.typ):
+		return StringVar
+	case isDateFormat(v.Format):
+		return DateVar
+	default:
+		return NumericVar
+	}
+}
+
+// IsString reports whether v is a string variable.
+func (v *Variable) IsString() bool { return isStrType(v.typ) }
+
+// Len returns the number of observations held by the variable.
+func (v *Variable) Len() int {
+	if v.IsString() {
+		return len(v.strs)
+	}
+	return len(v.nums)
+}
+
+// Float returns the value of observation i. String variables return Missing.
+func (v *Variable) Float(i int) float64 {
+	if v.IsString() {
+		return Missing
+	}
+	return v.nums[i]
+}
+
+// SetFloat sets the value of observation i. Like Stata's replace, it promotes the storage
+// type when x does not fit in it; values of float variables are rounded to float precision.
+func (v *Variable) SetFloat(i int, x float64) error {
+	if v.IsString() {
+		return fmt.Errorf("type mismatch: %s is a string variable", v.Name)
+	}
+	if IsMissing(x) {
+		x = missingAt(missingIndex(x))
+	}
+	v.typ = promoteNumeric(v.typ, x)
+	if v.typ == StataFloatId && !IsMissing(x) {
+		x = float64(float32(x))
+	}
+	v.nums[i] = x
+	return nil
+}
+
+// Str returns the value of observation i. Numeric variables return "".
+func (v *Variable) Str(i int) string {
+	if !v.IsString() {
+		return ""
+	}
+	return v.strs[i]
+}
+
+// SetStr sets the value of observation i, widening the storage type if needed.
+func (v *Variable) SetStr(i int, s string) error {
+	if !v.IsString() {
+		return fmt.Errorf("type mismatch: %s is a numeric variable", v.Name)
+	}
+	if len(s) > maxStrWidth {
+		return fmt.Errorf("string too long for %s: %d bytes, maximum is %d", v.Name, len(s), maxStrWidth)
+	}
+	if len(s) > int(v.typ) {
+		v.typ = byte(len(s))
+		v.Format = defaultFormat(v.typ)
+	}
+	v.strs[i] = s
+	return nil
+}
+
+// Time returns observation i of a date variable as a time.Time.
+// Missing dates return the zero time.
+func (v *Variable) Time(i int) time.Time {
+	x := v.Float(i)
+	if IsMissing(x) {
+		return time.Time{}
+	}
+	return TimeFromStataDate(x)
+}
+
+// SetTime stores t as a Stata date (%td) in observation i. A zero t stores Missing.
+func (v *Variable) SetTime(i int, t time.Time) error {
+	if t.IsZero() {
+		return v.SetFloat(i, Missing)
+	}
+	return v.SetFloat(i, StataDate(t))
+}
+
+// grow extends the variable to n observations filled with missing values.
+func (v *Variable) grow(n int) {
+	if v.IsString() {
+		for len(v.strs) < n {
+			v.strs = append(v.strs, "")
+		}
+		return
+	}
+	for len(v.nums) < n {
+		v.nums = append(v.nums, Missing)
+	}
+}
+
+// ValueLabel maps integer values to text, like a Stata label define.
+type ValueLabel struct {
+	Name   string
+	labels map[int32]string
+}
+
+// NewValueLabel returns an empty value label called name.
+func NewValueLabel(name string) *ValueLabel {
+	return &ValueLabel{Name: name, labels: make(map[int32]string)}
+}
+
+// Set labels value with text, replacing any existing label.
+func (vl *ValueLabel) Set(value int32, text string) {
+	vl.labels[value] = text
+}
+
+// Label returns the text attached to value.
+func (vl *ValueLabel) Label(value int32) (string, bool) {
+	s, ok := vl.labels[value]
+	return s, ok
+}
+
+// Values returns the labelled values in ascending order.
+func (vl *ValueLabel) Values() []int32 {
+	values := make([]int32, 0, len(vl.labels))
+	for v := range vl.labels {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	return values
+}
+
+// Len returns the number of labelled values.
+func (vl *ValueLabel) Len() int { return len(vl.labels) }
+
+// Dataset is an in-memory Stata dataset: an ordered list of equal-length variables
+// plus the value labels they refer to.
+type Dataset struct {
+	Label     string            // dataset label
+	TimeStamp time.Time         // time saved; the zero value means now
+	Notes     []string          // notes on the dataset, as added by notes: text
+	Chars     map[string]string // characteristics, as set by char _dta[name] text
+	vars      []*Variable
+	labels    map[string]*ValueLabel
+	nobs      int
+}
+
+// NewDataset returns an empty dataset.
+func NewDataset() *Dataset {
+	return &Dataset{labels: make(map[string]*ValueLabel)}
+}
+
+// NumObs returns the number of observations.
+func (ds *Dataset) NumObs() int { return ds.nobs }
+
+// NumVars returns the number of variables.
+func (ds *Dataset) NumVars() int { return len(ds.vars) }
+
+// Vars returns the variables in dataset order.
+func (ds *Dataset) Vars() []*Variable {
+	return append([]*Variable(nil), ds.vars...)
+}
+
+// Var returns the variable called name or nil if there is none.
+func (ds *Dataset) Var(name string) *Variable {
+	if i := ds.index(name); i >= 0 {
+		return ds.vars[i]
+	}
+	return nil
+}
+
+// VarNames returns the variable names in dataset order.
+func (ds *Dataset) VarNames() []string {
+	names := make([]string, len(ds.vars))
+	for i, v := range ds.vars {
+		names[i] = v.Name
+	}
+	return names
+}
+
+// lookup returns the named variables.
+func (ds *Dataset) lookup(names []string) ([]*Variable, error) {
+	vars := make([]*Variable, len(names))
+	for i, name := range names {
+		if vars[i] = ds.Var(name); vars[i] == nil {
+			return nil, fmt.Errorf("variable %s not found", name)
+		}
+	}
+	return vars, nil
+}
+
+func (ds *Dataset) index(name string) int {
+	for i, v := range ds.vars {
+		if v.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// AddVar adds a variable of storage type typ with all observations missing (or "" for strings).
+func (ds *Dataset) AddVar(name string, typ byte) (*Variable, error) {
+	if err := ds.checkNewName(name); err != nil {
+		return nil, err
+	}
+	if !validType(typ) {
+		return nil, fmt.Errorf("invalid storage type %d for variable %s", typ, name)
+	}
+	v := &Variable{Name: name, Format: defaultFormat(typ), typ: typ}
+	v.grow(ds.nobs)
+	ds.vars = append(ds.vars, v)
+	return v, nil
+}
+
+// AddNumeric adds a numeric variable of storage type typ holding values. If some value
+// does not fit in typ, the variable takes the smallest type holding all values exactly.
+func (ds *Dataset) AddNumeric(name string, typ byte, values []float64) (*Variable, error) {
+	if isStrType(typ) {
+		return nil, fmt.Errorf("invalid numeric type %s for variable %s", typeName(typ), name)
+	}
+	if err := ds.checkLen(name, len(values)); err != nil {
+		return nil, err
+	}
+	if validType(typ) {
+		typ = exactType(typ, values)
+	}
+	v, err := ds.AddVar(name, typ)
+	if err != nil {
+		return nil, err
+	}
+	for i, x := range values {
+		v.SetFloat(i, x)
+	}
+	v.Format = defaultFormat(v.typ)
+	return v, nil
+}
+
+// AddString adds a string variable holding values. Its width is that of the longest value.
+func (ds *Dataset) AddString(name string, values []string) (*Variable, error) {
+	if err := ds.checkLen(name, len(values)); err != nil {
+		return nil, err
+	}
+	width := 1
+	for _, s := range values {
+		if len(s) > maxStrWidth {
+			return nil, fmt.Errorf("string too long for %s: %d bytes, maximum is %d", name, len(s), maxStrWidth)
+		}
+		if len(s) > width {
+			width = len(s)
+		}
+	}
+	v, err := ds.AddVar(name, byte(width))
+	if err != nil {
+		return nil, err
+	}
+	copy(v.strs, values)
+	return v, nil
+}
+
+// AddDate adds a date variable (a long formatted %td) holding values.
+// Zero times are stored as missing.
+func (ds *Dataset) AddDate(name string, values []time.Time) (*Variable, error) {
+	if err := ds.checkLen(name, len(values)); err != nil {
+		return nil, err
+	}
+	v, err := ds.AddVar(name, StataLongId)
+	if err != nil {
+		return nil, err
+	}
+	for i, t := range values {
+		v.SetTime(i, t)
+	}
+	v.Format = "%td"
+	return v, nil
+}
+
+// Drop removes the named variables.
+func (ds *Dataset) Drop(names ...string) error {
+	drop := make(map[string]bool, len(names))
+	for _, name := range names {
+		if ds.index(name) < 0 {
+			return fmt.Errorf("variable %s not found", name)
+		}
+		drop[name] = true
+	}
+	vars := ds.vars[:0]
+	for _, v := range ds.vars {
+		if !drop[v.Name] {
+			vars = append(vars, v)
+		}
+	}
+	ds.vars = vars
+	return nil
+}
+
+// Rename renames variable oldName to newName.
+func (ds *Dataset) Rename(oldName, newName string) error {
+	i := ds.index(oldName)
+	if i < 0 {
+		return fmt.Errorf("variable %s not found", oldName)
+	}
+	if oldName == newName {
+		return nil
+	}
+	if err := ds.checkNewName(newName); err != nil {
+		return err
+	}
+	ds.vars[i].Name = newName
+	return nil
+}
+
+// Order moves the named variables to the front of the dataset in the given order,
+// leaving the others in their current order, like Stata's order command.
+func (ds *Dataset) Order(names ...string) error {
+	front := make([]*Variable, 0, len(ds.vars))
+	moved := make(map[string]bool, len(names))
+	for _, name := range names {
+		v := ds.Var(name)
+		if v == nil {
+			return fmt.Errorf("variable %s not found", name)
+		}
+		if moved[name] {
+			continue
+		}
+		moved[name] = true
+		front = append(front, v)
+	}
+	for _, v := range ds.vars {
+		if !moved[v.Name] {
+			front = append(front, v)
+		}
+	}
+	ds.vars = front
+	return nil
+}
+
+// SetObs changes the number of observations to n, filling new observations with missing values.
+// Like Stata's set obs, it cannot reduce the number of observations.
+func (ds *Dataset) SetObs(n int) error {
+	if n < ds.nobs {
+		return fmt.Errorf("observations cannot be reduced from %d to %d", ds.nobs, n)
+	}
+	ds.setObs(n)
+	return nil
+}
+
+func (ds *Dataset) setObs(n int) {
+	ds.nobs = n
+	for _, v := range ds.vars {
+		v.grow(n)
+	}
+}
+
+// DefineLabel adds value label vl to the dataset, replacing any value label with the same name.
+func (ds *Dataset) DefineLabel(vl *ValueLabel) error {
+	if err := ValidateName(vl.Name); err != nil {
+		return err
+	}
+	ds.labels[vl.Name] = vl
+	return nil
+}
+
+// ValueLabel returns the value label called name or nil if there is none.
+func (ds *Dataset) ValueLabel(name string) *ValueLabel {
+	return ds.labels[name]
+}
+
+// ValueLabels returns the value labels sorted by name.
+func (ds *Dataset) ValueLabels() []*ValueLabel {
+	vls := make([]*ValueLabel, 0, len(ds.labels))
+	for _, vl := range ds.labels {
+		vls = append(vls, vl)
+	}
+	sort.Slice(vls, func(i, j int) bool { return vls[i].Name < vls[j].Name })
+	return vls
+}
+
+// WriteTo writes the dataset to w in dta format 113.
+func (ds *Dataset) WriteTo(w io.Writer) (int64, error) {
+	sf, err := NewFileFromDataset(ds)
+	if err != nil {
+		return 0, err
+	}
+	return sf.WriteTo(w)
+}
+
+// WriteFile writes the dataset to fileName in dta format 113.
+func (ds *Dataset) WriteFile(fileName string) error {
+	sf, err := NewFileFromDataset(ds)
+	if err != nil {
+		return err
+	}
+	return sf.WriteFile(fileName)
+}
+
+// ReadFile reads the dta file fileName into a Dataset.
+func ReadFile(fileName string) (*Dataset, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadDataset(f)
+}
+
+func (ds *Dataset) checkNewName(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	if ds.index(name) >= 0 {
+		return fmt.Errorf("variable %s already defined", name)
+	}
+	return nil
+}
+
+// checkLen verifies a new variable with n observations fits the dataset.
+// The first variable added sets the number of observations.
+func (ds *Dataset) checkLen(name string, n int) error {
+	if len(ds.vars) == 0 {
+		ds.nobs = n
+		return nil
+	}
+	if n != ds.nobs {
+		return fmt.Errorf("variable %s has %d observations, dataset has %d", name, n, ds.nobs)
+	}
+	return nil
+}
+
+// reservedNames cannot be used as variable names.
+var reservedNames = map[string]bool{
+	"_all": true, "_b": true, "byte": true, "_coef": true, "_cons": true, "double": true,
+	"float": true, "if": true, "in": true, "int": true, "long": true, "_n": true, "_N": true,
+	"_pi": true, "_pred": true, "_rc": true, "_skip": true, "strL": true, "using": true, "with": true,
+}
+
+// ValidateName returns an error if name is not a valid Stata name: 1 to 32 letters, digits
+// or underscores, not starting with a digit and not a reserved word.
+func ValidateName(name string) error {
+	if name == "" || len(name) > maxNameLen {
+		return fmt.Errorf("invalid name %q: must be 1 to %d characters", name, maxNameLen)
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return fmt.Errorf("invalid name %q", name)
+		}
+	}
+	if reservedNames[name] {
+		return fmt.Errorf("invalid name %q: reserved word", name)
+	}
+	return nil
+}
+
+var stataEpoch = time.Date(1960, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// StataDate converts t to a Stata date: the number of days since 01jan1960.
+func StataDate(t time.Time) float64 {
+	t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return float64((t.Unix() - stataEpoch.Unix()) / 86400)
+}
+
+// TimeFromStataDate converts Stata date d to a time.Time in UTC.
+func TimeFromStataDate(d float64) time.Time {
+	return stataEpoch.AddDate(0, 0, int(d))
+}
+
+// StataClock converts t to a Stata datetime (%tc): the number of milliseconds since
+// 01jan1960 00:00:00, ignoring leap seconds. The time zone of t is ignored.
+func StataClock(t time.Time) float64 {
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	return float64(t.UnixMilli() - stataEpoch.UnixMilli())
+}
+
+// TimeFromStataClock converts Stata datetime c to a time.Time in UTC.
+func TimeFromStataClock(c float64) time.Time {
+	return time.UnixMilli(int64(c) + stataEpoch.UnixMilli()).UTC()
+}
+
+func isStrType(typ byte) bool { return typ >= 1 && typ <= maxStrWidth }
+
+func validType(typ byte) bool { return isStrType(typ) || typ >= StataByteId }
+
+func isDateFormat(format string) bool {
+	return strings.HasPrefix(format, "%td") || strings.HasPrefix(format, "%d")
+}
+
+func typeName(typ byte) string {
+	switch typ {
+	case StataByteId:
+		return "byte"
+	case StataIntId:
+		return "int"
+	case StataLongId:
+		return "long"
+	case StataFloatId:
+		return "float"
+	case StataDoubleId:
+		return "double"
+	}
+	return fmt.Sprintf("str%d", typ)
+}
+
+// defaultFormat returns the format Stata assigns to new variables of type typ.
+func defaultFormat(typ byte) string {
+	switch typ {
+	case StataByteId, StataIntId:
+		return "%8.0g"
+	case StataLongId:
+		return "%12.0g"
+	case StataFloatId:
+		return "%9.0g"
+	case StataDoubleId:
+		return "%10.0g"
+	}
+	return fmt.Sprintf("%%%ds", typ)
+}
+
+// promoteNumeric returns the smallest numeric type no narrower than typ that can hold x,
+// like Stata's replace. byte and int are promoted to long for larger integers and to float
+// for other values; long is promoted to double, which keeps its values exact. float stays
+// float, rounding x, unless x is out of its range.
+func promoteNumeric(typ byte, x float64) byte {
+	if IsMissing(x) {
+		return typ
+	}
+	switch typ {
+	case StataDoubleId:
+		return typ
+	case StataFloatId:
+		if math.Abs(x) <= DtaMaxFloat {
+			return typ
+		}
+		return StataDoubleId
+	}
+	if x == math.Trunc(x) && x >= DtaMinLong && x <= DtaMaxLong {
+		switch {
+		case typ == StataByteId && x >= DtaMinByte && x <= DtaMaxByte:
+			return StataByteId
+		case typ <= StataIntId && x >= DtaMinInt && x <= DtaMaxInt:
+			return StataIntId
+		}
+		return StataLongId
+	}
+	// integers that a float would round need a double too
+	if typ == StataLongId || math.Abs(x) > DtaMaxFloat || x == math.Trunc(x) && float64(float32(x)) != x {
+		return StataDoubleId
+	}
+	return StataFloatId
+}
+
+// exactNumeric returns the smallest numeric type no narrower than typ that holds x exactly.
+// Integer types are promoted to long, then to double; float is promoted to double
+// only if x is not exactly representable.
+func exactNumeric(typ byte, x float64) byte {
+	if IsMissing(x) {
+		return typ
+	}
+	switch typ {
+	case StataDoubleId:
+		return typ
+	case StataFloatId:
+		if exactInFloat(x) {
+			return typ
+		}
+		return StataDoubleId
+	}
+	if x != math.Trunc(x) || x < DtaMinLong || x > DtaMaxLong {
+		return StataDoubleId
+	}
+	switch {
+	case typ == StataByteId && x >= DtaMinByte && x <= DtaMaxByte:
+		return StataByteId
+	case typ <= StataIntId && x >= DtaMinInt && x <= DtaMaxInt:
+		return StataIntId
+	}
+	return StataLongId
+}
+
+// exactInFloat reports whether a float holds x exactly.
+func exactInFloat(x float64) bool {
+	return IsMissing(x) || float64(float32(x)) == x && math.Abs(x) <= DtaMaxFloat
+}
+
+// exactType returns the smallest numeric type no narrower than typ that holds all values
+// exactly, whatever their order: a double is narrowed to a float if every value fits in one.
+func exactType(typ byte, values []float64) byte {
+	float := typ != StataDoubleId
+	for _, x := range values {
+		typ = exactNumeric(typ, x)
+		float = float && exactInFloat(x)
+	}
+	if typ == StataDoubleId && float {
+		return StataFloatId
+	}
+	return typ
+}
+
+// Sort sorts the observations in ascending order of the named variables, like Stata's sort.
+// Missing values sort after all nonmissing values; the sort is stable.
+func (ds *Dataset) Sort(names ...string) error {
+	keys, err := ds.lookup(names)
+	if err != nil {
+		return err
+	}
+	rows := sortedRows(keys, ds.nobs)
+	for _, v := range ds.vars {
+		*v = *v.take(rows, v.typ)
+	}
+	return nil
+}
+
+// compareObs compares observation i of variables a with observation j of variables b.
+func compareObs(a []*Variable, i int, b []*Variable, j int) int {
+	for k := range a {
+		if a[k].IsString() {
+			if c := strings.Compare(a[k].strs[i], b[k].strs[j]); c != 0 {
+				return c
+			}
+			continue
+		}
+		x, y := a[k].nums[i], b[k].nums[j]
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// take returns a copy of v with storage type typ holding the observations listed in rows.
+// A negative row gives a missing value.
+func (v *Variable) take(rows []int, typ byte) *Variable {
+	nv := *v
+	nv.typ = typ
+	nv.nums, nv.strs = nil, nil
+	if v.IsString() {
+		nv.strs = make([]string, len(rows))
+		for i, row := range rows {
+			if row >= 0 {
+				nv.strs[i] = v.strs[row]
+			}
+		}
+		return &nv
+	}
+	nv.nums = make([]float64, len(rows))
+	for i, row := range rows {
+		if row >= 0 {
+			nv.nums[i] = v.nums[row]
+		} else {
+			nv.nums[i] = Missing
+		}
+	}
+	return &nv
+}
@@ -0,0 +1,129 @@
+package gostata
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func newTestDataset(t *testing.T) *Dataset {
+	is := is.New(t)
+	ds := NewDataset()
+	ds.Label = "test data"
+	_, err := ds.AddNumeric("id", StataByteId, []float64{1, 2, 3})
+	is.NoErr(err)
+	_, err = ds.AddString("name", []string{"ann", "bob", ""})
+	is.NoErr(err)
+	_, err = ds.AddDate("dob", []time.Time{
+		time.Date(1960, 1, 2, 0, 0, 0, 0, time.UTC),
+		time.Date(2000, 2, 29, 0, 0, 0, 0, time.UTC),
+		{},
+	})
+	is.NoErr(err)
+	sex, err := ds.AddNumeric("sex", StataByteId, []float64{1, 2, ExtendedMissing('a')})
+	is.NoErr(err)
+	sex.Label = "Sex"
+	sex.ValueLabel = "sexlbl"
+	vl := NewValueLabel("sexlbl")
+	vl.Set(1, "male")
+	vl.Set(2, "female")
+	is.NoErr(ds.DefineLabel(vl))
+	return ds
+}
+
+func TestDatasetVariables(t *testing.T) {
+	is := is.New(t)
+	ds := newTestDataset(t)
+	is.Equal(ds.NumObs(), 3)
+	is.Equal(ds.VarNames(), []string{"id", "name", "dob", "sex"})
+	is.Equal(ds.Var("name").Kind(), StringVar)
+	is.Equal(ds.Var("name").TypeName(), "str3")
+	is.Equal(ds.Var("dob").Kind(), DateVar)
+	is.Equal(ds.Var("dob").Float(0), 1.0)
+	is.Equal(ds.Var("dob").Time(1), time.Date(2000, 2, 29, 0, 0, 0, 0, time.UTC))
+	is.True(ds.Var("dob").Time(2).IsZero())
+
+	_, err := ds.AddNumeric("id", StataByteId, []float64{1, 2, 3})
+	is.True(err != nil) // duplicate name
+	_, err = ds.AddNumeric("x", StataByteId, []float64{1})
+	is.True(err != nil) // wrong length
+	_, err = ds.AddVar("2x", StataByteId)
+	is.True(err != nil) // invalid name
+
+	is.NoErr(ds.Rename("id", "pid"))
+	is.True(ds.Rename("pid", "name") != nil)
+	is.NoErr(ds.Order("sex", "dob"))
+	is.Equal(ds.VarNames(), []string{"sex", "dob", "pid", "name"})
+	is.NoErr(ds.Drop("dob"))
+	is.Equal(ds.VarNames(), []string{"sex", "pid", "name"})
+	is.True(ds.Drop("dob") != nil)
+
+	is.NoErr(ds.SetObs(4))
+	is.True(IsMissing(ds.Var("pid").Float(3)))
+	is.Equal(ds.Var("name").Str(3), "")
+	is.True(ds.SetObs(2) != nil)
+}
+
+func TestDatasetSetCells(t *testing.T) {
+	is := is.New(t)
+	ds := newTestDataset(t)
+	id := ds.Var("id")
+	is.NoErr(id.SetFloat(0, 1000))
+	is.Equal(id.TypeName(), "int")
+	is.NoErr(id.SetFloat(1, 1e6))
+	is.Equal(id.TypeName(), "long")
+	is.NoErr(id.SetFloat(2, 0.5))
+	is.Equal(id.TypeName(), "double")
+	is.True(id.SetStr(0, "x") != nil)
+
+	small, err := ds.AddNumeric("small", StataByteId, make([]float64, ds.NumObs()))
+	is.NoErr(err)
+	is.NoErr(small.SetFloat(0, 0.1))
+	is.Equal(small.TypeName(), "float") // byte and int promote to float
+	is.Equal(small.Float(0), float64(float32(0.1)))
+	is.NoErr(small.SetFloat(1, 1.0000001))
+	is.Equal(small.TypeName(), "float") // a float stays float, rounding the value
+	is.Equal(small.Float(1), float64(float32(1.0000001)))
+	is.NoErr(small.SetFloat(2, 1e39))
+	is.Equal(small.TypeName(), "double")
+
+	// new variables take the smallest type holding every value exactly, in any order
+	for _, tt := range []struct {
+		values []float64
+		typ    string
+	}{
+		{[]float64{0.5, 16777217, Missing}, "double"},
+		{[]float64{16777217, 0.5, 1}, "double"},
+		{[]float64{0.5, 100000, Missing}, "float"},
+		{[]float64{100000, 0.5, 1}, "float"},
+		{[]float64{0.1, 1, Missing}, "double"},
+		{[]float64{16777217, Missing, 1}, "long"},
+	} {
+		v, err := ds.AddNumeric("exact", StataByteId, tt.values)
+		is.NoErr(err)
+		is.Equal(v.TypeName(), tt.typ)
+		is.Equal(v.Float(0), tt.values[0])
+		is.Equal(v.Float(1), tt.values[1])
+		is.NoErr(ds.Drop("exact"))
+	}
+
+	name := ds.Var("name")
+	is.NoErr(name.SetStr(0, "christopher"))
+	is.Equal(name.TypeName(), "str11")
+	is.Equal(name.Format, "%11s")
+	is.True(name.SetFloat(0, 1) != nil)
+}
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"x", "_x1", "A_b", "abcdefghijklmnopqrstuvwxyz012345"} {
+		if err := ValidateName(name); err != nil {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "1x", "a-b", "in", "_N", "abcdefghijklmnopqrstuvwxyz0123456"} {
+		if err := ValidateName(name); err == nil {
+			t.Errorf("%q: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,574 @@
+package gostata
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Dictionary is a Stata infile dictionary (.dct): the layout of a fixed-width text file,
+// eg
+//
+//	infile dictionary using "survey.raw" {
+//	  _column(1)  long   id     %3f   "Respondent"
+//	  _column(5)  str10  name   %10s  "Name"
+//	  _column(16) double income %9f   "Income"
+//	}
+type Dictionary struct {
+	Using     string // raw data file, relative to the dictionary; empty if the data follow it
+	FirstLine int    // first line of data in the raw file (_firstlineoffile); 0 means 1
+	Lines     int    // lines per observation (_lines); 0 means 1
+	Fields    []DictField
+	data      string // data following the closing brace when Using is empty
+}
+
+// DictField is a variable of a Dictionary.
+type DictField struct {
+	Line       int  // line of the observation holding the field (_line); 0 means 1
+	Column     int  // first column (_column), from 1; 0 continues after the previous field
+	Skip       int  // columns skipped before the field (_skip)
+	Type       byte // storage type; 0 means float
+	Name       string
+	ValueLabel string // value label attached with name:label
+	Format     string // input format, eg %8f, %10.2f or %20s; empty reads up to the next blank
+	Label      string
+}
+
+var (
+	infmtPattern     = regexp.MustCompile(`^%([0-9]*)(?:\.([0-9]+))?([fgesS])$`)
+	dictDirective    = regexp.MustCompile(`^_(column|skip|line|lines|newline|firstlineoffile)(?:\(\s*([0-9]+)\s*\))?$`)
+	dictLabelPattern = regexp.MustCompile(`^"[^"]*"$`)
+)
+
+// infmt parses an input format, returning a width of 0 for free format.
+func infmt(format string) (width, decimals int, str bool, err error) {
+	if format == "" {
+		return 0, 0, false, nil
+	}
+	m := infmtPattern.FindStringSubmatch(format)
+	if m == nil {
+		return 0, 0, false, fmt.Errorf("invalid input format %q", format)
+	}
+	width, _ = strconv.Atoi(m[1])
+	decimals, _ = strconv.Atoi(m[2])
+	return width, decimals, m[3] == "s" || m[3] == "S", nil
+}
+
+// NewDictionary returns the layout of ds as fixed-width text, one observation per line
+// with a blank between fields, to be written by WriteData. using is the raw file name
+// recorded in the dictionary. Strings take the width of their storage type and numbers
+// the width of their longest value.
+func NewDictionary(ds *Dataset, using string) (*Dictionary, error) {
+	d := &Dictionary{Using: using}
+	col := 1
+	for _, v := range ds.vars {
+		if strings.Contains(v.Label, `"`) {
+			return nil, fmt.Errorf("label of %s contains a double quote", v.Name)
+		}
+		width := int(v.typ)
+		format := "%" + strconv.Itoa(width) + "s"
+		if !v.IsString() {
+			width = 1
+			for i := 0; i < ds.nobs; i++ {
+				width = max(width, len(fixedNumber(v, i)))
+			}
+			format = "%" + strconv.Itoa(width) + "f"
+		}
+		d.Fields = append(d.Fields, DictField{
+			Column:     col,
+			Type:       v.typ,
+			Name:       v.Name,
+			ValueLabel: v.ValueLabel,
+			Format:     format,
+			Label:      v.Label,
+		})
+		col += width + 1
+	}
+	return d, nil
+}
+
+// fixedNumber formats observation i of numeric variable v.
+func fixedNumber(v *Variable, i int) string {
+	x := v.nums[i]
+	if code := MissingCode(x); code == '.' {
+		return "."
+	} else if code != 0 {
+		return "." + string(code)
+	}
+	if v.typ == StataFloatId {
+		return strconv.FormatFloat(x, 'g', -1, 32)
+	}
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
+
+// WriteTo writes the dictionary in .dct syntax.
+func (d *Dictionary) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	if strings.ContainsAny(d.Using, "\"\r\n") {
+		return 0, fmt.Errorf("invalid file name %q", d.Using)
+	}
+	if d.Using != "" {
+		fmt.Fprintf(cw, "infile dictionary using \"%s\" {\n", d.Using)
+	} else {
+		fmt.Fprintf(cw, "infile dictionary {\n")
+	}
+	if d.FirstLine > 1 {
+		fmt.Fprintf(cw, "  _firstlineoffile(%d)\n", d.FirstLine)
+	}
+	if d.Lines > 1 {
+		fmt.Fprintf(cw, "  _lines(%d)\n", d.Lines)
+	}
+	tw := tabwriter.NewWriter(cw, 0, 0, 1, ' ', 0)
+	line := 1
+	for _, f := range d.Fields {
+		if err := ValidateName(f.Name); err != nil {
+			return cw.n, err
+		}
+		if strings.Contains(f.Label, `"`) {
+			return cw.n, fmt.Errorf("label of %s contains a double quote", f.Name)
+		}
+		var pos []string
+		if f.Line > line {
+			pos = append(pos, fmt.Sprintf("_line(%d)", f.Line))
+			line = f.Line
+		}
+		if f.Column > 0 {
+			pos = append(pos, fmt.Sprintf("_column(%d)", f.Column))
+		}
+		if f.Skip > 0 {
+			pos = append(pos, fmt.Sprintf("_skip(%d)", f.Skip))
+		}
+		typ := f.Type
+		if typ == 0 {
+			typ = StataFloatId
+		}
+		name := f.Name
+		if f.ValueLabel != "" {
+			name += ":" + f.ValueLabel
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t\"%s\"\n", strings.Join(pos, " "), typeName(typ), name, f.Format, f.Label)
+	}
+	tw.Flush()
+	fmt.Fprintf(cw, "}\n")
+	return cw.n, cw.err
+}
+
+// countingWriter counts the bytes written and keeps the first error.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
+
+// WriteData writes the observations of ds as fixed-width text in the layout of d, which
+// must have been made for ds by NewDictionary.
+func (d *Dictionary) WriteData(w io.Writer, ds *Dataset) error {
+	if len(d.Fields) != len(ds.vars) {
+		return fmt.Errorf("dictionary has %d fields, dataset has %d variables", len(d.Fields), len(ds.vars))
+	}
+	bw := bufio.NewWriter(w)
+	var line []byte
+	for i := 0; i < ds.nobs; i++ {
+		line = line[:0]
+		for k, v := range ds.vars {
+			f := d.Fields[k]
+			width, _, _, err := infmt(f.Format)
+			if err != nil {
+				return err
+			}
+			if f.Column < 1 || width == 0 || f.Line > 1 {
+				return fmt.Errorf("field %s is not in fixed columns", f.Name)
+			}
+			for len(line) < f.Column-1 {
+				line = append(line, ' ')
+			}
+			var text string
+			if v.IsString() {
+				text = v.strs[i]
+				if strings.ContainsAny(text, "\r\n") {
+					return fmt.Errorf("observation %d: %s contains a line break", i+1, v.Name)
+				}
+			} else {
+				text = fixedNumber(v, i)
+			}
+			if len(text) > width {
+				return fmt.Errorf("observation %d: %s is wider than %d columns", i+1, v.Name, width)
+			}
+			pad := strings.Repeat(" ", width-len(text))
+			if v.IsString() {
+				line = append(line, text+pad...)
+			} else {
+				line = append(line, pad+text...)
+			}
+		}
+		line = append(line, '\n')
+		if _, err := bw.Write(line); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ParseDictionary parses a Stata infile dictionary. Data following the closing brace
+// are kept and read by ReadData when r is nil.
+func ParseDictionary(r io.Reader) (*Dictionary, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n")
+	d := &Dictionary{}
+	// the header: [infile] dictionary [using filename] {
+	var header []string
+	i := 0
+	for ; i < len(lines) && !strings.Contains(strings.Join(header, " "), "{"); i++ {
+		if text := dictLine(lines[i]); text != "" {
+			header = append(header, text)
+		}
+	}
+	if err := d.parseHeader(strings.Join(header, " ")); err != nil {
+		return nil, err
+	}
+	line := 1
+	for ; i < len(lines); i++ {
+		text := dictLine(lines[i])
+		if text == "" {
+			continue
+		}
+		if text == "}" {
+			d.data = strings.Join(lines[i+1:], "\n")
+			return d, nil
+		}
+		if err := d.parseEntry(text, &line); err != nil {
+			return nil, fmt.Errorf("dictionary line %d: %w", i+1, err)
+		}
+	}
+	return nil, fmt.Errorf("dictionary not terminated by }")
+}
+
+// dictLine returns line without comments and surrounding blanks.
+func dictLine(line string) string {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "*") {
+		return ""
+	}
+	quoted := false
+	for k := 0; k+1 < len(line); k++ {
+		switch {
+		case line[k] == '"':
+			quoted = !quoted
+		case !quoted && line[k:k+2] == "//":
+			return strings.TrimSpace(line[:k])
+		}
+	}
+	return line
+}
+
+func (d *Dictionary) parseHeader(header string) error {
+	before, after, ok := strings.Cut(header, "{")
+	if !ok || strings.TrimSpace(after) != "" {
+		return fmt.Errorf("invalid dictionary header %q", header)
+	}
+	tokens, err := dictTokens(before)
+	if err != nil {
+		return err
+	}
+	if len(tokens) > 0 && tokens[0] == "infile" {
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 0 || tokens[0] != "dictionary" {
+		return fmt.Errorf("invalid dictionary header %q", header)
+	}
+	switch tokens = tokens[1:]; {
+	case len(tokens) == 0:
+	case len(tokens) == 2 && tokens[0] == "using":
+		d.Using = strings.Trim(tokens[1], `"`)
+	default:
+		return fmt.Errorf("invalid dictionary header %q", header)
+	}
+	return nil
+}
+
+// parseEntry parses a line of the dictionary: directives and a variable, eg
+// _column(5) str10 name %10s "Name". line is the current line of the observation.
+func (d *Dictionary) parseEntry(text string, line *int) error {
+	tokens, err := dictTokens(text)
+	if err != nil {
+		return err
+	}
+	f := DictField{Line: *line}
+	for len(tokens) > 0 {
+		m := dictDirective.FindStringSubmatch(tokens[0])
+		if m == nil {
+			break
+		}
+		tokens = tokens[1:]
+		n, _ := strconv.Atoi(m[2])
+		if m[2] == "" && m[1] != "newline" {
+			return fmt.Errorf("_%s requires a number", m[1])
+		}
+		switch m[1] {
+		case "column":
+			f.Column, f.Skip = n, 0
+		case "skip":
+			f.Skip += n
+		case "line":
+			*line, f.Line = n, n
+		case "newline":
+			if m[2] == "" {
+				n = 1
+			}
+			*line += n
+			f.Line = *line
+		case "lines":
+			d.Lines = n
+		case "firstlineoffile":
+			d.FirstLine = n
+		}
+	}
+	if len(tokens) == 0 {
+		if f.Column > 0 || f.Skip > 0 {
+			return fmt.Errorf("_column and _skip must precede a variable")
+		}
+		return nil
+	}
+	f.Type = StataFloatId
+	if storageTypeName.MatchString(tokens[0]) {
+		typ, err := convertTyp(tokens[0])
+		if err != nil {
+			return err
+		}
+		f.Type, tokens = typ, tokens[1:]
+	}
+	if len(tokens) == 0 {
+		return fmt.Errorf("missing variable name")
+	}
+	f.Name, f.ValueLabel, _ = strings.Cut(tokens[0], ":")
+	if err := ValidateName(f.Name); err != nil {
+		return err
+	}
+	tokens = tokens[1:]
+	if len(tokens) > 0 && strings.HasPrefix(tokens[0], "%") {
+		f.Format, tokens = tokens[0], tokens[1:]
+		_, _, str, err := infmt(f.Format)
+		if err != nil {
+			return err
+		}
+		if str != isStrType(f.Type) {
+			return fmt.Errorf("format %s does not match the type of %s", f.Format, f.Name)
+		}
+	}
+	if len(tokens) > 0 && dictLabelPattern.MatchString(tokens[0]) {
+		f.Label, tokens = strings.Trim(tokens[0], `"`), tokens[1:]
+	}
+	if len(tokens) > 0 {
+		return fmt.Errorf("unexpected %q", tokens[0])
+	}
+	d.Fields = append(d.Fields, f)
+	return nil
+}
+
+// dictTokens splits s at blanks, keeping double-quoted strings together.
+func dictTokens(s string) ([]string, error) {
+	var tokens []string
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		end := strings.IndexAny(s, " \t")
+		if s[0] == '"' {
+			k := strings.IndexByte(s[1:], '"')
+			if k < 0 {
+				return nil, fmt.Errorf("unterminated string %s", s)
+			}
+			end = k + 2
+		}
+		if end < 0 {
+			end = len(s)
+		}
+		tokens = append(tokens, s[:end])
+		s = s[end:]
+	}
+	return tokens, nil
+}
+
+// ReadData reads the raw data in the layout of d into a dataset. If r is nil the data
+// following the dictionary are read. As in Stata, numeric fields that are blank or not
+// numbers are missing, strings are trimmed and truncated to their storage type, and
+// an input format such as %5.2f places an implied decimal point in fields without one.
+func (d *Dictionary) ReadData(r io.Reader) (*Dataset, error) {
+	if r == nil {
+		r = strings.NewReader(d.data)
+	}
+	ds := NewDataset()
+	type layout struct {
+		width, decimals int
+	}
+	layouts := make([]layout, len(d.Fields))
+	for k, f := range d.Fields {
+		width, decimals, str, err := infmt(f.Format)
+		if err != nil {
+			return nil, err
+		}
+		if f.Format != "" && str != isStrType(f.Type) {
+			return nil, fmt.Errorf("format %s does not match the type of %s", f.Format, f.Name)
+		}
+		layouts[k] = layout{width, decimals}
+		typ := f.Type
+		if typ == 0 {
+			typ = StataFloatId
+		}
+		v, err := ds.AddVar(f.Name, typ)
+		if err != nil {
+			return nil, err
+		}
+		v.Label, v.ValueLabel = f.Label, f.ValueLabel
+	}
+	nlines := max(d.Lines, 1)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	lineNo := 0
+	for lineNo < d.FirstLine-1 && sc.Scan() {
+		lineNo++
+	}
+	record := make([]string, nlines)
+	for obs := 0; ; obs++ {
+		n := 0
+		for ; n < nlines && sc.Scan(); n++ {
+			lineNo++
+			record[n] = strings.TrimSuffix(sc.Text(), "\r")
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return ds, nil
+		}
+		if n < nlines {
+			return nil, fmt.Errorf("line %d: observation %d has %d of %d lines", lineNo, obs+1, n, nlines)
+		}
+		ds.setObs(obs + 1)
+		pos, cur := 0, 1
+		for k, f := range d.Fields {
+			line := max(f.Line, 1)
+			if line > nlines {
+				return nil, fmt.Errorf("field %s on line %d of observations of %d lines", f.Name, line, nlines)
+			}
+			if line != cur {
+				pos, cur = 0, line
+			}
+			if f.Column > 0 {
+				pos = f.Column - 1
+			}
+			pos += f.Skip
+			text := record[line-1]
+			var field string
+			if w := layouts[k].width; w > 0 {
+				field = text[min(pos, len(text)):min(pos+w, len(text))]
+				pos += w
+			} else {
+				for pos < len(text) && (text[pos] == ' ' || text[pos] == '\t') {
+					pos++
+				}
+				end := pos
+				for end < len(text) && text[end] != ' ' && text[end] != '\t' {
+					end++
+				}
+				field, pos = text[pos:end], end
+			}
+			v := ds.vars[k]
+			field = strings.TrimSpace(field)
+			if v.IsString() {
+				v.strs[obs] = field[:min(len(field), int(v.typ))]
+				continue
+			}
+			if err := v.SetFloat(obs, parseFixedNumber(field, layouts[k].decimals)); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// parseFixedNumber parses a numeric field: blank and invalid fields are missing, and
+// fields without a decimal point are divided by 10^decimals.
+func parseFixedNumber(s string, decimals int) float64 {
+	if s == "" || s == "." {
+		return Missing
+	}
+	if len(s) == 2 && s[0] == '.' && s[1] >= 'a' && s[1] <= 'z' {
+		return ExtendedMissing(s[1])
+	}
+	x, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(x, 0) || math.IsNaN(x) {
+		return Missing
+	}
+	if decimals > 0 && !strings.ContainsAny(s, ".eE") {
+		x /= math.Pow10(decimals)
+	}
+	return x
+}
+
+// ExportFixedWidth writes ds to rawFile as fixed-width text and the matching dictionary
+// to dctFile.
+func (ds *Dataset) ExportFixedWidth(rawFile, dctFile string) error {
+	using, err := filepath.Rel(filepath.Dir(dctFile), rawFile)
+	if err != nil {
+		using = rawFile
+	}
+	d, err := NewDictionary(ds, filepath.ToSlash(using))
+	if err != nil {
+		return err
+	}
+	if err := writeFileWith(rawFile, func(w io.Writer) error { return d.WriteData(w, ds) }); err != nil {
+		return err
+	}
+	return writeFileWith(dctFile, func(w io.Writer) error {
+		_, err := d.WriteTo(w)
+		return err
+	})
+}
+
+// ImportDictionary reads the dictionary dctFile and the raw data it describes: the file
+// named by its using clause, relative to the dictionary, or the data following it.
+func ImportDictionary(dctFile string) (*Dataset, error) {
+	f, err := os.Open(dctFile)
+	if err != nil {
+		return nil, err
+	}
+	d, err := ParseDictionary(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dctFile, err)
+	}
+	if d.Using == "" {
+		return d.ReadData(nil)
+	}
+	rawFile := filepath.FromSlash(d.Using)
+	if !filepath.IsAbs(rawFile) {
+		rawFile = filepath.Join(filepath.Dir(dctFile), rawFile)
+	}
+	raw, err := os.Open(rawFile)
+	if err != nil {
+		return nil, err
+	}
+	defer raw.Close()
+	ds, err := d.ReadData(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rawFile, err)
+	}
+	return ds, nil
+}
@@ -0,0 +1,133 @@
+package gostata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportDictionary(t *testing.T) {
+	ds, err := ImportDictionary("testdata/dct/people.dct")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(ds.VarNames(), " "); got != "id name income sex score" {
+		t.Fatalf("variables %s", got)
+	}
+	if ds.NumObs() != 2 {
+		t.Fatalf("%d observations, want 2", ds.NumObs())
+	}
+	name, income, sex, score := ds.Var("name"), ds.Var("income"), ds.Var("sex"), ds.Var("score")
+	if name.TypeName() != "str12" || name.Str(0) != "Ann Smith" || name.Str(1) != "Bob" {
+		t.Errorf("name %s %q %q", name.TypeName(), name.Str(0), name.Str(1))
+	}
+	if income.Float(0) != 123456.78 || income.Float(1) != 1234.5 {
+		t.Errorf("income %v %v", income.Float(0), income.Float(1))
+	}
+	if sex.Float(0) != 2 || sex.Float(1) != 1 || sex.ValueLabel != "sexl" || sex.TypeName() != "byte" {
+		t.Errorf("sex %v %v %q", sex.Float(0), sex.Float(1), sex.ValueLabel)
+	}
+	if score.Float(0) != 3 || MissingCode(score.Float(1)) != 'a' || score.TypeName() != "float" {
+		t.Errorf("score %v %v", score.Float(0), score.Float(1))
+	}
+	if ds.Var("id").Label != "Identifier" || score.Label != "free format" {
+		t.Errorf("labels %q %q", ds.Var("id").Label, score.Label)
+	}
+}
+
+func TestParseDictionaryInlineData(t *testing.T) {
+	d, err := ParseDictionary(strings.NewReader(`dictionary
+{
+	str3 code %3s
+	_skip(1) x %4.1f
+}
+abc  123
+de   4.5
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := d.ReadData(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := ds.Var("x")
+	if ds.NumObs() != 2 || ds.Var("code").Str(1) != "de" || x.Float(0) != float64(float32(12.3)) || x.Float(1) != 4.5 {
+		t.Errorf("got %d observations, x = %v, %v", ds.NumObs(), x.Float(0), x.Float(1))
+	}
+}
+
+func TestParseDictionaryErrors(t *testing.T) {
+	for _, text := range []string{
+		"infile dictionary using a.raw\n  x %5f\n}\n",
+		"infile dictionary {\n  x %5f\n",
+		"infile dictionary {\n  str5 x %5f\n}\n",
+		"infile dictionary {\n  2x\n}\n",
+		"infile dictionary {\n  x %5q\n}\n",
+		"infile dictionary {\n  x \"label\" extra\n}\n",
+		"infile file {\n}\n",
+	} {
+		if _, err := ParseDictionary(strings.NewReader(text)); err == nil {
+			t.Errorf("ParseDictionary accepted %q", text)
+		}
+	}
+}
+
+func TestExportFixedWidth(t *testing.T) {
+	ds := companionDataset(t)
+	dir := t.TempDir()
+	raw, dct := filepath.Join(dir, "data", "survey.raw"), filepath.Join(dir, "survey.dct")
+	if err := os.MkdirAll(filepath.Dir(raw), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.ExportFixedWidth(raw, dct); err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDictionary(ds, "data/survey.raw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	if _, err := d.WriteTo(&sb); err != nil {
+		t.Fatal(err)
+	}
+	want := `infile dictionary using "data/survey.raw" {
+  _column(1)  long   ID        %1f "Respondent"
+  _column(3)  str5   zip       %5s ""
+  _column(9)  double score     %3f ""
+  _column(13) byte   yes:yesno %1f ""
+  _column(15) long   born      %2f ""
+}
+`
+	if got := sb.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	sb.Reset()
+	if err := d.WriteData(&sb, ds); err != nil {
+		t.Fatal(err)
+	}
+	wantData := "1 02134 0.1 1  1\n" +
+		"2         . 0  .\n" +
+		"3 x1     .a 1 -1\n"
+	if got := sb.String(); got != wantData {
+		t.Errorf("got\n%s\nwant\n%s", got, wantData)
+	}
+
+	back, err := ImportDictionary(dct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range ds.Vars() {
+		w := back.Var(v.Name)
+		if w == nil || w.Type() != v.Type() || w.Label != v.Label || w.ValueLabel != v.ValueLabel {
+			t.Errorf("variable %s not read back: %+v", v.Name, w)
+			continue
+		}
+		for i := 0; i < ds.NumObs(); i++ {
+			if w.Str(i) != v.Str(i) || w.Float(i) != v.Float(i) {
+				t.Errorf("%s[%d] = %q %v, want %q %v", v.Name, i, w.Str(i), w.Float(i), v.Str(i), v.Float(i))
+			}
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package gostata
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Coef is a row of an estimation table.
+type Coef struct {
+	Eq      string // equation, eg "Domestic" in mlogit output; empty for single-equation models
+	Name    string // eg "mpg", "_cons" or "2.rep78" for a level of a factor variable
+	Coef    float64
+	StdErr  float64
+	Stat    float64 // t or z statistic
+	P       float64
+	Lower   float64 // lower confidence limit
+	Upper   float64
+	Base    bool // base level of a factor variable; all values but Coef are missing
+	Omitted bool // omitted because of collinearity
+}
+
+// EstimationTable is the coefficient table and header statistics printed by estimation
+// commands such as regress, logit and poisson.
+type EstimationTable struct {
+	Command  string             // the command as echoed in the log, if any
+	Title    string             // eg "Logistic regression"; empty for regress
+	DepVar   string             // dependent variable
+	CoefName string             // heading of the first column, eg "Coef.", "Coefficient" or "Odds Ratio"
+	StatName string             // "t" or "z"
+	Level    float64            // confidence level, eg 95
+	Stats    map[string]float64 // header statistics as labelled, eg "Number of obs", "R-squared", "F(2, 71)"
+	Coefs    []Coef
+}
+
+// N returns the number of observations reported in the header, or -1 if there is none.
+func (t *EstimationTable) N() int {
+	if n, ok := t.Stats["Number of obs"]; ok {
+		return int(n)
+	}
+	return -1
+}
+
+// Coef returns the row for a coefficient. As in Stata, name may be "eq:name" to select an
+// equation; otherwise the first row with that name is returned.
+func (t *EstimationTable) Coef(name string) (Coef, bool) {
+	eq, name, hasEq := strings.Cut(name, ":")
+	if !hasEq {
+		name, eq = eq, ""
+	}
+	for _, c := range t.Coefs {
+		if c.Name == name && (!hasEq || c.Eq == eq) {
+			return c, true
+		}
+	}
+	return Coef{}, false
+}
+
+var (
+	dashLine     = regexp.MustCompile(`^-{20,}$`)
+	ruleLine     = regexp.MustCompile(`^-+\+-+$`)
+	headerStat   = regexp.MustCompile(`((?:[^\s=|]+ ?)+?)\s*=\s*(-?[0-9][0-9,]*\.?[0-9]*(?:e[+-]?[0-9]+)?|-?\.[0-9]+(?:e[+-]?[0-9]+)?|\.)`)
+	levelHeading = regexp.MustCompile(`\[(\d+(?:\.\d+)?)%`)
+	statHeading  = regexp.MustCompile(`\s(t|z)\s+P>\|(t|z)\|`)
+	titleGap     = regexp.MustCompile(`\s{3,}`)
+)
+
+// ParseEstimationTables returns the estimation tables found in a Stata log, in order.
+func ParseEstimationTables(log string) ([]*EstimationTable, error) {
+	lines := strings.Split(strings.ReplaceAll(log, "\r\n", "\n"), "\n")
+	var tables []*EstimationTable
+	var command string
+	headerStart := 0 // first line after the last command or table
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if cmd, ok := strings.CutPrefix(line, ". "); ok {
+			command = strings.TrimSpace(cmd)
+			for i+1 < len(lines) && strings.HasPrefix(lines[i+1], "> ") {
+				i++
+				command = strings.TrimSpace(strings.TrimSuffix(command, "///")) + " " + strings.TrimSpace(lines[i][2:])
+			}
+			headerStart = i + 1
+			continue
+		}
+		if !dashLine.MatchString(strings.TrimSpace(line)) {
+			continue
+		}
+		// the column headings follow the top rule, possibly after a line such as "Robust"
+		h := -1
+		for k := i + 1; k < len(lines) && k <= i+2; k++ {
+			if strings.Contains(lines[k], "P>|") {
+				h = k
+				break
+			}
+		}
+		if h < 0 {
+			continue
+		}
+		t := &EstimationTable{Command: command, Stats: make(map[string]float64)}
+		parseEstimationHeader(t, lines[headerStart:i])
+		if err := parseHeading(t, lines[h]); err != nil {
+			return nil, fmt.Errorf("line %d: %w", h+1, err)
+		}
+		end, err := parseCoefs(t, lines, h+1)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+		i, headerStart = end, end+1
+	}
+	return tables, nil
+}
+
+// parseEstimationHeader extracts the title and the "label = value" statistics printed
+// above the table.
+func parseEstimationHeader(t *EstimationTable, lines []string) {
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "Iteration ") {
+			continue
+		}
+		for _, m := range headerStat.FindAllStringSubmatch(line, -1) {
+			if x, err := parseTableNumber(m[2]); err == nil {
+				t.Stats[strings.TrimSpace(m[1])] = x
+			}
+		}
+		if t.Title == "" && line != "" && line[0] != ' ' {
+			left := strings.TrimSpace(titleGap.Split(strings.TrimSpace(line), 2)[0])
+			if left != "" && !strings.ContainsAny(left, "=|:") && left[0] != '-' {
+				t.Title = left
+			}
+		}
+	}
+}
+
+// parseHeading parses the column headings, eg
+//
+//	price | Coefficient  Std. err.      t    P>|t|     [95% conf. interval]
+func parseHeading(t *EstimationTable, line string) error {
+	left, right, ok := strings.Cut(line, "|")
+	if !ok {
+		return fmt.Errorf("invalid estimation table heading")
+	}
+	t.DepVar = strings.TrimSpace(left)
+	m := statHeading.FindStringSubmatch(right)
+	if m == nil {
+		return fmt.Errorf("invalid estimation table heading")
+	}
+	t.StatName = m[1]
+	if k := strings.Index(strings.ToLower(right), "std. err."); k > 0 {
+		t.CoefName = strings.TrimSpace(right[:k])
+	}
+	t.Level = 95
+	if m := levelHeading.FindStringSubmatch(right); m != nil {
+		t.Level, _ = strconv.ParseFloat(m[1], 64)
+	}
+	return nil
+}
+
+// parseCoefs parses the rows of the table starting at line start and returns the index of
+// the closing rule.
+func parseCoefs(t *EstimationTable, lines []string, start int) (int, error) {
+	var eq, factor string
+	for i := start; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if dashLine.MatchString(trimmed) {
+			return i, nil
+		}
+		if ruleLine.MatchString(trimmed) {
+			continue // rule below the headings or between equations
+		}
+		left, right, ok := strings.Cut(line, "|")
+		if !ok {
+			if trimmed == "" {
+				continue
+			}
+			return 0, fmt.Errorf("line %d: unexpected line in estimation table", i+1)
+		}
+		name := strings.TrimSpace(left)
+		fields := strings.Fields(right)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "(") {
+			// a left-aligned heading starts an equation, possibly a "(base outcome)",
+			// a right-aligned one a factor variable
+			if strings.HasPrefix(left, " ") {
+				factor = name
+			} else {
+				eq, factor = name, ""
+			}
+			continue
+		}
+		if factor != "" {
+			if _, err := strconv.Atoi(name); err == nil {
+				name += "." + factor
+			} else {
+				factor = ""
+			}
+		}
+		c := Coef{Eq: eq, Name: name, StdErr: Missing, Stat: Missing, P: Missing, Lower: Missing, Upper: Missing}
+		switch last := fields[len(fields)-1]; {
+		case last == "(base)":
+			c.Base = true
+		case last == "(omitted)" || last == "(empty)":
+			c.Omitted = true
+		case len(fields) != 6:
+			return 0, fmt.Errorf("line %d: expected 6 columns, found %d", i+1, len(fields))
+		}
+		values := []*float64{&c.Coef, &c.StdErr, &c.Stat, &c.P, &c.Lower, &c.Upper}
+		for k, f := range fields {
+			if f[0] == '(' {
+				break
+			}
+			x, err := parseTableNumber(f)
+			if err != nil {
+				return 0, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			*values[k] = x
+		}
+		t.Coefs = append(t.Coefs, c)
+	}
+	return 0, fmt.Errorf("estimation table not terminated")
+}
+
+// parseTableNumber parses a number as displayed by Stata, eg "-.467736", "1,234" or ".".
+func parseTableNumber(s string) (float64, error) {
+	if s == "." {
+		return Missing, nil
+	}
+	x, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", ""), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return x, nil
+}
@@ -0,0 +1,115 @@
+package gostata
+
+import (
+	"math"
+	"os"
+	"testing"
+)
+
+func readLog(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile("testdata/logs/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestParseEstimationTables(t *testing.T) {
+	tables, err := ParseEstimationTables(readLog(t, "regress.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 3 {
+		t.Fatalf("found %d tables, want 3", len(tables))
+	}
+
+	reg := tables[0]
+	if reg.Command != "regress price mpg weight" || reg.DepVar != "price" || reg.StatName != "t" || reg.Title != "" || reg.CoefName != "Coef." {
+		t.Errorf("unexpected regress table %+v", reg)
+	}
+	if reg.N() != 74 || reg.Stats["R-squared"] != 0.2934 || reg.Stats["F(2, 71)"] != 14.74 || reg.Stats["Root MSE"] != 2514 {
+		t.Errorf("unexpected regress statistics %v", reg.Stats)
+	}
+	want := Coef{Name: "weight", Coef: 1.746559, StdErr: .6413538, Stat: 2.72, P: 0.008, Lower: .467736, Upper: 3.025382}
+	if c, ok := reg.Coef("weight"); !ok || c != want {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+	if len(reg.Coefs) != 3 || reg.Coefs[2].Name != "_cons" {
+		t.Errorf("unexpected coefficients %+v", reg.Coefs)
+	}
+
+	logit := tables[1]
+	if logit.Command != "logit foreign mpg, nolog" || logit.Title != "Logistic regression" || logit.StatName != "z" {
+		t.Errorf("unexpected logit table %+v", logit)
+	}
+	if logit.Stats["Log likelihood"] != -39.28864 || logit.Stats["Pseudo R2"] != 0.1276 || logit.Stats["LR chi2(1)"] != 11.49 {
+		t.Errorf("unexpected logit statistics %v", logit.Stats)
+	}
+	if c, _ := logit.Coef("_cons"); c.Coef != -4.378866 || c.P != 0 {
+		t.Errorf("unexpected _cons %+v", c)
+	}
+
+	robust := tables[2]
+	if robust.Title != "Linear regression" || robust.Level != 90 || robust.CoefName != "Coefficient" || robust.N() != 69 {
+		t.Errorf("unexpected robust table %+v", robust)
+	}
+	names := []string{"2.rep78", "3.rep78", "4.rep78", "5.rep78", "_cons"}
+	if len(robust.Coefs) != len(names) {
+		t.Fatalf("unexpected coefficients %+v", robust.Coefs)
+	}
+	for i, name := range names {
+		if robust.Coefs[i].Name != name {
+			t.Errorf("row %d: got %s, want %s", i, robust.Coefs[i].Name, name)
+		}
+	}
+	if c := robust.Coefs[2]; c.Coef != 1507 || !IsMissing(c.StdErr) || !IsMissing(c.Upper) {
+		t.Errorf("unexpected missing row %+v", c)
+	}
+	if c := robust.Coefs[3]; !c.Omitted || c.Coef != 0 || !IsMissing(c.P) {
+		t.Errorf("unexpected omitted row %+v", c)
+	}
+}
+
+func TestParseEstimationTablesEquations(t *testing.T) {
+	tables, err := ParseEstimationTables(readLog(t, "mlogit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 1 {
+		t.Fatalf("found %d tables, want 1", len(tables))
+	}
+	tb := tables[0]
+	if tb.N() != 1069 || tb.Title != "Multinomial logistic regression" {
+		t.Errorf("unexpected table %+v", tb)
+	}
+	if len(tb.Coefs) != 4 {
+		t.Fatalf("unexpected coefficients %+v", tb.Coefs)
+	}
+	if c, ok := tb.Coef("High:mpg"); !ok || c.Eq != "High" || math.Abs(c.Coef-.1716839) > 1e-12 {
+		t.Errorf("High:mpg = %+v, %v", c, ok)
+	}
+	if c, _ := tb.Coef("mpg"); c.Eq != "Low" {
+		t.Errorf("mpg should match the first equation, got %+v", c)
+	}
+	if _, ok := tb.Coef("Average:mpg"); ok {
+		t.Error("base outcome has no coefficients")
+	}
+}
+
+func TestParseEstimationTablesErrors(t *testing.T) {
+	if tables, err := ParseEstimationTables("no tables here\n"); err != nil || len(tables) != 0 {
+		t.Errorf("got %v, %v", tables, err)
+	}
+	unterminated := "------------------------------------------------------------------------------\n" +
+		"       price |      Coef.   Std. Err.      t    P>|t|     [95% Conf. Interval]\n" +
+		"-------------+----------------------------------------------------------------\n" +
+		"         mpg |  -49.51222   86.15604    -0.57   0.567    -221.3025     122.278\n"
+	if _, err := ParseEstimationTables(unterminated); err == nil {
+		t.Error("expected an error for an unterminated table")
+	}
+	bad := unterminated + "      weight |   1.746559   .6413538\n" + "------------------------------------------------------------------------------\n"
+	if _, err := ParseEstimationTables(bad); err == nil {
+		t.Error("expected an error for a short row")
+	}
+}
@@ -0,0 +1,146 @@
+package gostata
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultFrame names the dataset in memory in Inputs and RunOptions.Outputs.
+const DefaultFrame = "default"
+
+// Inputs maps names to the datasets passed to a script by Run.
+type Inputs map[string]*Dataset
+
+// RunOptions modify Runner.Run. A nil *RunOptions uses the defaults.
+type RunOptions struct {
+	// Outputs names the datasets read back after the script: DefaultFrame for the data in
+	// memory and, if Frames is set, the names of other frames.
+	Outputs []string
+	// Frames loads each input into a frame of the same name and saves outputs from frames.
+	// It requires Stata 16 or later.
+	Frames bool
+	// Dir is the directory where the temporary directory holding the dta files is created;
+	// defaults to os.TempDir(). Stata runs in the temporary directory.
+	Dir string
+}
+
+// RunOutput is the result of Runner.Run.
+type RunOutput struct {
+	Datasets map[string]*Dataset // the outputs by name
+	Log      string
+}
+
+// Run runs script with the default runner (see DefaultRunner), passing inputs and reading
+// back outputs.
+func Run(ctx context.Context, script string, inputs Inputs, opts *RunOptions) (*RunOutput, error) {
+	return DefaultRunner().Run(ctx, script, inputs, opts)
+}
+
+// Run writes each input to a temporary dta file, runs script and reads back the outputs.
+// For each input the global macro of the same name holds the path of its file, so the script
+// can load it with use "$name", clear. The DefaultFrame input is loaded before the script
+// runs and, if opts.Frames is set, every other input is loaded into a frame of its name.
+// Outputs are saved after the script in format 115 (with saveold on Stata 13 or later),
+// which ReadFile reads. The temporary files are removed in all cases.
+func (r *Runner) Run(ctx context.Context, script string, inputs Inputs, opts *RunOptions) (*RunOutput, error) {
+	if opts == nil {
+		opts = &RunOptions{}
+	}
+	if err := checkExchangeNames(inputs, opts); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(opts.Dir, "gostata-run-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if dir, err = filepath.Abs(dir); err != nil {
+		return nil, err
+	}
+	for _, sub := range []string{"in", "out"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	inFile := func(name string) string { return filepath.Join(dir, "in", name+".dta") }
+	outFile := func(name string) string { return filepath.Join(dir, "out", name+".dta") }
+
+	var sb strings.Builder
+	w := func(format string, args ...any) { fmt.Fprintf(&sb, format+"\n", args...) }
+	names := make([]string, 0, len(inputs))
+	for name := range inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w("quietly {")
+	for _, name := range names {
+		if err := inputs[name].WriteFile(inFile(name)); err != nil {
+			return nil, fmt.Errorf("writing input %s: %w", name, err)
+		}
+		w("global %s `\"%s\"'", name, inFile(name))
+		switch {
+		case name == DefaultFrame:
+			w("use `\"%s\"', clear", inFile(name))
+		case opts.Frames:
+			w("capture frame drop %s", name)
+			w("frame create %s", name)
+			w("frame %s: use `\"%s\"', clear", name, inFile(name))
+		}
+	}
+	w("}")
+	w("%s", script)
+	w("quietly {")
+	for _, name := range opts.Outputs {
+		prefix := ""
+		if opts.Frames {
+			prefix = "frame " + name + ": "
+		}
+		w("if c(stata_version) >= 14 %ssaveold `\"%s\"', version(12) replace", prefix, outFile(name))
+		w("else if c(stata_version) >= 13 %ssaveold `\"%s\"', replace", prefix, outFile(name))
+		w("else %ssave `\"%s\"', replace", prefix, outFile(name))
+	}
+	w("}")
+
+	out, err := r.runDo(ctx, dir, sb.String())
+	if err != nil {
+		return nil, err
+	}
+	res := &RunOutput{Datasets: make(map[string]*Dataset, len(opts.Outputs)), Log: out}
+	for _, name := range opts.Outputs {
+		ds, err := ReadFile(outFile(name))
+		if err != nil {
+			return nil, fmt.Errorf("reading output %s: %w", name, err)
+		}
+		res.Datasets[name] = ds
+	}
+	return res, nil
+}
+
+func checkExchangeNames(inputs Inputs, opts *RunOptions) error {
+	for name, ds := range inputs {
+		if err := ValidateName(name); err != nil {
+			return fmt.Errorf("input: %w", err)
+		}
+		if ds == nil {
+			return fmt.Errorf("input %s is nil", name)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, name := range opts.Outputs {
+		if err := ValidateName(name); err != nil {
+			return fmt.Errorf("output: %w", err)
+		}
+		if seen[name] {
+			return fmt.Errorf("output %s specified more than once", name)
+		}
+		seen[name] = true
+		if name != DefaultFrame && !opts.Frames {
+			return fmt.Errorf("output %s: only the %s output can be read without frames", name, DefaultFrame)
+		}
+	}
+	return nil
+}
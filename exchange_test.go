@@ -0,0 +1,103 @@
+package gostata
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// exchangeFake returns a runner whose fake Stata keeps a copy of the do-file in $KEEP and
+// copies the default input to the default output, as a script that leaves the data unchanged.
+func exchangeFake(t *testing.T) (*Runner, string) {
+	exe := writeFakeStata(t, `base=$(basename "$3" .do)
+cp "$3" "$KEEP"
+in=$(grep -o '/[^"]*/in/default\.dta' "$3" | head -1)
+out=$(grep -o '/[^"]*/out/default\.dta' "$3" | head -1)
+[ -n "$out" ] && cp "$in" "$out"
+echo ". summarize" > "$base.log"
+`)
+	keep := filepath.Join(t.TempDir(), "kept.do")
+	r := NewRunner(exe)
+	r.Env = []string{"KEEP=" + keep}
+	return r, keep
+}
+
+func TestRunExchange(t *testing.T) {
+	r, keep := exchangeFake(t)
+	ds := NewDataset()
+	ds.AddNumeric("x", StataIntId, []float64{1, 2, 3})
+	ds.AddString("name", []string{"a", "b", "c"})
+	lookup := NewDataset()
+	lookup.AddNumeric("x", StataByteId, []float64{1})
+
+	dir := t.TempDir()
+	out, err := r.Run(context.Background(), "summarize", Inputs{DefaultFrame: ds, "lookup": lookup},
+		&RunOptions{Outputs: []string{DefaultFrame}, Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := out.Datasets[DefaultFrame]
+	if got == nil || got.NumObs() != 3 || got.Var("name").Str(2) != "c" || got.Var("x").Float(1) != 2 {
+		t.Errorf("unexpected output %v", got)
+	}
+	if !strings.Contains(out.Log, "summarize") {
+		t.Errorf("unexpected log %q", out.Log)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("temporary files left: %v", entries)
+	}
+
+	b, err := os.ReadFile(keep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	do := string(b)
+	for _, want := range []string{"global default `\"", "global lookup `\"", "/in/lookup.dta\"'", "use `\"", "\nsummarize\n", "saveold `\"", "version(12) replace"} {
+		if !strings.Contains(do, want) {
+			t.Errorf("do-file does not contain %q:\n%s", want, do)
+		}
+	}
+	if strings.Contains(do, "frame") {
+		t.Errorf("frames used without Frames:\n%s", do)
+	}
+}
+
+func TestRunExchangeFrames(t *testing.T) {
+	r, keep := exchangeFake(t)
+	ds := NewDataset()
+	ds.AddNumeric("x", StataIntId, []float64{1})
+	_, err := r.Run(context.Background(), "frame lookup: count", Inputs{"lookup": ds},
+		&RunOptions{Frames: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(keep)
+	if !strings.Contains(string(b), "frame create lookup") || !strings.Contains(string(b), "frame lookup: use `\"") {
+		t.Errorf("input not loaded into a frame:\n%s", b)
+	}
+}
+
+func TestRunExchangeErrors(t *testing.T) {
+	r, _ := exchangeFake(t)
+	ds := NewDataset()
+	tests := []struct {
+		name   string
+		inputs Inputs
+		opts   *RunOptions
+		want   string
+	}{
+		{"invalid input", Inputs{"1df": ds}, nil, "invalid name"},
+		{"nil input", Inputs{"df": nil}, nil, "input df is nil"},
+		{"frame output without frames", nil, &RunOptions{Outputs: []string{"result"}}, "only the default output"},
+		{"duplicate output", nil, &RunOptions{Outputs: []string{"r", "r"}, Frames: true}, "more than once"},
+		{"output not saved", nil, &RunOptions{Outputs: []string{"result"}, Frames: true}, "reading output result"},
+	}
+	for _, tt := range tests {
+		_, err := r.Run(context.Background(), "", tt.inputs, tt.opts)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
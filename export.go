@@ -0,0 +1,205 @@
+package gostata
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// MissingStyle selects how Export methods write missing values.
+type MissingStyle int
+
+const (
+	MissingEmpty MissingStyle = iota // empty field; "" in JSON
+	MissingDot                       // "." for all missing values
+	MissingNull                      // null in JSON; empty field in CSV and TSV
+	MissingCodes                     // ".", ".a" to ".z", keeping extended missing values apart
+)
+
+// ExportOptions modify ExportCSV, ExportTSV and ExportJSONL. A nil *ExportOptions uses the defaults.
+type ExportOptions struct {
+	Vars        []string     // variables to export, in this order; defaults to all
+	ValueLabels bool         // write the value labels of labelled values instead of the codes
+	DateLayout  string       // time layout of %td dates; defaults to 2006-01-02
+	ClockLayout string       // time layout of %tc datetimes; defaults to 2006-01-02T15:04:05.999
+	RawDates    bool         // write dates as Stata numbers, ignoring the layouts
+	Missing     MissingStyle // how to write missing values
+	NoHeader    bool         // omit the header row of CSV and TSV
+}
+
+// exporter formats the cells of a dataset.
+type exporter struct {
+	ds   *Dataset
+	vars []*Variable
+	opts *ExportOptions
+}
+
+func newExporter(ds *Dataset, opts *ExportOptions) (*exporter, error) {
+	if opts == nil {
+		opts = &ExportOptions{}
+	}
+	vars := ds.vars
+	if len(opts.Vars) > 0 {
+		var err error
+		if vars, err = ds.lookup(opts.Vars); err != nil {
+			return nil, err
+		}
+	}
+	return &exporter{ds: ds, vars: vars, opts: opts}, nil
+}
+
+// cell returns observation i of v as text, and whether it is a JSON string or null.
+func (e *exporter) cell(v *Variable, i int) (text string, quoted, null bool) {
+	if v.IsString() {
+		return v.strs[i], true, false
+	}
+	x := v.nums[i]
+	if code := MissingCode(x); code != 0 {
+		switch e.opts.Missing {
+		case MissingDot:
+			return ".", true, false
+		case MissingCodes:
+			if code == '.' {
+				return ".", true, false
+			}
+			return "." + string(code), true, false
+		case MissingNull:
+			return "", false, true
+		}
+		return "", true, false
+	}
+	if e.opts.ValueLabels && v.ValueLabel != "" && x == math.Trunc(x) && math.Abs(x) <= math.MaxInt32 {
+		if vl := e.ds.ValueLabel(v.ValueLabel); vl != nil {
+			if label, ok := vl.Label(int32(x)); ok {
+				return label, true, false
+			}
+		}
+	}
+	if !e.opts.RawDates {
+		switch {
+		case isDateFormat(v.Format):
+			layout := e.opts.DateLayout
+			if layout == "" {
+				layout = "2006-01-02"
+			}
+			return TimeFromStataDate(x).Format(layout), true, false
+		case strings.HasPrefix(v.Format, "%tc") || strings.HasPrefix(v.Format, "%tC"):
+			layout := e.opts.ClockLayout
+			if layout == "" {
+				layout = "2006-01-02T15:04:05.999"
+			}
+			return TimeFromStataClock(x).Format(layout), true, false
+		}
+	}
+	if v.typ == StataFloatId {
+		return strconv.FormatFloat(x, 'g', -1, 32), false, false
+	}
+	return strconv.FormatFloat(x, 'g', -1, 64), false, false
+}
+
+// ExportCSV writes the observations of ds to w as CSV, with a header of variable names.
+// By default numbers are written in full precision, dates in ISO 8601 and missing values
+// as empty fields.
+func (ds *Dataset) ExportCSV(w io.Writer, opts *ExportOptions) error {
+	return ds.exportDelimited(w, ',', opts)
+}
+
+// ExportTSV is ExportCSV with fields separated by tabs.
+func (ds *Dataset) ExportTSV(w io.Writer, opts *ExportOptions) error {
+	return ds.exportDelimited(w, '\t', opts)
+}
+
+func (ds *Dataset) exportDelimited(w io.Writer, comma rune, opts *ExportOptions) error {
+	e, err := newExporter(ds, opts)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	record := make([]string, len(e.vars))
+	if !e.opts.NoHeader {
+		for k, v := range e.vars {
+			record[k] = v.Name
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < ds.nobs; i++ {
+		for k, v := range e.vars {
+			record[k], _, _ = e.cell(v, i)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ExportJSONL writes the observations of ds to w as JSON Lines: an object per observation
+// with the variables as keys, in order. Numbers are JSON numbers; labels, dates and
+// missing values other than null are strings.
+func (ds *Dataset) ExportJSONL(w io.Writer, opts *ExportOptions) error {
+	e, err := newExporter(ds, opts)
+	if err != nil {
+		return err
+	}
+	keys := make([][]byte, len(e.vars))
+	for k, v := range e.vars {
+		keys[k], _ = json.Marshal(v.Name)
+	}
+	bw := bufio.NewWriter(w)
+	var line []byte
+	for i := 0; i < ds.nobs; i++ {
+		line = append(line[:0], '{')
+		for k, v := range e.vars {
+			if k > 0 {
+				line = append(line, ',')
+			}
+			line = append(append(line, keys[k]...), ':')
+			text, quoted, null := e.cell(v, i)
+			switch {
+			case null:
+				line = append(line, "null"...)
+			case quoted:
+				b, _ := json.Marshal(text)
+				line = append(line, b...)
+			default:
+				line = append(line, text...)
+			}
+		}
+		line = append(line, '}', '\n')
+		if _, err := bw.Write(line); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ExportFile reads the dta file dtaFile and writes it to outFile in the format given by
+// the extension of outFile: .csv, .tsv or .tab, or .jsonl or .ndjson.
+func ExportFile(dtaFile, outFile string, opts *ExportOptions) error {
+	var export func(ds *Dataset, w io.Writer, opts *ExportOptions) error
+	switch ext := strings.ToLower(filepath.Ext(outFile)); ext {
+	case ".csv":
+		export = (*Dataset).ExportCSV
+	case ".tsv", ".tab":
+		export = (*Dataset).ExportTSV
+	case ".jsonl", ".ndjson":
+		export = (*Dataset).ExportJSONL
+	default:
+		return fmt.Errorf("unknown export format %q", ext)
+	}
+	ds, err := ReadFile(dtaFile)
+	if err != nil {
+		return err
+	}
+	return writeFileWith(outFile, func(w io.Writer) error { return export(ds, w, opts) })
+}
@@ -0,0 +1,122 @@
+package gostata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportCSV(t *testing.T) {
+	ds := companionDataset(t)
+	var sb strings.Builder
+	if err := ds.ExportCSV(&sb, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := "ID,zip,score,yes,born\n" +
+		"1,02134,0.1,1,1960-01-02\n" +
+		"2,,,0,\n" +
+		"3,x1,,1,1959-12-31\n"
+	if got := sb.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExportTSVOptions(t *testing.T) {
+	ds := companionDataset(t)
+	var sb strings.Builder
+	err := ds.ExportTSV(&sb, &ExportOptions{
+		Vars:        []string{"born", "yes", "score"},
+		ValueLabels: true,
+		DateLayout:  "02Jan2006",
+		Missing:     MissingCodes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "born\tyes\tscore\n" +
+		"02Jan1960\tYes\t0.1\n" +
+		".\tNo\t.\n" +
+		"31Dec1959\tYes\t.a\n"
+	if got := sb.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	sb.Reset()
+	if err := ds.ExportTSV(&sb, &ExportOptions{Vars: []string{"born"}, RawDates: true, Missing: MissingDot, NoHeader: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := sb.String(); got != "1\n.\n-1\n" {
+		t.Errorf("raw dates: got %q", got)
+	}
+	if err := ds.ExportTSV(&sb, &ExportOptions{Vars: []string{"nosuch"}}); err == nil {
+		t.Error("unknown variable accepted")
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	ds := companionDataset(t)
+	stamp, err := ds.AddNumeric("stamp", StataDoubleId, []float64{
+		StataClock(time.Date(2024, 1, 31, 10, 30, 0, 250e6, time.UTC)), Missing, 0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stamp.Format = "%tcCCYY-NN-DD_HH:MM:SS.sss"
+	ds.Var("zip").SetStr(1, `say "hi"`)
+
+	tests := []struct {
+		opts *ExportOptions
+		want string
+	}{
+		{&ExportOptions{ValueLabels: true, Missing: MissingNull}, `{"ID":1,"zip":"02134","score":0.1,"yes":"Yes","born":"1960-01-02","stamp":"2024-01-31T10:30:00.25"}
+{"ID":2,"zip":"say \"hi\"","score":null,"yes":"No","born":null,"stamp":null}
+{"ID":3,"zip":"x1","score":null,"yes":"Yes","born":"1959-12-31","stamp":"1960-01-01T00:00:00"}
+`},
+		{&ExportOptions{Vars: []string{"score", "yes", "stamp"}, Missing: MissingDot, ClockLayout: time.Kitchen}, `{"score":0.1,"yes":1,"stamp":"10:30AM"}
+{"score":".","yes":0,"stamp":"."}
+{"score":".","yes":1,"stamp":"12:00AM"}
+`},
+		{&ExportOptions{Vars: []string{"score", "born"}}, `{"score":0.1,"born":"1960-01-02"}
+{"score":"","born":""}
+{"score":"","born":"1959-12-31"}
+`},
+		{&ExportOptions{Vars: []string{"score"}, Missing: MissingCodes}, `{"score":0.1}
+{"score":"."}
+{"score":".a"}
+`},
+	}
+	for _, tt := range tests {
+		var sb strings.Builder
+		if err := ds.ExportJSONL(&sb, tt.opts); err != nil {
+			t.Fatal(err)
+		}
+		if got := sb.String(); got != tt.want {
+			t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+		}
+	}
+}
+
+func TestExportFile(t *testing.T) {
+	dir := t.TempDir()
+	dta := filepath.Join(dir, "survey.dta")
+	if err := companionDataset(t).WriteFile(dta); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "survey.jsonl")
+	if err := ExportFile(dta, out, &ExportOptions{Vars: []string{"ID", "yes"}, ValueLabels: true}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "{\"ID\":1,\"yes\":\"Yes\"}\n{\"ID\":2,\"yes\":\"No\"}\n{\"ID\":3,\"yes\":\"Yes\"}\n"
+	if string(b) != want {
+		t.Errorf("got\n%s\nwant\n%s", b, want)
+	}
+	if err := ExportFile(dta, filepath.Join(dir, "survey.xml"), nil); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
@@ -0,0 +1,88 @@
+package gostata_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drgo/gostata"
+	"github.com/drgo/gostata/fakestata"
+)
+
+// TestMain lets the test binary act as Stata for the runners returned by fakestata.Runner.
+func TestMain(m *testing.M) {
+	fakestata.RunIfFake()
+	os.Exit(m.Run())
+}
+
+func writeSmall(t *testing.T, dir string) {
+	t.Helper()
+	ds := gostata.NewDataset()
+	ds.AddNumeric("x", gostata.StataIntId, []float64{1, 2, 3, 4})
+	if err := ds.WriteFile(filepath.Join(dir, "small.dta")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFakeRunScript(t *testing.T) {
+	dir := t.TempDir()
+	writeSmall(t, dir)
+	r := fakestata.Runner()
+	dict, err := r.RunScript(context.Background(), dir, "use small\ncount if x > 1\nnoi display \"N=\" r(N)\nsummarize x\nnoi display \"mean=\" r(mean)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dict["N"] != "3" || dict["mean"] != "2.5" {
+		t.Errorf("unexpected results %v", dict)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary files left: %v", entries)
+	}
+}
+
+func TestFakeRunStataDoError(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "job.do"), []byte("use missing, clear\n"), 0o644)
+	out, err := fakestata.Runner().RunDo(context.Background(), dir, "job.do")
+	var serr *gostata.StataError
+	if !errors.As(err, &serr) || serr.Code != 601 || serr.Command != "use missing, clear" {
+		t.Fatalf("expected r(601), got %v", err)
+	}
+	if !strings.Contains(out, "end of do-file") {
+		t.Errorf("unexpected log %q", out)
+	}
+}
+
+func TestFakeVersion(t *testing.T) {
+	version, err := fakestata.Runner().Version(context.Background())
+	if err != nil || version != "12" {
+		t.Errorf("got %q, %v", version, err)
+	}
+}
+
+func TestFakeSession(t *testing.T) {
+	dir := t.TempDir()
+	writeSmall(t, dir)
+	ctx := context.Background()
+	s, err := fakestata.Runner().StartSession(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Exec(ctx, "use small"); err != nil {
+		t.Fatal(err)
+	}
+	// the data stays loaded between commands
+	out, err := s.Exec(ctx, "count")
+	if err != nil || !strings.Contains(out, "\n  4\n") {
+		t.Errorf("got %q, %v", out, err)
+	}
+	_, err = s.Exec(ctx, "tabulate x")
+	var serr *gostata.StataError
+	if !errors.As(err, &serr) || serr.Code != 199 {
+		t.Errorf("expected r(199), got %v", err)
+	}
+}
@@ -0,0 +1,574 @@
+// Package fakestata is a stand-in for the Stata executable in tests. It interprets a small
+// subset of the Stata language against dta files read with gostata:
+//
+//	use, count, display, summarize, clear, exit, do
+//
+// with the quietly, noisily and capture prefixes, their { } blocks and comments.
+// Other commands fail with r(199), as unrecognized commands do in Stata.
+//
+// Like console Stata it runs a do-file in batch mode when one is named on the command line,
+// writing the log to <do-file base name>.log in the working directory, and otherwise reads
+// commands from stdin, so it can back both gostata.Runner and gostata.Session.
+//
+// It can be built as a program (see cmd/fakestata) and found through STATA_PATH, or a test
+// binary can act as Stata: call RunIfFake at the start of TestMain and use Runner.
+package fakestata
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/drgo/gostata"
+)
+
+// EnvVar is set to 1 in the environment of a test binary started by Runner.
+const EnvVar = "GOSTATA_FAKE_STATA"
+
+// Version is the value of c(stata_version).
+const Version = 12
+
+// RunIfFake runs the fake and exits if the process was started by a Runner returned by
+// Runner. Call it first in TestMain, before flags are parsed.
+func RunIfFake() {
+	if os.Getenv(EnvVar) == "1" {
+		os.Exit(Main(os.Args[1:], os.Stdin, os.Stdout))
+	}
+}
+
+// Runner returns a runner using the current executable, which must call RunIfFake, as Stata.
+func Runner() *gostata.Runner {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = os.Args[0]
+	}
+	r := gostata.NewRunner(exe)
+	r.Env = []string{EnvVar + "=1"}
+	return r
+}
+
+// Main runs the fake with the command-line arguments args, without the program name, and
+// returns the exit status.
+func Main(args []string, stdin io.Reader, stdout io.Writer) int {
+	var doFile string
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "-"), strings.HasPrefix(arg, "/") && len(arg) == 2:
+			// flags such as -q, -e, -b, /q and /e
+		case arg == "do" && doFile == "":
+		default:
+			doFile = arg
+		}
+	}
+	in := &interp{out: stdout}
+	if doFile == "" {
+		in.console(stdin)
+		return 0
+	}
+	base := filepath.Base(doFile)
+	log, err := os.Create(strings.TrimSuffix(base, filepath.Ext(base)) + ".log")
+	if err != nil {
+		fmt.Fprintln(stdout, err)
+		return 1
+	}
+	defer log.Close()
+	w := bufio.NewWriter(log)
+	defer w.Flush()
+	in.out = w
+	fmt.Fprintln(w)
+	if rc := in.do(doFile); rc != 0 {
+		fmt.Fprintf(w, "r(%d);\n", rc)
+	}
+	fmt.Fprintln(w)
+	return 0
+}
+
+// stataError is a failed command: the message is printed, followed by r(code);.
+type stataError struct {
+	code int
+	msg  string
+}
+
+func (e *stataError) Error() string { return e.msg }
+
+func errorf(code int, format string, args ...any) error {
+	return &stataError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// interp holds the state of the fake Stata.
+type interp struct {
+	out    io.Writer
+	ds     *gostata.Dataset
+	r      map[string]float64 // r() scalars of the last r-class command
+	rc     int                // _rc, set by capture
+	quiet  bool
+	depth  int // nesting of do-files
+	exited bool
+}
+
+// console reads commands from r until exit, echoing them after a dot prompt.
+func (in *interp) console(r io.Reader) {
+	sc := bufio.NewScanner(r)
+	for !in.exited && sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		fmt.Fprintf(in.out, ". %s\n", line)
+		if err := in.exec(line, false); err != nil {
+			in.printError(err)
+		}
+		fmt.Fprintln(in.out)
+	}
+}
+
+// do runs a do-file and returns the return code of the command that stopped it, or 0.
+func (in *interp) do(fileName string) int {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		in.printError(errorf(601, "file %s not found", fileName))
+		return 601
+	}
+	in.depth++
+	defer func() { in.depth-- }()
+	lines := joinContinued(strings.Split(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n"))
+	rc := in.block(lines, false, 0)
+	if !in.exited {
+		fmt.Fprintln(in.out, "\nend of do-file")
+	}
+	return rc
+}
+
+// block runs lines, echoing them; inside a { } block, they are numbered from 2.
+func (in *interp) block(lines []string, quiet bool, n int) int {
+	saved := in.quiet
+	defer func() { in.quiet = saved }()
+	for i := 0; i < len(lines) && !in.exited; i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "*") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		if n > 0 {
+			n++
+			fmt.Fprintf(in.out, "%3d. %s\n", n, line)
+		} else {
+			fmt.Fprintf(in.out, ". %s\n", line)
+		}
+		in.quiet = quiet
+		if prefix, ok := strings.CutSuffix(line, "{"); ok {
+			end := matchingBrace(lines, i+1)
+			if end < 0 {
+				in.printError(errorf(198, "unexpected end of file"))
+				return 198
+			}
+			rc := in.prefixed(prefix, func(quiet bool) int { return in.block(lines[i+1:end], quiet, max(n, 1)) })
+			if rc != 0 {
+				return rc
+			}
+			if n > 0 {
+				n += end - i
+			}
+			i = end
+			continue
+		}
+		if err := in.exec(line, quiet); err != nil {
+			in.printError(err)
+			if n == 0 {
+				fmt.Fprintln(in.out)
+			}
+			return returnCode(err)
+		}
+		if n == 0 {
+			fmt.Fprintln(in.out)
+		}
+	}
+	return 0
+}
+
+// prefixed runs body under the prefixes of a block command such as "capture noisily".
+func (in *interp) prefixed(prefix string, body func(quiet bool) int) int {
+	quiet, capture := in.quiet, false
+	for _, word := range strings.Fields(prefix) {
+		switch word {
+		case "quietly", "qui", "quietly:", "qui:":
+			quiet = true
+		case "noisily", "noi", "noisily:", "noi:":
+			quiet = false
+		case "capture", "cap", "capture:", "cap:":
+			capture = true
+		default:
+			in.printError(errorf(198, "{ not allowed after %s", word))
+			return 198
+		}
+	}
+	if capture {
+		saved := in.out
+		if quiet {
+			in.out = io.Discard
+		}
+		in.rc = body(quiet)
+		in.out = saved
+		return 0
+	}
+	return body(quiet)
+}
+
+// exec runs one command.
+func (in *interp) exec(line string, quiet bool) error {
+	cmd, rest := splitCommand(line)
+	switch cmd {
+	case "":
+		return nil
+	case "quietly", "qui":
+		return in.exec(rest, true)
+	case "noisily", "noi":
+		return in.exec(rest, false)
+	case "capture", "cap":
+		noisily := strings.HasPrefix(rest, "noi")
+		saved := in.out
+		if !noisily {
+			in.out = io.Discard
+		}
+		err := in.exec(rest, quiet)
+		in.out = saved
+		in.rc = 0
+		if err != nil {
+			if noisily {
+				in.printError(err)
+			}
+			in.rc = returnCode(err)
+		}
+		return nil
+	}
+	out := in.out
+	if quiet {
+		out = io.Discard
+	}
+	switch cmd {
+	case "use":
+		return in.use(rest)
+	case "clear":
+		in.ds, in.r = nil, nil
+		return nil
+	case "count":
+		return in.count(out, rest)
+	case "display", "di", "dis":
+		return in.display(out, rest)
+	case "summarize", "summ", "sum", "su":
+		return in.summarize(out, rest)
+	case "do":
+		fileName, _, err := parseFileName(rest)
+		if err != nil {
+			return err
+		}
+		if in.depth > 10 {
+			return errorf(1000, "do-files nested too deeply")
+		}
+		if rc := in.do(fileName); rc != 0 {
+			return &stataError{code: rc}
+		}
+		return nil
+	case "exit":
+		in.exited = true
+		return nil
+	}
+	return errorf(199, "command %s is unrecognized", cmd)
+}
+
+func (in *interp) printError(err error) {
+	if err.Error() != "" {
+		fmt.Fprintln(in.out, err)
+	}
+	fmt.Fprintf(in.out, "r(%d);\n", returnCode(err))
+}
+
+func returnCode(err error) int {
+	if e, ok := err.(*stataError); ok {
+		return e.code
+	}
+	return 198
+}
+
+func (in *interp) use(args string) error {
+	fileName, opts, err := parseFileName(args)
+	if err != nil {
+		return err
+	}
+	if opts != "" && opts != "clear" {
+		return errorf(198, "option %s not allowed", opts)
+	}
+	if filepath.Ext(fileName) == "" {
+		fileName += ".dta"
+	}
+	ds, err := gostata.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return errorf(601, "file %s not found", fileName)
+	}
+	if err != nil {
+		return errorf(610, "file %s not Stata format", fileName)
+	}
+	in.ds, in.r = ds, nil
+	return nil
+}
+
+func (in *interp) count(out io.Writer, args string) error {
+	if in.ds == nil {
+		in.ds = gostata.NewDataset()
+	}
+	n := 0
+	if args == "" {
+		n = in.ds.NumObs()
+	} else {
+		cond, ok := strings.CutPrefix(args, "if ")
+		if !ok {
+			return errorf(198, "invalid syntax")
+		}
+		keep, err := in.condition(strings.TrimSpace(cond))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < in.ds.NumObs(); i++ {
+			if keep(i) {
+				n++
+			}
+		}
+	}
+	in.r = map[string]float64{"N": float64(n)}
+	fmt.Fprintf(out, "  %s\n", formatNumber(float64(n)))
+	return nil
+}
+
+// condition parses "<var> <op> <number>" or "<var> <op> "<string>"".
+func (in *interp) condition(cond string) (func(i int) bool, error) {
+	for _, op := range []string{"==", "!=", ">=", "<=", ">", "<"} {
+		name, value, ok := strings.Cut(cond, op)
+		if !ok {
+			continue
+		}
+		v := in.ds.Var(strings.TrimSpace(name))
+		if v == nil {
+			return nil, errorf(111, "variable %s not found", strings.TrimSpace(name))
+		}
+		value = strings.TrimSpace(value)
+		if v.IsString() {
+			s, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, errorf(109, "type mismatch")
+			}
+			return func(i int) bool { return compare(strings.Compare(v.Str(i), s), op) }, nil
+		}
+		x, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			if value != "." {
+				return nil, errorf(109, "type mismatch")
+			}
+			x = gostata.Missing
+		}
+		return func(i int) bool {
+			y := v.Float(i)
+			switch {
+			case y < x:
+				return compare(-1, op)
+			case y > x:
+				return compare(1, op)
+			}
+			return compare(0, op)
+		}, nil
+	}
+	return nil, errorf(198, "invalid syntax")
+}
+
+func compare(c int, op string) bool {
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case ">=":
+		return c >= 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c < 0
+}
+
+// display prints quoted strings and the values of _N, _rc, r(name) and c(name).
+func (in *interp) display(out io.Writer, args string) error {
+	var sb strings.Builder
+	for args = strings.TrimSpace(args); args != ""; args = strings.TrimSpace(args) {
+		if args[0] == '"' {
+			end := strings.IndexByte(args[1:], '"')
+			if end < 0 {
+				return errorf(198, "invalid syntax")
+			}
+			sb.WriteString(args[1 : end+1])
+			args = args[end+2:]
+			continue
+		}
+		token := args
+		if i := strings.IndexAny(args, " \""); i >= 0 {
+			token = args[:i]
+		}
+		args = args[len(token):]
+		x, err := in.value(token)
+		if err != nil {
+			return err
+		}
+		sb.WriteString(formatNumber(x))
+	}
+	fmt.Fprintln(out, sb.String())
+	return nil
+}
+
+func (in *interp) value(token string) (float64, error) {
+	switch {
+	case token == "_N":
+		if in.ds == nil {
+			return 0, nil
+		}
+		return float64(in.ds.NumObs()), nil
+	case token == "_rc":
+		return float64(in.rc), nil
+	case strings.HasPrefix(token, "r(") && strings.HasSuffix(token, ")"):
+		if x, ok := in.r[token[2:len(token)-1]]; ok {
+			return x, nil
+		}
+		return gostata.Missing, nil
+	case token == "c(stata_version)", token == "c(version)":
+		return Version, nil
+	case token == "c(N)", token == "c(k)":
+		if in.ds == nil {
+			return 0, nil
+		}
+		if token == "c(N)" {
+			return float64(in.ds.NumObs()), nil
+		}
+		return float64(in.ds.NumVars()), nil
+	}
+	x, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return 0, errorf(198, "%s invalid name", token)
+	}
+	return x, nil
+}
+
+func (in *interp) summarize(out io.Writer, args string) error {
+	if in.ds == nil {
+		in.ds = gostata.NewDataset()
+	}
+	sums, err := in.ds.Summarize(strings.Fields(args)...)
+	if err != nil {
+		return errorf(111, "%v", err)
+	}
+	fmt.Fprintln(out, "\n    Variable |        Obs        Mean    Std. dev.       Min        Max")
+	fmt.Fprintln(out, "-------------+---------------------------------------------------------")
+	for _, s := range sums {
+		if s.N == 0 {
+			fmt.Fprintf(out, "%12s |%11d\n", s.Name, 0)
+		} else {
+			fmt.Fprintf(out, "%12s |%11d%12s%12s%11s%11s\n", s.Name, s.N,
+				formatNumber(s.Mean), formatNumber(s.SD), formatNumber(s.Min), formatNumber(s.Max))
+		}
+		in.r = map[string]float64{"N": float64(s.N), "sum_w": float64(s.N), "sum": s.Sum,
+			"mean": s.Mean, "sd": s.SD, "Var": s.SD * s.SD, "min": s.Min, "max": s.Max}
+	}
+	return nil
+}
+
+// formatNumber formats x like Stata's %9.0g format, roughly.
+func formatNumber(x float64) string {
+	if gostata.IsMissing(x) {
+		if code := gostata.MissingCode(x); code != '.' {
+			return "." + string(code)
+		}
+		return "."
+	}
+	if x == float64(int64(x)) && x < 1e9 && x > -1e9 {
+		return strconv.FormatInt(int64(x), 10)
+	}
+	s := strconv.FormatFloat(x, 'g', 8, 64)
+	if !strings.ContainsAny(s, "e") && strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	// Stata drops the leading zero of numbers between -1 and 1
+	if strings.HasPrefix(s, "0.") || strings.HasPrefix(s, "-0.") {
+		s = strings.Replace(s, "0.", ".", 1)
+	}
+	return s
+}
+
+// splitCommand returns the first word of line, without a trailing colon, and the rest.
+func splitCommand(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	i := strings.IndexAny(line, " ,\"")
+	if i < 0 {
+		return strings.TrimSuffix(line, ":"), ""
+	}
+	return strings.TrimSuffix(line[:i], ":"), strings.TrimSpace(line[i:])
+}
+
+// parseFileName parses a file name, possibly in simple or compound quotes, followed by
+// options after a comma.
+func parseFileName(args string) (fileName, opts string, err error) {
+	args = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(args), "using "))
+	switch {
+	case strings.HasPrefix(args, "`\""):
+		end := strings.Index(args, "\"'")
+		if end < 0 {
+			return "", "", errorf(198, "invalid syntax")
+		}
+		fileName, args = args[2:end], args[end+2:]
+	case strings.HasPrefix(args, "\""):
+		end := strings.IndexByte(args[1:], '"')
+		if end < 0 {
+			return "", "", errorf(198, "invalid syntax")
+		}
+		fileName, args = args[1:end+1], args[end+2:]
+	default:
+		fileName, args, _ = strings.Cut(args, ",")
+		fileName, args = strings.TrimSpace(fileName), ","+args
+	}
+	if fileName == "" {
+		return "", "", errorf(100, "filename required")
+	}
+	opts = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(args), ","))
+	return fileName, opts, nil
+}
+
+// joinContinued joins lines ending with /// to the next line.
+func joinContinued(lines []string) []string {
+	var out []string
+	cont := ""
+	for _, line := range lines {
+		if s, ok := strings.CutSuffix(strings.TrimRight(line, " \t"), "///"); ok {
+			cont += s + " "
+			continue
+		}
+		out = append(out, cont+line)
+		cont = ""
+	}
+	if cont != "" {
+		out = append(out, cont)
+	}
+	return out
+}
+
+// matchingBrace returns the index of the line closing the block opened before lines[start].
+func matchingBrace(lines []string, start int) int {
+	depth := 1
+	for i := start; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		switch {
+		case line == "}":
+			if depth--; depth == 0 {
+				return i
+			}
+		case strings.HasSuffix(line, "{"):
+			depth++
+		}
+	}
+	return -1
+}
@@ -0,0 +1,126 @@
+package fakestata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drgo/gostata"
+)
+
+func writeAuto(t *testing.T) string {
+	t.Helper()
+	ds := gostata.NewDataset()
+	ds.AddString("make", []string{"AMC Concord", "AMC Pacer", "Buick Century", "Buick Electra"})
+	ds.AddNumeric("price", gostata.StataIntId, []float64{4099, 4749, 4816, gostata.Missing})
+	ds.AddNumeric("mpg", gostata.StataByteId, []float64{22, 17, 20, 15})
+	fileName := filepath.Join(t.TempDir(), "auto.dta")
+	if err := ds.WriteFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func console(t *testing.T, commands string) string {
+	t.Helper()
+	var out strings.Builder
+	if rc := Main([]string{"-q"}, strings.NewReader(commands), &out); rc != 0 {
+		t.Fatalf("exit status %d", rc)
+	}
+	return out.String()
+}
+
+func TestConsole(t *testing.T) {
+	auto := writeAuto(t)
+	out := console(t, `use "`+auto+`", clear
+count
+count if mpg >= 20
+display "n=" r(N) " of " _N
+summarize price mpg
+display "mean=" r(mean)
+quietly summarize price
+display "price_n=" r(N) ";" c(stata_version)
+regress price mpg
+capture regress price mpg
+display "rc=" _rc
+exit, clear
+display "not reached"
+`)
+	for _, want := range []string{
+		"\n  4\n",
+		"\n  2\n",
+		"\nn=2 of 4\n",
+		"       price |          3   4554.6667",
+		"         mpg |          4        18.5",
+		"\nmean=18.5\n",
+		"\nprice_n=3;12\n",
+		"command regress is unrecognized\nr(199);\n",
+		"\nrc=199\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "not reached\n\n") || strings.Count(out, "Variable |") != 1 {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestConsoleDo(t *testing.T) {
+	auto := writeAuto(t)
+	doFile := filepath.Join(t.TempDir(), "job.do")
+	os.WriteFile(doFile, []byte(`use "`+auto+`"
+qui {
+	count
+	noi display "N=" r(N)
+	use nofile
+	display "skipped"
+}
+`), 0o644)
+	out := console(t, "capture noisily do `\""+doFile+"\"'\ndisplay \"done \" _rc\n")
+	for _, want := range []string{
+		"\nN=4\n",
+		"  4. use nofile\nfile nofile.dta not found\nr(601);\n",
+		"end of do-file\nr(601);\n",
+		"\ndone 601\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "\nskipped") || strings.Contains(out, "\n  4\n") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if e := gostata.ParseLogError(out); e == nil || e.Code != 601 || e.Command != "use nofile" {
+		t.Errorf("ParseLogError = %+v", e)
+	}
+}
+
+func TestSplitAndParse(t *testing.T) {
+	if cmd, rest := splitCommand(`di"x"`); cmd != "di" || rest != `"x"` {
+		t.Errorf("got %q, %q", cmd, rest)
+	}
+	if cmd, rest := splitCommand("qui: count"); cmd != "qui" || rest != "count" {
+		t.Errorf("got %q, %q", cmd, rest)
+	}
+	for in, want := range map[string][2]string{
+		`"my file.dta", clear`: {"my file.dta", "clear"},
+		"`\"a.dta\"'":          {"a.dta", ""},
+		"using b , clear":      {"b", "clear"},
+	} {
+		f, opts, err := parseFileName(in)
+		if err != nil || f != want[0] || opts != want[1] {
+			t.Errorf("%s: got %q, %q, %v", in, f, opts, err)
+		}
+	}
+	if got := joinContinued([]string{"count ///", "if x", "y"}); len(got) != 2 || got[0] != "count  if x" {
+		t.Errorf("got %q", got)
+	}
+	for x, want := range map[float64]string{74: "74", 0.25: ".25", 6165.256756: "6165.2568", gostata.Missing: ".", -1.5: "-1.5",
+		10.5: "10.5", 100.25: "100.25", -0.5: "-.5", 1.05: "1.05", 2e-10: "2e-10"} {
+		if got := formatNumber(x); got != want {
+			t.Errorf("formatNumber(%v) = %s, want %s", x, got, want)
+		}
+	}
+}
@@ -10,11 +10,12 @@ import (
 
 // Field holds the extracted information for a struct field.
 type Field struct {
-	Name      string      // Name from tag "name" or lowercase field name.
-	FieldType byte        // Byte code representing the Stata type.
-	Label     string      // From tag "label" or defaults to Name.
-	Format    string      // Optional format string.
-	data      interface{} // The field’s value.
+	Name       string      // Name from tag "name" or lowercase field name.
+	FieldType  byte        // Byte code representing the Stata type.
+	Label      string      // From tag "label" or defaults to Name.
+	Format     string      // Optional format string.
+	ValueLabel string      // Name of the value label attached to the field, if any.
+	data       interface{} // The field’s value.
 }
 
 // parseStataTag splits a tag string into a map.
@@ -0,0 +1,161 @@
+package gostata
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Matrix is a Stata matrix. Data holds the cells in row-major order, so a gonum matrix can
+// be built with mat.NewDense(m.Rows, m.Cols, m.Data). Missing cells hold Stata missing
+// values (see IsMissing); use WithNaN to replace them by NaN.
+type Matrix struct {
+	Name     string
+	Rows     int
+	Cols     int
+	RowNames []string // full names, eg "price:mpg", or "r1" ... if the matrix has none
+	ColNames []string
+	Data     []float64
+}
+
+// Dims returns the number of rows and columns.
+func (m *Matrix) Dims() (r, c int) {
+	return m.Rows, m.Cols
+}
+
+// At returns the cell in row i and column j, counting from 0.
+func (m *Matrix) At(i, j int) float64 {
+	if i < 0 || i >= m.Rows || j < 0 || j >= m.Cols {
+		panic(fmt.Sprintf("matrix %s: index (%d, %d) out of range", m.Name, i, j))
+	}
+	return m.Data[i*m.Cols+j]
+}
+
+// Row returns a copy of row i.
+func (m *Matrix) Row(i int) []float64 {
+	if i < 0 || i >= m.Rows {
+		panic(fmt.Sprintf("matrix %s: row %d out of range", m.Name, i))
+	}
+	return append([]float64(nil), m.Data[i*m.Cols:(i+1)*m.Cols]...)
+}
+
+// Col returns a copy of column j.
+func (m *Matrix) Col(j int) []float64 {
+	col := make([]float64, m.Rows)
+	for i := range col {
+		col[i] = m.At(i, j)
+	}
+	return col
+}
+
+// Slice returns the cells as a slice of rows.
+func (m *Matrix) Slice() [][]float64 {
+	rows := make([][]float64, m.Rows)
+	for i := range rows {
+		rows[i] = m.Row(i)
+	}
+	return rows
+}
+
+// Get returns the cell in the named row and column. A name matches a full name such as
+// "price:mpg" or, if no other row (or column) has the same name, the part after the
+// equation name, eg "mpg".
+func (m *Matrix) Get(row, col string) (float64, bool) {
+	i, j := nameIndex(m.RowNames, row), nameIndex(m.ColNames, col)
+	if i < 0 || j < 0 {
+		return 0, false
+	}
+	return m.At(i, j), true
+}
+
+func nameIndex(names []string, name string) int {
+	found := -1
+	for i, full := range names {
+		if full == name {
+			return i
+		}
+		if _, short, ok := strings.Cut(full, ":"); ok && short == name {
+			if found >= 0 {
+				return -1 // ambiguous
+			}
+			found = i
+		}
+	}
+	return found
+}
+
+// HasMissing reports whether any cell is missing.
+func (m *Matrix) HasMissing() bool {
+	for _, x := range m.Data {
+		if IsMissing(x) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithNaN returns a copy of m with missing cells replaced by NaN.
+func (m *Matrix) WithNaN() *Matrix {
+	c := *m
+	c.RowNames = append([]string(nil), m.RowNames...)
+	c.ColNames = append([]string(nil), m.ColNames...)
+	c.Data = make([]float64, len(m.Data))
+	for k, x := range m.Data {
+		if IsMissing(x) {
+			x = math.NaN()
+		}
+		c.Data[k] = x
+	}
+	return &c
+}
+
+// RunMatrices runs script with the default runner (see DefaultRunner) and exports the
+// named matrices.
+func RunMatrices(ctx context.Context, workDir, script string, names ...string) (map[string]*Matrix, error) {
+	return DefaultRunner().RunMatrices(ctx, workDir, script, names...)
+}
+
+// RunMatrices runs script and exports the named matrices, which may be stored results such
+// as "e(b)", "e(V)" and "r(table)" or matrices defined by the script. The result is keyed
+// by the names as given. It is an error if a matrix does not exist.
+func (r *Runner) RunMatrices(ctx context.Context, workDir, script string, names ...string) (map[string]*Matrix, error) {
+	for _, name := range names {
+		if name == "" || strings.ContainsAny(name, "\"`'\t\n") {
+			return nil, fmt.Errorf("invalid matrix name %q", name)
+		}
+	}
+	res, err := r.runCollect(ctx, workDir, script, func(w codeWriter) {
+		for _, name := range names {
+			matrixCode(w, "", name, name)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if _, ok := res.named.Matrices[name]; !ok {
+			return nil, fmt.Errorf("matrix %s not found", name)
+		}
+	}
+	return res.named.Matrices, nil
+}
+
+// matrixCode writes the code writing the matrix src to the results file `fh' under the
+// given class and name, which may be Stata macro references. It uses the temporary matrix `m'.
+func matrixCode(w codeWriter, class, name, src string) {
+	w("capture matrix `m' = %s", src)
+	w("if _rc == 0 {")
+	w("  local rn : rowfullnames `m'")
+	w("  local cn : colfullnames `m'")
+	w("  file write `fh' \"M\" _tab \"%s\" _tab \"%s\" _tab (rowsof(`m')) _tab (colsof(`m')) _n", class, name)
+	w("  file write `fh' \"Mr\" _tab `\"`rn'\"' _n \"Mc\" _tab `\"`cn'\"' _n")
+	w("  forvalues i = 1/`=rowsof(`m')' {")
+	w("    file write `fh' \"Mv\"")
+	w("    forvalues j = 1/`=colsof(`m')' {")
+	w("      file write `fh' _tab %%21x (`m'[`i', `j'])")
+	w("    }")
+	w("    file write `fh' _n")
+	w("  }")
+	w("}")
+}
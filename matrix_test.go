@@ -0,0 +1,88 @@
+package gostata
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testMatrix() *Matrix {
+	return &Matrix{
+		Name:     "e(V)",
+		Rows:     3,
+		Cols:     3,
+		RowNames: []string{"price:mpg", "price:_cons", "weight:mpg"},
+		ColNames: []string{"price:mpg", "price:_cons", "weight:mpg"},
+		Data:     []float64{1, 2, 3, 4, 5, Missing, 7, ExtendedMissing('a'), 9},
+	}
+}
+
+func TestMatrixAccess(t *testing.T) {
+	m := testMatrix()
+	if r, c := m.Dims(); r != 3 || c != 3 {
+		t.Errorf("Dims = %d, %d", r, c)
+	}
+	if got := m.Row(1); !reflect.DeepEqual(got[:2], []float64{4, 5}) || !IsMissing(got[2]) {
+		t.Errorf("Row(1) = %v", got)
+	}
+	if got := m.Col(0); !reflect.DeepEqual(got, []float64{1, 4, 7}) {
+		t.Errorf("Col(0) = %v", got)
+	}
+	if got := m.Slice(); len(got) != 3 || got[2][2] != 9 {
+		t.Errorf("Slice = %v", got)
+	}
+	if x, ok := m.Get("price:_cons", "_cons"); !ok || x != 5 {
+		t.Errorf("Get(price:_cons, _cons) = %v, %v", x, ok)
+	}
+	if _, ok := m.Get("mpg", "_cons"); ok {
+		t.Error("ambiguous row name mpg accepted")
+	}
+	if _, ok := m.Get("price:mpg", "foreign"); ok {
+		t.Error("unknown column accepted")
+	}
+	if !m.HasMissing() {
+		t.Error("HasMissing = false")
+	}
+	n := m.WithNaN()
+	if !math.IsNaN(n.At(1, 2)) || !math.IsNaN(n.At(2, 1)) || n.At(2, 2) != 9 {
+		t.Errorf("WithNaN = %v", n.Data)
+	}
+	if !IsMissing(m.At(1, 2)) {
+		t.Error("WithNaN modified the original")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("At out of range did not panic")
+		}
+	}()
+	m.At(3, 0)
+}
+
+func TestRunMatrices(t *testing.T) {
+	exe := writeFakeStata(t, `base=$(basename "$3" .do)
+out=$(grep -o 'results-[0-9]*\.txt' "$3" | head -1)
+printf 'M\t\te(b)\t1\t2\nMr\ty1\nMc\tmpg _cons\nMv\t-1.0000000000000X+001\t+1.8000000000000X+001\n' > "$out"
+touch "$base.log"
+`)
+	r := NewRunner(exe)
+	ms, err := r.RunMatrices(context.Background(), t.TempDir(), "regress price mpg", "e(b)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := ms["e(b)"]
+	if b == nil || b.Name != "e(b)" || !reflect.DeepEqual(b.Data, []float64{-2, 3}) {
+		t.Fatalf("unexpected e(b) %+v", b)
+	}
+	if x, _ := b.Get("y1", "_cons"); x != 3 {
+		t.Errorf("_cons = %v", x)
+	}
+	_, err = r.RunMatrices(context.Background(), t.TempDir(), "regress price mpg", "e(b)", "e(V)")
+	if err == nil || !strings.Contains(err.Error(), "matrix e(V) not found") {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+	if _, err = r.RunMatrices(context.Background(), t.TempDir(), "", "bad`name"); err == nil {
+		t.Error("invalid name accepted")
+	}
+}
@@ -0,0 +1,168 @@
+package gostata
+
+import "math"
+
+// Missing values in dta formats 113 and later.
+// Each storage type reserves the 27 largest values of its range for the system missing value (.)
+// followed by the extended missing values .a to .z. Values above the Max constants are missing.
+//
+//	type      max valid           .                    .a
+//	---------------------------------------------------------------------
+//	byte      100                 101                  102
+//	int       32740               32741                32742
+//	long      2147483620          2147483621           2147483622
+//	float     0x7effffff          0x7f000000           0x7f000800
+//	double    0x7fdfffffffffffff  0x7fe0000000000000   0x7fe0010000000000
+const (
+	DtaMaxByte  = 100
+	DtaMaxInt   = 32740
+	DtaMaxLong  = 2147483620
+	DtaMinByte  = -127
+	DtaMinInt   = -32767
+	DtaMinLong  = -2147483647
+	dtaNumCodes = 27 // ., .a, ..., .z
+
+	dtaMissingByte   = 101
+	dtaMissingInt    = 32741
+	dtaMissingLong   = 2147483621
+	dtaMissingFloat  = 0x7f000000
+	dtaMissingDouble = 0x7fe0000000000000
+	dtaMaxFloatBits  = 0x7effffff
+	dtaMaxDoubleBits = 0x7fdfffffffffffff
+	dtaFloatStep     = 0x800
+	dtaDoubleStep    = 0x10000000000
+)
+
+var (
+	// Missing is Stata's system missing value (.) as stored in a double.
+	// Like in Stata, it compares greater than any nonmissing value.
+	Missing = math.Float64frombits(dtaMissingDouble)
+
+	DtaMaxFloat  = float64(math.Float32frombits(dtaMaxFloatBits))
+	DtaMaxDouble = math.Float64frombits(dtaMaxDoubleBits)
+)
+
+// ExtendedMissing returns the extended missing value .a to .z for code 'a' to 'z'.
+// Any other code returns the system missing value.
+func ExtendedMissing(code byte) float64 {
+	if code < 'a' || code > 'z' {
+		return Missing
+	}
+	return missingAt(int(code-'a') + 1)
+}
+
+// IsMissing reports whether x is one of Stata's missing values.
+// NaN and infinities cannot be stored in a dta file and are treated as missing too.
+func IsMissing(x float64) bool {
+	return x != x || x > DtaMaxDouble || x < -DtaMaxDouble
+}
+
+// MissingCode returns '.' for the system missing value, 'a' to 'z' for extended
+// missing values and 0 for nonmissing values.
+func MissingCode(x float64) byte {
+	if !IsMissing(x) {
+		return 0
+	}
+	k := missingIndex(x)
+	if k == 0 {
+		return '.'
+	}
+	return byte('a' + k - 1)
+}
+
+// missingAt returns the missing value with index k, where 0 is . and 26 is .z
+func missingAt(k int) float64 {
+	return math.Float64frombits(dtaMissingDouble + uint64(k)*dtaDoubleStep)
+}
+
+// missingIndex returns the index (0 for ., 1-26 for .a-.z) of missing value x.
+// Non-canonical missing values are mapped to the nearest lower code.
+func missingIndex(x float64) int {
+	bits := math.Float64bits(x)
+	if x != x || bits < dtaMissingDouble || bits > math.Float64bits(math.MaxFloat64) {
+		return 0
+	}
+	k := int((bits - dtaMissingDouble) / dtaDoubleStep)
+	if k >= dtaNumCodes {
+		k = dtaNumCodes - 1
+	}
+	return k
+}
+
+// The functions below convert between the double representation used by Dataset
+// and the on-disk representation of each storage type.
+
+func decodeByte(v int8) float64 {
+	if v > DtaMaxByte {
+		return missingAt(int(v) - dtaMissingByte)
+	}
+	return float64(v)
+}
+
+func encodeByte(x float64) int8 {
+	if IsMissing(x) {
+		return int8(dtaMissingByte + missingIndex(x))
+	}
+	return int8(x)
+}
+
+func decodeInt(v int16) float64 {
+	if v > DtaMaxInt {
+		return missingAt(int(v) - dtaMissingInt)
+	}
+	return float64(v)
+}
+
+func encodeInt(x float64) int16 {
+	if IsMissing(x) {
+		return int16(dtaMissingInt + missingIndex(x))
+	}
+	return int16(x)
+}
+
+func decodeLong(v int32) float64 {
+	if v > DtaMaxLong {
+		return missingAt(int(v) - dtaMissingLong)
+	}
+	return float64(v)
+}
+
+func encodeLong(x float64) int32 {
+	if IsMissing(x) {
+		return int32(dtaMissingLong + missingIndex(x))
+	}
+	return int32(x)
+}
+
+func decodeFloat(v float32) float64 {
+	bits := math.Float32bits(v)
+	if bits > dtaMaxFloatBits && bits < 0x80000000 {
+		k := int((bits - dtaMissingFloat) / dtaFloatStep)
+		if bits < dtaMissingFloat || k >= dtaNumCodes {
+			k = 0
+		}
+		return missingAt(k)
+	}
+	return float64(v)
+}
+
+func encodeFloat(x float64) float32 {
+	if IsMissing(x) {
+		return math.Float32frombits(dtaMissingFloat + uint32(missingIndex(x))*dtaFloatStep)
+	}
+	return float32(x)
+}
+
+func decodeDouble(v float64) float64 {
+	if IsMissing(v) {
+		return missingAt(missingIndex(v))
+	}
+	return v
+}
+
+func encodeDouble(x float64) float64 {
+	if IsMissing(x) {
+		return missingAt(missingIndex(x))
+	}
+	return x
+}
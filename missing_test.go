@@ -0,0 +1,58 @@
+package gostata
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMissingCodes(t *testing.T) {
+	if !IsMissing(Missing) || MissingCode(Missing) != '.' {
+		t.Errorf("Missing is not the system missing value")
+	}
+	for code := byte('a'); code <= 'z'; code++ {
+		x := ExtendedMissing(code)
+		if !IsMissing(x) {
+			t.Errorf(".%c is not missing", code)
+		}
+		if got := MissingCode(x); got != code {
+			t.Errorf("MissingCode(.%c)=%c", code, got)
+		}
+		if x <= Missing {
+			t.Errorf(".%c should sort after .", code)
+		}
+	}
+	for _, x := range []float64{0, -1, DtaMaxDouble, -DtaMaxDouble} {
+		if IsMissing(x) {
+			t.Errorf("%v should not be missing", x)
+		}
+	}
+	if !IsMissing(math.NaN()) || !IsMissing(math.Inf(1)) {
+		t.Errorf("NaN and Inf should be missing")
+	}
+}
+
+func TestMissingEncoding(t *testing.T) {
+	for _, x := range []float64{Missing, ExtendedMissing('a'), ExtendedMissing('z')} {
+		if got := decodeByte(encodeByte(x)); got != x {
+			t.Errorf("byte: expected %v, got %v", MissingCode(x), MissingCode(got))
+		}
+		if got := decodeInt(encodeInt(x)); got != x {
+			t.Errorf("int: expected %v, got %v", MissingCode(x), MissingCode(got))
+		}
+		if got := decodeLong(encodeLong(x)); got != x {
+			t.Errorf("long: expected %v, got %v", MissingCode(x), MissingCode(got))
+		}
+		if got := decodeFloat(encodeFloat(x)); got != x {
+			t.Errorf("float: expected %v, got %v", MissingCode(x), MissingCode(got))
+		}
+		if got := decodeDouble(encodeDouble(x)); got != x {
+			t.Errorf("double: expected %v, got %v", MissingCode(x), MissingCode(got))
+		}
+	}
+	if encodeByte(Missing) != 101 || encodeInt(ExtendedMissing('a')) != 32742 || encodeLong(ExtendedMissing('z')) != 2147483647 {
+		t.Errorf("wrong integer missing encodings")
+	}
+	if math.Float32bits(encodeFloat(ExtendedMissing('a'))) != 0x7f000800 {
+		t.Errorf("wrong float encoding of .a")
+	}
+}
@@ -0,0 +1,209 @@
+package gostata
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrPoolClosed is returned by Pool.Do after the pool was closed.
+var ErrPoolClosed = errors.New("stata pool closed")
+
+// DefaultReset is the Stata code run on a session between jobs: it drops data, frames,
+// programs, matrices, stored results and macros so a job does not see the state of another.
+const DefaultReset = "clear all\nmacro drop _all"
+
+// PoolOptions modify Runner.NewPool. A nil *PoolOptions uses the defaults.
+type PoolOptions struct {
+	MaxSessions int    // most Stata processes open at once; defaults to 1
+	Reset       string // commands run after each job; defaults to DefaultReset
+	WorkDir     string // passed to StartSession
+}
+
+// PoolStats are counters describing a pool.
+type PoolStats struct {
+	Open      int           // sessions open, idle or in use
+	Idle      int           // sessions waiting for a job
+	Waiting   int           // jobs waiting for a session
+	Started   int           // sessions started since the pool was created
+	Discarded int           // sessions closed because they failed or could not be reset
+	Jobs      int           // jobs completed, successfully or not
+	Failed    int           // jobs that returned an error
+	Abandoned int           // jobs whose context ended while waiting for a session
+	WaitTime  time.Duration // total time jobs waited for a session, including abandoned ones
+	MaxWait   time.Duration // longest time a job waited for a session
+}
+
+// Pool runs jobs on a bounded number of Stata sessions, starting them when needed and
+// reusing them between jobs. It is safe for use by multiple goroutines.
+type Pool struct {
+	runner *Runner
+	opts   PoolOptions
+	sem    chan struct{} // holds a token per session in use or being started
+	mu     sync.Mutex
+	idle   []*Session
+	stats  PoolStats
+	closed bool
+}
+
+// NewPool returns a pool of sessions of r. No session is started until a job needs one.
+func (r *Runner) NewPool(opts *PoolOptions) *Pool {
+	p := &Pool{runner: r}
+	if opts != nil {
+		p.opts = *opts
+	}
+	if p.opts.MaxSessions < 1 {
+		p.opts.MaxSessions = 1
+	}
+	if p.opts.Reset == "" {
+		p.opts.Reset = DefaultReset
+	}
+	p.sem = make(chan struct{}, p.opts.MaxSessions)
+	return p
+}
+
+// Do runs job on a session, waiting for one to be free if MaxSessions are in use.
+// After the job the session is reset and returned to the pool; it is discarded instead if
+// the reset fails or the session was closed, eg because the job's context expired.
+// If job panics, the session is discarded and its slot freed before the panic goes on.
+func (p *Pool) Do(ctx context.Context, job func(s *Session) error) error {
+	s, err := p.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	finished := false
+	defer func() {
+		if !finished {
+			// the job may have left a command half run: count it failed and do not reuse s
+			s.Close()
+			p.release(s, errJobPanicked)
+		}
+	}()
+	err = job(s)
+	finished = true
+	p.release(s, err)
+	return err
+}
+
+// errJobPanicked stands for the error of a job that panicked in Pool.Do.
+var errJobPanicked = errors.New("stata pool job panicked")
+
+// Exec runs commands on a session of the pool; see Session.Exec.
+func (p *Pool) Exec(ctx context.Context, commands string) (output string, err error) {
+	err = p.Do(ctx, func(s *Session) error {
+		output, err = s.Exec(ctx, commands)
+		return err
+	})
+	return output, err
+}
+
+func (p *Pool) acquire(ctx context.Context) (*Session, error) {
+	start := time.Now()
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+	p.stats.Waiting++
+	p.mu.Unlock()
+
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		p.mu.Lock()
+		p.waited(start)
+		p.stats.Abandoned++
+		p.mu.Unlock()
+		return nil, contextError(ctx.Err())
+	}
+
+	p.mu.Lock()
+	p.waited(start)
+	if p.closed {
+		p.mu.Unlock()
+		<-p.sem
+		return nil, ErrPoolClosed
+	}
+	if n := len(p.idle); n > 0 {
+		s := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return s, nil
+	}
+	p.mu.Unlock()
+
+	s, err := p.runner.StartSession(context.Background(), p.opts.WorkDir)
+	if err != nil {
+		<-p.sem
+		return nil, err
+	}
+	p.mu.Lock()
+	p.stats.Started++
+	p.stats.Open++
+	p.mu.Unlock()
+	return s, nil
+}
+
+// waited records the end of a wait for a session that started at start.
+func (p *Pool) waited(start time.Time) {
+	wait := time.Since(start)
+	p.stats.Waiting--
+	p.stats.WaitTime += wait
+	p.stats.MaxWait = max(p.stats.MaxWait, wait)
+}
+
+func (p *Pool) release(s *Session, jobErr error) {
+	keep := !s.isClosed()
+	if keep {
+		_, err := s.Exec(context.Background(), p.opts.Reset)
+		keep = err == nil
+	}
+	p.mu.Lock()
+	p.stats.Jobs++
+	if jobErr != nil {
+		p.stats.Failed++
+	}
+	if keep && !p.closed {
+		p.idle = append(p.idle, s)
+		s = nil
+	} else {
+		p.stats.Open--
+		if !keep {
+			p.stats.Discarded++
+		}
+	}
+	p.mu.Unlock()
+	if s != nil {
+		s.Close()
+	}
+	<-p.sem
+}
+
+// Stats returns the current counters.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.Idle = len(p.idle)
+	return stats
+}
+
+// Close closes the idle sessions and makes Do fail from now on. Sessions in use are closed
+// when their job ends.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.stats.Open -= len(idle)
+	p.mu.Unlock()
+	for _, s := range idle {
+		s.Close()
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package gostata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	exe := writeFakeStata(t, consoleFake)
+	p := NewRunner(exe).NewPool(&PoolOptions{MaxSessions: 2})
+	defer p.Close()
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// each job must start from a reset session
+			out, err := p.Exec(ctx, fmt.Sprintf("display x\nset x %d\ndisplay x", i))
+			if err != nil || !strings.Contains(out, "\nunset\n") || !strings.Contains(out, fmt.Sprintf("\n%d\n", i)) {
+				t.Errorf("job %d: got %q, %v", i, out, err)
+			}
+		}()
+	}
+	wg.Wait()
+	stats := p.Stats()
+	if stats.Started < 1 || stats.Started > 2 || stats.Open != stats.Started || stats.Idle != stats.Open {
+		t.Errorf("unexpected sessions %+v", stats)
+	}
+	if stats.Jobs != 10 || stats.Failed != 0 || stats.Waiting != 0 || stats.Discarded != 0 {
+		t.Errorf("unexpected counters %+v", stats)
+	}
+}
+
+func TestPoolQueue(t *testing.T) {
+	exe := writeFakeStata(t, consoleFake)
+	p := NewRunner(exe).NewPool(nil)
+	ctx := context.Background()
+	busy, release := make(chan struct{}), make(chan struct{})
+	go p.Do(ctx, func(s *Session) error {
+		close(busy)
+		<-release
+		return nil
+	})
+	<-busy
+
+	// the only session is in use: a second job waits and gives up at its deadline
+	done := make(chan error)
+	go func() {
+		waitCtx, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+		defer cancel()
+		done <- p.Do(waitCtx, func(s *Session) error { return nil })
+	}()
+	for deadline := time.Now().Add(5 * time.Second); p.Stats().Waiting != 1; {
+		if time.Now().After(deadline) {
+			t.Fatal("job not queued")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := <-done; !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	close(release)
+
+	// a job whose session times out discards it; the next job starts a new one
+	timeoutCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if _, err := p.Exec(timeoutCtx, "sleep"); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	if _, err := p.Exec(ctx, "display x"); err != nil {
+		t.Fatal(err)
+	}
+	stats := p.Stats()
+	if stats.Started != 2 || stats.Discarded != 1 || stats.Open != 1 || stats.Jobs != 3 || stats.Failed != 1 || stats.Abandoned != 1 || stats.MaxWait < 250*time.Millisecond {
+		t.Errorf("unexpected counters %+v", stats)
+	}
+
+	// a panicking job frees its slot and discards its session
+	func() {
+		defer func() {
+			if r := recover(); r != "job failed" {
+				t.Errorf("recovered %v", r)
+			}
+		}()
+		p.Do(ctx, func(s *Session) error { panic("job failed") })
+	}()
+	stats = p.Stats()
+	if stats.Open != 0 || stats.Discarded != 2 || stats.Jobs != 4 || stats.Failed != 2 {
+		t.Errorf("unexpected counters after a panic %+v", stats)
+	}
+	afterCtx, cancelAfter := context.WithTimeout(ctx, 5*time.Second)
+	defer cancelAfter()
+	if _, err := p.Exec(afterCtx, "display x"); err != nil {
+		t.Errorf("pool unusable after a panic: %v", err)
+	}
+
+	p.Close()
+	if err := p.Do(ctx, func(s *Session) error { return nil }); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("expected ErrPoolClosed, got %v", err)
+	}
+	if stats := p.Stats(); stats.Open != 0 || stats.Idle != 0 {
+		t.Errorf("sessions left open %+v", stats)
+	}
+}
@@ -0,0 +1,311 @@
+package gostata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Reader reads dta files in formats 113 (Stata 8-9), 114 (Stata 10-11) and 115 (Stata 12).
+// The formats only differ in the width of the display formats (12 bytes in 113, 49 after).
+type Reader struct {
+	Version   byte // 113, 114 or 115
+	ByteOrder binary.ByteOrder
+	NumVars   int
+	NumObs    int
+	DataLabel string
+	TimeStamp string // as stored eg "17 Oct 2026 09:30"
+	vars      []*Variable
+	dtaChars  map[string]string // characteristics of the dataset, including its notes
+	r         *bufio.Reader
+}
+
+// NewReader reads the header and descriptors of a dta file from r.
+// The data and value labels are read by ReadDataset.
+func NewReader(r io.Reader) (*Reader, error) {
+	dr := &Reader{r: bufio.NewReaderSize(r, 64*1024)}
+	if err := dr.readHeader(); err != nil {
+		return nil, fmt.Errorf("reading dta header: %w", err)
+	}
+	if err := dr.readDescriptors(); err != nil {
+		return nil, fmt.Errorf("reading dta descriptors: %w", err)
+	}
+	return dr, nil
+}
+
+// ReadDataset reads a complete dta file from r.
+func ReadDataset(r io.Reader) (*Dataset, error) {
+	dr, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return dr.ReadDataset()
+}
+
+// Vars returns the variables described in the file, without data.
+func (dr *Reader) Vars() []*Variable {
+	return append([]*Variable(nil), dr.vars...)
+}
+
+// ReadDataset reads the data and value labels following the descriptors.
+func (dr *Reader) ReadDataset() (*Dataset, error) {
+	ds := NewDataset()
+	ds.Label = dr.DataLabel
+	ds.Notes, ds.Chars = splitNotes(dr.dtaChars)
+	ds.TimeStamp, _ = time.Parse(timeStampLayout, dr.TimeStamp)
+	ds.nobs = dr.NumObs
+	for _, v := range dr.vars {
+		if v.IsString() {
+			v.strs = make([]string, dr.NumObs)
+		} else {
+			v.nums = make([]float64, dr.NumObs)
+		}
+		ds.vars = append(ds.vars, v)
+	}
+	if err := dr.readData(ds); err != nil {
+		return nil, fmt.Errorf("reading dta data: %w", err)
+	}
+	if err := dr.readValueLabels(ds); err != nil {
+		return nil, fmt.Errorf("reading dta value labels: %w", err)
+	}
+	return ds, nil
+}
+
+func (dr *Reader) readHeader() error {
+	var h [4]byte
+	if _, err := io.ReadFull(dr.r, h[:]); err != nil {
+		return err
+	}
+	dr.Version = h[0]
+	if dr.Version < 113 || dr.Version > 115 {
+		return fmt.Errorf("unsupported dta version %d", dr.Version)
+	}
+	switch h[1] {
+	case 1:
+		dr.ByteOrder = binary.BigEndian
+	case 2:
+		dr.ByteOrder = binary.LittleEndian
+	default:
+		return fmt.Errorf("invalid byte order %d", h[1])
+	}
+	var nvar int16
+	var nobs int32
+	if err := dr.read(&nvar); err != nil {
+		return err
+	}
+	if err := dr.read(&nobs); err != nil {
+		return err
+	}
+	if nvar < 0 || nobs < 0 {
+		return fmt.Errorf("invalid dimensions %d variables x %d observations", nvar, nobs)
+	}
+	dr.NumVars, dr.NumObs = int(nvar), int(nobs)
+	var label stataLabel
+	var stamp [18]byte
+	if err := dr.read(&label); err != nil {
+		return err
+	}
+	if err := dr.read(&stamp); err != nil {
+		return err
+	}
+	dr.DataLabel = cString(label[:])
+	dr.TimeStamp = cString(stamp[:])
+	return nil
+}
+
+func (dr *Reader) readDescriptors() error {
+	nvar := dr.NumVars
+	typList := make([]byte, nvar)
+	varList := make([]stataVarName, nvar)
+	srtList := make([]byte, 2*(nvar+1))
+	fmtList := make([][]byte, nvar)
+	lblList := make([]stataVarName, nvar)
+	vlblList := make([]stataLabel, nvar)
+	if err := dr.read(typList); err != nil {
+		return err
+	}
+	if err := dr.read(varList); err != nil {
+		return err
+	}
+	if err := dr.read(srtList); err != nil {
+		return err
+	}
+	fmtSize := stataFmtSize
+	if dr.Version >= 114 {
+		fmtSize = 49
+	}
+	for i := range fmtList {
+		fmtList[i] = make([]byte, fmtSize)
+		if _, err := io.ReadFull(dr.r, fmtList[i]); err != nil {
+			return err
+		}
+	}
+	if err := dr.read(lblList); err != nil {
+		return err
+	}
+	if err := dr.read(vlblList); err != nil {
+		return err
+	}
+	for i := 0; i < nvar; i++ {
+		if !validType(typList[i]) {
+			return fmt.Errorf("invalid type %d for variable %d", typList[i], i+1)
+		}
+		dr.vars = append(dr.vars, &Variable{
+			Name:       cString(varList[i][:]),
+			Label:      cString(vlblList[i][:]),
+			Format:     cString(fmtList[i]),
+			ValueLabel: cString(lblList[i][:]),
+			typ:        typList[i],
+		})
+	}
+	return dr.readExpansionFields()
+}
+
+// readExpansionFields reads the characteristics stored between the descriptors and the data,
+// setting the notes and characteristics of the variables. Each field is a type byte and a
+// 4-byte length; a field of type 0 and length 0 ends the list. Fields of other types than 1
+// are skipped.
+func (dr *Reader) readExpansionFields() error {
+	chars := make(map[string]map[string]string)
+	for {
+		var typ byte
+		var n int32
+		if err := dr.read(&typ); err != nil {
+			return err
+		}
+		if err := dr.read(&n); err != nil {
+			return err
+		}
+		if typ == 0 {
+			if n != 0 {
+				return fmt.Errorf("expansion field of type 0 and length %d", n)
+			}
+			for _, v := range dr.vars {
+				v.Notes, v.Chars = splitNotes(chars[v.Name])
+			}
+			dr.dtaChars = chars["_dta"]
+			return nil
+		}
+		if n < 0 {
+			return fmt.Errorf("invalid expansion field length %d", n)
+		}
+		if typ != 1 || n < 2*stataVarSize {
+			if _, err := dr.r.Discard(int(n)); err != nil {
+				return err
+			}
+			continue
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(dr.r, data); err != nil {
+			return err
+		}
+		owner, name := cString(data[:stataVarSize]), cString(data[stataVarSize:2*stataVarSize])
+		if chars[owner] == nil {
+			chars[owner] = make(map[string]string)
+		}
+		chars[owner][name] = cString(data[2*stataVarSize:])
+	}
+}
+
+func (dr *Reader) readData(ds *Dataset) error {
+	rec := make([]byte, calcRecordSize(dr.fields()))
+	order := dr.ByteOrder
+	for i := 0; i < ds.nobs; i++ {
+		if _, err := io.ReadFull(dr.r, rec); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("observation %d: %w", i+1, err)
+		}
+		offset := 0
+		for _, v := range ds.vars {
+			switch v.typ {
+			case StataByteId:
+				v.nums[i] = decodeByte(int8(rec[offset]))
+				offset++
+			case StataIntId:
+				v.nums[i] = decodeInt(int16(order.Uint16(rec[offset:])))
+				offset += 2
+			case StataLongId:
+				v.nums[i] = decodeLong(int32(order.Uint32(rec[offset:])))
+				offset += 4
+			case StataFloatId:
+				v.nums[i] = decodeFloat(math.Float32frombits(order.Uint32(rec[offset:])))
+				offset += 4
+			case StataDoubleId:
+				v.nums[i] = decodeDouble(math.Float64frombits(order.Uint64(rec[offset:])))
+				offset += 8
+			default:
+				next := offset + int(v.typ)
+				v.strs[i] = cString(rec[offset:next])
+				offset = next
+			}
+		}
+	}
+	return nil
+}
+
+// readValueLabels reads value label tables until the end of the file.
+func (dr *Reader) readValueLabels(ds *Dataset) error {
+	for {
+		var n int32
+		if err := dr.read(&n); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		var name stataVarName
+		var pad [3]byte
+		var count, txtLen int32
+		for _, data := range []interface{}{&name, &pad, &count, &txtLen} {
+			if err := dr.read(data); err != nil {
+				return err
+			}
+		}
+		if count < 0 || txtLen < 0 || n != 8+8*count+txtLen {
+			return fmt.Errorf("value label %s: inconsistent table length", cString(name[:]))
+		}
+		off := make([]int32, count)
+		values := make([]int32, count)
+		txt := make([]byte, txtLen)
+		for _, data := range []interface{}{off, values, txt} {
+			if err := dr.read(data); err != nil {
+				return err
+			}
+		}
+		vl := NewValueLabel(cString(name[:]))
+		for i, v := range values {
+			if off[i] < 0 || off[i] >= txtLen {
+				return fmt.Errorf("value label %s: invalid text offset %d", vl.Name, off[i])
+			}
+			vl.Set(v, cString(txt[off[i]:]))
+		}
+		ds.labels[vl.Name] = vl
+	}
+}
+
+// read decodes binary data in the file's byte order.
+func (dr *Reader) read(data interface{}) error {
+	return binary.Read(dr.r, dr.ByteOrder, data)
+}
+
+func (dr *Reader) fields() []*Field {
+	fields := make([]*Field, len(dr.vars))
+	for i, v := range dr.vars {
+		fields[i] = &Field{Name: v.Name, FieldType: v.typ}
+	}
+	return fields
+}
+
+// cString returns the contents of b up to the first NUL byte.
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
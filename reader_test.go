@@ -0,0 +1,89 @@
+package gostata
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestDatasetRoundTrip(t *testing.T) {
+	is := is.New(t)
+	ds := newTestDataset(t)
+	ds.TimeStamp = time.Date(2024, 3, 1, 14, 5, 0, 0, time.UTC)
+	fileName := filepath.Join(t.TempDir(), "roundtrip.dta")
+	is.NoErr(ds.WriteFile(fileName))
+
+	got, err := ReadFile(fileName)
+	is.NoErr(err)
+	is.Equal(got.Label, "test data")
+	is.Equal(got.TimeStamp, ds.TimeStamp)
+	is.Equal(got.NumObs(), 3)
+	is.Equal(got.VarNames(), ds.VarNames())
+	for _, v := range ds.Vars() {
+		gv := got.Var(v.Name)
+		is.Equal(gv.Type(), v.Type())
+		is.Equal(gv.Format, v.Format)
+		is.Equal(gv.Label, v.Label)
+		is.Equal(gv.ValueLabel, v.ValueLabel)
+		for i := 0; i < ds.NumObs(); i++ {
+			is.Equal(gv.Str(i), v.Str(i))
+			is.Equal(MissingCode(gv.Float(i)), MissingCode(v.Float(i)))
+			if !IsMissing(v.Float(i)) {
+				is.Equal(gv.Float(i), v.Float(i))
+			}
+		}
+	}
+	vl := got.ValueLabel("sexlbl")
+	is.True(vl != nil)
+	is.Equal(vl.Values(), []int32{1, 2})
+	text, _ := vl.Label(2)
+	is.Equal(text, "female")
+}
+
+func TestReaderAllTypes(t *testing.T) {
+	is := is.New(t)
+	ds := NewDataset()
+	values := []float64{-1, 0, 100, Missing, ExtendedMissing('b')}
+	for _, typ := range []byte{StataByteId, StataIntId, StataLongId, StataFloatId, StataDoubleId} {
+		_, err := ds.AddNumeric(typeName(typ)+"v", typ, values)
+		is.NoErr(err)
+	}
+	var buf bytes.Buffer
+	_, err := ds.WriteTo(&buf)
+	is.NoErr(err)
+	dr, err := NewReader(&buf)
+	is.NoErr(err)
+	is.Equal(dr.Version, byte(113))
+	is.Equal(dr.NumVars, 5)
+	is.Equal(dr.NumObs, 5)
+	got, err := dr.ReadDataset()
+	is.NoErr(err)
+	for _, v := range got.Vars() {
+		is.Equal(v.Type(), ds.Var(v.Name).Type())
+		for i, x := range values {
+			is.Equal(MissingCode(v.Float(i)), MissingCode(x))
+			if !IsMissing(x) {
+				is.Equal(v.Float(i), x)
+			}
+		}
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	_, err := ReadDataset(bytes.NewReader([]byte{117, 2, 1, 0}))
+	if err == nil {
+		t.Errorf("expected an error for an unsupported version")
+	}
+	ds := newTestDataset(t)
+	var buf bytes.Buffer
+	if _, err := ds.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	truncated := buf.Bytes()[:buf.Len()-60]
+	if _, err := ReadDataset(bytes.NewReader(truncated)); err == nil {
+		t.Errorf("expected an error for a truncated file")
+	}
+}
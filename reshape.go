@@ -0,0 +1,341 @@
+package gostata
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ReshapeWide converts ds from long to wide form, like Stata's reshape wide stubs, i(i) j(j).
+// Each stub variable becomes one variable per distinct value of j, named stub followed by
+// the value, eg inc becomes inc1990 and inc1991. The new variables carry the stub's format
+// and value label and are labelled "<j value> <stub label>".
+// Variables other than i, j and the stubs must be constant within i.
+// It is an error if j has missing or non-integer values or is not unique within i.
+func (ds *Dataset) ReshapeWide(stubs []string, i []string, j string) error {
+	iVars, err := ds.lookup(i)
+	if err != nil {
+		return err
+	}
+	jVar := ds.Var(j)
+	if jVar == nil {
+		return fmt.Errorf("variable %s not found", j)
+	}
+	stubVars, err := ds.lookup(stubs)
+	if err != nil {
+		return err
+	}
+	used := make(map[string]bool)
+	for _, name := range append(append(append([]string{}, i...), j), stubs...) {
+		if used[name] {
+			return fmt.Errorf("variable %s specified more than once", name)
+		}
+		used[name] = true
+	}
+
+	// distinct j values and their variable name suffixes
+	suffixes := make(map[string]int)
+	var jRows []int
+	for obs := 0; obs < ds.nobs; obs++ {
+		suffix, err := jSuffix(jVar, obs)
+		if err != nil {
+			return err
+		}
+		if _, ok := suffixes[suffix]; !ok {
+			suffixes[suffix] = len(jRows)
+			jRows = append(jRows, obs)
+		}
+	}
+	sort.SliceStable(jRows, func(a, b int) bool {
+		return compareObs([]*Variable{jVar}, jRows[a], []*Variable{jVar}, jRows[b]) < 0
+	})
+	jOrder := make([]string, len(jRows))
+	for k, obs := range jRows {
+		jOrder[k], _ = jSuffix(jVar, obs)
+		suffixes[jOrder[k]] = k
+	}
+
+	// groups of observations sharing the same i values, in ascending order of i
+	rows := sortedRows(iVars, ds.nobs)
+	var groups [][]int
+	for k, obs := range rows {
+		if k == 0 || compareObs(iVars, rows[k-1], iVars, obs) != 0 {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], obs)
+	}
+	cells := make([][]int, len(groups)) // cells[g][k] is the row holding j value k of group g
+	for g, group := range groups {
+		cells[g] = make([]int, len(jOrder))
+		for k := range cells[g] {
+			cells[g][k] = -1
+		}
+		for _, obs := range group {
+			suffix, _ := jSuffix(jVar, obs)
+			k := suffixes[suffix]
+			if cells[g][k] >= 0 {
+				return fmt.Errorf("values of variable %s not unique within %s", j, strings.Join(i, " "))
+			}
+			cells[g][k] = obs
+		}
+	}
+	var others []*Variable
+	for _, v := range ds.vars {
+		if used[v.Name] {
+			continue
+		}
+		for _, group := range groups {
+			for _, obs := range group[1:] {
+				if !sameValue(v, obs, group[0]) {
+					return fmt.Errorf("variable %s not constant within %s", v.Name, strings.Join(i, " "))
+				}
+			}
+		}
+		others = append(others, v)
+	}
+
+	first := make([]int, len(groups))
+	for g, group := range groups {
+		first[g] = group[0]
+	}
+	vars := make([]*Variable, 0, len(i)+len(stubs)*len(jOrder)+len(others))
+	for _, v := range iVars {
+		vars = append(vars, v.take(first, v.typ))
+	}
+	names := make(map[string]bool)
+	for _, v := range append(iVars, others...) {
+		names[v.Name] = true
+	}
+	for _, stub := range stubVars {
+		label := stub.Label
+		if label == "" {
+			label = stub.Name
+		}
+		for k, suffix := range jOrder {
+			name := stub.Name + suffix
+			if err := ValidateName(name); err != nil {
+				return err
+			}
+			if names[name] {
+				return fmt.Errorf("variable %s already defined", name)
+			}
+			names[name] = true
+			cellRows := make([]int, len(groups))
+			for g := range groups {
+				cellRows[g] = cells[g][k]
+			}
+			nv := stub.take(cellRows, stub.typ)
+			nv.Name = name
+			nv.Label = truncateLabel(suffix + " " + label)
+			vars = append(vars, nv)
+		}
+	}
+	for _, v := range others {
+		vars = append(vars, v.take(first, v.typ))
+	}
+	ds.vars = vars
+	ds.nobs = len(groups)
+	return nil
+}
+
+// ReshapeLong converts ds from wide to long form, like Stata's reshape long stubs, i(i) j(j).
+// For each stub, the variables named stub followed by a suffix are stacked into one variable
+// called stub, and the suffix is stored in the new variable j: numeric unless stringJ is true,
+// in which case any suffix is accepted. Combinations without a wide variable are missing.
+// It is an error if i does not uniquely identify the observations.
+func (ds *Dataset) ReshapeLong(stubs []string, i []string, j string, stringJ bool) error {
+	iVars, err := ds.lookup(i)
+	if err != nil {
+		return err
+	}
+	if ds.Var(j) != nil {
+		return fmt.Errorf("variable %s already defined", j)
+	}
+	if err := ValidateName(j); err != nil {
+		return err
+	}
+	if err := checkUniqueKeys(iVars, ds.nobs, i, "wide"); err != nil {
+		return err
+	}
+
+	// wide[s][suffix] is the variable holding stub s for that j value
+	wide := make([]map[string]*Variable, len(stubs))
+	suffixSet := make(map[string]bool)
+	isWide := make(map[string]bool)
+	for s, stub := range stubs {
+		wide[s] = make(map[string]*Variable)
+		for _, v := range ds.vars {
+			suffix, ok := strings.CutPrefix(v.Name, stub)
+			if !ok || suffix == "" || isWide[v.Name] {
+				continue
+			}
+			if !stringJ {
+				if _, err := strconv.Atoi(suffix); err != nil {
+					continue
+				}
+			}
+			wide[s][suffix] = v
+			suffixSet[suffix] = true
+			isWide[v.Name] = true
+		}
+		if len(wide[s]) == 0 {
+			return fmt.Errorf("no xij variables found for stub %s", stub)
+		}
+	}
+	for _, v := range iVars {
+		if isWide[v.Name] {
+			return fmt.Errorf("variable %s is both an i variable and a wide variable", v.Name)
+		}
+	}
+	jValues := make([]string, 0, len(suffixSet))
+	for suffix := range suffixSet {
+		jValues = append(jValues, suffix)
+	}
+	sort.Slice(jValues, func(a, b int) bool {
+		if stringJ {
+			return jValues[a] < jValues[b]
+		}
+		x, _ := strconv.Atoi(jValues[a])
+		y, _ := strconv.Atoi(jValues[b])
+		return x < y
+	})
+
+	rows := sortedRows(iVars, ds.nobs)
+	n := len(rows) * len(jValues)
+	longRows := make([]int, 0, n)
+	for _, obs := range rows {
+		for range jValues {
+			longRows = append(longRows, obs)
+		}
+	}
+	vars := make([]*Variable, 0, len(ds.vars))
+	for _, v := range iVars {
+		vars = append(vars, v.take(longRows, v.typ))
+	}
+	jv := &Variable{Name: j}
+	if stringJ {
+		jv.typ = 1
+		jv.strs = make([]string, 0, n)
+		for range rows {
+			for _, suffix := range jValues {
+				jv.strs = append(jv.strs, suffix)
+				jv.typ = max(jv.typ, byte(min(len(suffix), maxStrWidth)))
+			}
+		}
+	} else {
+		jv.typ = StataByteId
+		jv.nums = make([]float64, 0, n)
+		for range rows {
+			for _, suffix := range jValues {
+				x, _ := strconv.Atoi(suffix)
+				jv.nums = append(jv.nums, float64(x))
+				jv.typ = promoteNumeric(jv.typ, float64(x))
+			}
+		}
+	}
+	jv.Format = defaultFormat(jv.typ)
+	vars = append(vars, jv)
+
+	for s, stub := range stubs {
+		var proto *Variable
+		var typ byte
+		for _, suffix := range jValues {
+			v := wide[s][suffix]
+			if v == nil {
+				continue
+			}
+			if proto == nil {
+				proto, typ = v, v.typ
+				continue
+			}
+			if typ, err = widerType(typ, v.typ); err != nil {
+				return fmt.Errorf("variables %s%s and %s are of different types", stub, suffix, proto.Name)
+			}
+		}
+		if ds.Var(stub) != nil && !isWide[stub] {
+			return fmt.Errorf("variable %s already defined", stub)
+		}
+		nv := &Variable{Name: stub, Format: proto.Format, ValueLabel: proto.ValueLabel, typ: typ}
+		if label, ok := strings.CutPrefix(proto.Label, strings.TrimPrefix(proto.Name, stub)+" "); ok {
+			nv.Label = label
+		}
+		if nv.IsString() {
+			nv.strs = make([]string, 0, n)
+		} else {
+			nv.nums = make([]float64, 0, n)
+		}
+		for _, obs := range rows {
+			for _, suffix := range jValues {
+				v := wide[s][suffix]
+				switch {
+				case nv.IsString() && v != nil:
+					nv.strs = append(nv.strs, v.strs[obs])
+				case nv.IsString():
+					nv.strs = append(nv.strs, "")
+				case v != nil:
+					nv.nums = append(nv.nums, v.nums[obs])
+				default:
+					nv.nums = append(nv.nums, Missing)
+				}
+			}
+		}
+		vars = append(vars, nv)
+	}
+	isKey := make(map[string]bool)
+	for _, name := range i {
+		isKey[name] = true
+	}
+	for _, v := range ds.vars {
+		if !isKey[v.Name] && !isWide[v.Name] {
+			vars = append(vars, v.take(longRows, v.typ))
+		}
+	}
+	ds.vars = vars
+	ds.nobs = n
+	return nil
+}
+
+// jSuffix returns the variable name suffix for the j value of observation obs.
+func jSuffix(jVar *Variable, obs int) (string, error) {
+	if jVar.IsString() {
+		return jVar.strs[obs], nil
+	}
+	x := jVar.nums[obs]
+	switch {
+	case IsMissing(x):
+		return "", fmt.Errorf("variable %s contains missing values", jVar.Name)
+	case x != math.Trunc(x):
+		return "", fmt.Errorf("variable %s contains noninteger values", jVar.Name)
+	}
+	return strconv.FormatFloat(x, 'f', 0, 64), nil
+}
+
+// sortedRows returns the observation numbers ordered by the values of keys.
+func sortedRows(keys []*Variable, nobs int) []int {
+	rows := make([]int, nobs)
+	for k := range rows {
+		rows[k] = k
+	}
+	sort.SliceStable(rows, func(a, b int) bool {
+		return compareObs(keys, rows[a], keys, rows[b]) < 0
+	})
+	return rows
+}
+
+// sameValue reports whether observations a and b of v hold the same value.
+func sameValue(v *Variable, a, b int) bool {
+	if v.IsString() {
+		return v.strs[a] == v.strs[b]
+	}
+	x, y := v.nums[a], v.nums[b]
+	return x == y || math.Float64bits(x) == math.Float64bits(y)
+}
+
+func truncateLabel(s string) string {
+	if len(s) > maxLabelLen {
+		return s[:maxLabelLen]
+	}
+	return s
+}
@@ -0,0 +1,88 @@
+package gostata
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func newLongPanel(t *testing.T) *Dataset {
+	is := is.New(t)
+	ds := NewDataset()
+	_, err := ds.AddNumeric("id", StataByteId, []float64{2, 1, 1, 2, 1})
+	is.NoErr(err)
+	_, err = ds.AddNumeric("year", StataIntId, []float64{1990, 1991, 1990, 1991, 1992})
+	is.NoErr(err)
+	inc, err := ds.AddNumeric("inc", StataLongId, []float64{200, 110, 100, 210, 120})
+	is.NoErr(err)
+	inc.Label = "income"
+	_, err = ds.AddString("sex", []string{"f", "m", "m", "f", "m"})
+	is.NoErr(err)
+	return ds
+}
+
+func TestReshapeWide(t *testing.T) {
+	is := is.New(t)
+	ds := newLongPanel(t)
+	is.NoErr(ds.ReshapeWide([]string{"inc"}, []string{"id"}, "year"))
+	is.Equal(ds.VarNames(), []string{"id", "inc1990", "inc1991", "inc1992", "sex"})
+	is.Equal(ds.NumObs(), 2)
+	is.Equal(ds.Var("id").Float(0), 1.0)
+	is.Equal(ds.Var("inc1990").Float(0), 100.0)
+	is.Equal(ds.Var("inc1992").Float(0), 120.0)
+	is.True(IsMissing(ds.Var("inc1992").Float(1)))
+	is.Equal(ds.Var("inc1991").Float(1), 210.0)
+	is.Equal(ds.Var("sex").Str(1), "f")
+	is.Equal(ds.Var("inc1990").Label, "1990 income")
+	is.Equal(ds.Var("inc1990").TypeName(), "long")
+
+	// and back again
+	is.NoErr(ds.ReshapeLong([]string{"inc"}, []string{"id"}, "year", false))
+	is.Equal(ds.VarNames(), []string{"id", "year", "inc", "sex"})
+	is.Equal(ds.NumObs(), 6)
+	is.Equal(ds.Var("inc").Label, "income")
+	is.Equal(ds.Var("year").TypeName(), "int")
+	wantYear := []float64{1990, 1991, 1992, 1990, 1991, 1992}
+	wantInc := []float64{100, 110, 120, 200, 210, Missing}
+	for i := range wantYear {
+		is.Equal(ds.Var("year").Float(i), wantYear[i])
+		is.Equal(ds.Var("inc").Float(i), wantInc[i])
+	}
+}
+
+func TestReshapeErrors(t *testing.T) {
+	is := is.New(t)
+	ds := newLongPanel(t)
+	is.NoErr(ds.Var("year").SetFloat(4, 1990))
+	err := ds.ReshapeWide([]string{"inc"}, []string{"id"}, "year")
+	is.True(err != nil)
+	is.Equal(err.Error(), "values of variable year not unique within id")
+
+	ds = newLongPanel(t)
+	is.NoErr(ds.Var("sex").SetStr(4, "f"))
+	is.True(ds.ReshapeWide([]string{"inc"}, []string{"id"}, "year") != nil) // sex not constant
+
+	ds = newLongPanel(t)
+	is.NoErr(ds.Var("year").SetFloat(0, Missing))
+	is.True(ds.ReshapeWide([]string{"inc"}, []string{"id"}, "year") != nil)
+
+	ds = newLongPanel(t)
+	is.True(ds.ReshapeLong([]string{"inc"}, []string{"id"}, "t", false) != nil) // id not unique
+}
+
+func TestReshapeLongString(t *testing.T) {
+	is := is.New(t)
+	ds := NewDataset()
+	_, err := ds.AddNumeric("id", StataByteId, []float64{1, 2})
+	is.NoErr(err)
+	_, err = ds.AddNumeric("bpsys", StataIntId, []float64{120, 130})
+	is.NoErr(err)
+	_, err = ds.AddNumeric("bpdia", StataIntId, []float64{80, 85})
+	is.NoErr(err)
+	is.NoErr(ds.ReshapeLong([]string{"bp"}, []string{"id"}, "kind", true))
+	is.Equal(ds.VarNames(), []string{"id", "kind", "bp"})
+	is.Equal(ds.Var("kind").Str(0), "dia")
+	is.Equal(ds.Var("kind").TypeName(), "str3")
+	is.Equal(ds.Var("bp").Float(1), 120.0)
+	is.Equal(ds.Var("bp").Float(2), 85.0)
+}
@@ -0,0 +1,295 @@
+package gostata
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Stored holds the results of one class (r, e or c) as left by the last command of a script.
+type Stored struct {
+	Scalars  map[string]float64
+	Macros   map[string]string
+	Matrices map[string]*Matrix
+}
+
+func newStored() Stored {
+	return Stored{Scalars: make(map[string]float64), Macros: make(map[string]string), Matrices: make(map[string]*Matrix)}
+}
+
+// Results are the stored results collected by RunResults: r() and e() results in full and
+// a selection of c() values (see resultsCScalars and resultsCMacros).
+type Results struct {
+	R, E, C Stored
+	Log     string // the log of the run
+	named   Stored // matrices exported by RunMatrices
+}
+
+// Scalar returns a scalar result named as in Stata, eg "r(N)", "e(r2)" or "c(k)".
+func (res *Results) Scalar(name string) (float64, bool) {
+	s, key := res.class(name)
+	if s == nil {
+		return 0, false
+	}
+	x, ok := s.Scalars[key]
+	return x, ok
+}
+
+// Macro returns a macro result named as in Stata, eg "e(cmd)".
+func (res *Results) Macro(name string) (string, bool) {
+	s, key := res.class(name)
+	if s == nil {
+		return "", false
+	}
+	v, ok := s.Macros[key]
+	return v, ok
+}
+
+// Matrix returns a matrix result named as in Stata, eg "e(b)".
+func (res *Results) Matrix(name string) (*Matrix, bool) {
+	s, key := res.class(name)
+	if s == nil {
+		return nil, false
+	}
+	m, ok := s.Matrices[key]
+	return m, ok
+}
+
+// class splits a name like "e(b)" into the results of its class and the key "b".
+func (res *Results) class(name string) (*Stored, string) {
+	if len(name) < 4 || name[1] != '(' || name[len(name)-1] != ')' {
+		return nil, ""
+	}
+	key := name[2 : len(name)-1]
+	switch name[0] {
+	case 'r':
+		return &res.R, key
+	case 'e':
+		return &res.E, key
+	case 'c':
+		return &res.C, key
+	}
+	return nil, ""
+}
+
+// The c() values collected by RunResults.
+var (
+	resultsCScalars = []string{"N", "k", "rc", "stata_version", "version", "level"}
+	resultsCMacros  = []string{"current_date", "current_time", "filename", "filedate", "os", "pwd"}
+)
+
+// RunResults runs script with the default runner (see DefaultRunner) and collects the
+// stored results it leaves.
+func RunResults(ctx context.Context, workDir, script string) (*Results, error) {
+	return DefaultRunner().RunResults(ctx, workDir, script)
+}
+
+// RunResults runs script followed by an epilogue that writes the r(), e() and selected c()
+// results to a temporary file in workDir, and returns them. Numbers are transferred in
+// Stata's hexadecimal format so no precision is lost.
+func (r *Runner) RunResults(ctx context.Context, workDir, script string) (*Results, error) {
+	return r.runCollect(ctx, workDir, script, resultsCode)
+}
+
+// runCollect runs script followed by an epilogue that opens a temporary results file as
+// `fh', writes to it with body and closes it, then parses the file.
+func (r *Runner) runCollect(ctx context.Context, workDir, script string, body func(w codeWriter)) (*Results, error) {
+	const errmsg = "error collecting Stata results: %w"
+	f, err := os.CreateTemp(workDir, "results-*.txt")
+	if err != nil {
+		return nil, fmt.Errorf(errmsg, err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	fileName, err := filepath.Abs(f.Name())
+	if err != nil {
+		return nil, fmt.Errorf(errmsg, err)
+	}
+	out, err := r.runDo(ctx, workDir, "qui {\n"+script+"\n}\n"+resultsEpilogue(fileName, body))
+	if err != nil {
+		return nil, err
+	}
+	res, err := readResults(fileName)
+	if err != nil {
+		return nil, fmt.Errorf(errmsg, err)
+	}
+	res.Log = out
+	return res, nil
+}
+
+// codeWriter appends a formatted line of Stata code.
+type codeWriter func(format string, args ...any)
+
+// resultsEpilogue returns Stata code writing results to fileName, one per line:
+//
+//	s <class> <name> <value>          scalar
+//	m <class> <name> <text>           macro
+//	M <class> <name> <rows> <cols>    matrix (class is empty for RunMatrices), followed by
+//	Mr <row names>
+//	Mc <column names>
+//	Mv <value> ...                    one line per row
+//
+// Fields are separated by tabs; values are in %21x format.
+func resultsEpilogue(fileName string, body func(w codeWriter)) string {
+	var sb strings.Builder
+	w := func(format string, args ...any) { fmt.Fprintf(&sb, format+"\n", args...) }
+	w("quietly {")
+	// file commands may clear r(), so it is held and restored before it is read
+	w("_return hold __gostata_r")
+	w("tempname fh m")
+	w("file open `fh' using `\"%s\"', write text replace", fileName)
+	w("_return restore __gostata_r, hold")
+	body(w)
+	w("file close `fh'")
+	w("_return restore __gostata_r")
+	w("}")
+	return sb.String()
+}
+
+// resultsCode writes the r(), e() and selected c() results.
+func resultsCode(w codeWriter) {
+	w("foreach c in r e {")
+	w("  local names : `c'(scalars)")
+	w("  foreach n of local names {")
+	w("    file write `fh' \"s\" _tab \"`c'\" _tab \"`n'\" _tab %%21x (`c'(`n')) _n")
+	w("  }")
+	w("  local names : `c'(macros)")
+	w("  foreach n of local names {")
+	w("    file write `fh' \"m\" _tab \"`c'\" _tab \"`n'\" _tab `\"``c'(`n')'\"' _n")
+	w("  }")
+	w("  local names : `c'(matrices)")
+	w("  foreach n of local names {")
+	matrixCode(w, "`c'", "`n'", "`c'(`n')")
+	w("  }")
+	w("}")
+	w("foreach n in %s {", strings.Join(resultsCScalars, " "))
+	w("  file write `fh' \"s\" _tab \"c\" _tab \"`n'\" _tab %%21x (c(`n')) _n")
+	w("}")
+	w("foreach n in %s {", strings.Join(resultsCMacros, " "))
+	w("  file write `fh' \"m\" _tab \"c\" _tab \"`n'\" _tab `\"`c(`n')'\"' _n")
+	w("}")
+}
+
+func readResults(fileName string) (*Results, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseResults(bufio.NewScanner(f))
+}
+
+func parseResults(sc *bufio.Scanner) (*Results, error) {
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	res := &Results{R: newStored(), E: newStored(), C: newStored(), named: newStored()}
+	var m *Matrix
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		kind, rest, _ := strings.Cut(line, "\t")
+		var err error
+		switch kind {
+		case "s", "m", "M":
+			fields := strings.SplitN(rest, "\t", 3)
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("line %d: expected class, name and value", n)
+			}
+			s, _ := res.class(fields[0] + "(" + fields[1] + ")")
+			if fields[0] == "" && kind == "M" {
+				s = &res.named // exported by RunMatrices
+			}
+			if s == nil {
+				return nil, fmt.Errorf("line %d: invalid class %q", n, fields[0])
+			}
+			switch kind {
+			case "s":
+				s.Scalars[fields[1]], err = parseStataHex(fields[2])
+			case "m":
+				s.Macros[fields[1]] = fields[2]
+			case "M":
+				m = &Matrix{Name: fields[1]}
+				if fields[0] != "" {
+					m.Name = fields[0] + "(" + fields[1] + ")"
+				}
+				dims := strings.Fields(fields[2])
+				if len(dims) != 2 {
+					return nil, fmt.Errorf("line %d: expected matrix dimensions", n)
+				}
+				if m.Rows, err = strconv.Atoi(dims[0]); err == nil {
+					m.Cols, err = strconv.Atoi(dims[1])
+				}
+				m.Data = make([]float64, 0, m.Rows*m.Cols)
+				s.Matrices[fields[1]] = m
+			}
+		case "Mr", "Mc", "Mv":
+			if m == nil {
+				return nil, fmt.Errorf("line %d: matrix data without a matrix", n)
+			}
+			switch kind {
+			case "Mr":
+				m.RowNames = strings.Fields(rest)
+			case "Mc":
+				m.ColNames = strings.Fields(rest)
+			default:
+				for _, cell := range strings.Split(rest, "\t") {
+					var x float64
+					if x, err = parseStataHex(cell); err != nil {
+						break
+					}
+					m.Data = append(m.Data, x)
+				}
+			}
+		default:
+			err = fmt.Errorf("unknown record %q", kind)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	for _, s := range []Stored{res.R, res.E, res.named} {
+		for name, m := range s.Matrices {
+			if len(m.Data) != m.Rows*m.Cols || len(m.RowNames) != m.Rows || len(m.ColNames) != m.Cols {
+				return nil, fmt.Errorf("matrix %s: incomplete data", name)
+			}
+		}
+	}
+	return res, nil
+}
+
+// parseStataHex parses a number written in Stata's %21x format, eg "+1.8000000000000X+001"
+// for 3 (the exponent is hexadecimal), or a missing value such as "." or ".a".
+func parseStataHex(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "." {
+		return Missing, nil
+	}
+	if len(s) == 2 && s[0] == '.' && s[1] >= 'a' && s[1] <= 'z' {
+		return ExtendedMissing(s[1]), nil
+	}
+	mant, exp, ok := strings.Cut(s, "X")
+	if !ok || len(exp) < 2 {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	e, err := strconv.ParseInt(exp, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	sign := ""
+	if mant != "" && (mant[0] == '+' || mant[0] == '-') {
+		sign, mant = mant[:1], mant[1:]
+	}
+	x, err := strconv.ParseFloat(fmt.Sprintf("%s0x%sp%d", sign, mant, e), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return x, nil
+}
@@ -0,0 +1,122 @@
+package gostata
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParseStataHex(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"+1.0000000000000X+000", 1},
+		{"+1.8000000000000X+001", 3},
+		{"-1.2800000000000X+006", -74},
+		{"+1.0000000000000X+00a", 1024},
+		{"+1.0000000000000X-001", 0.5},
+		{"+1.999999999999aX-004", 0.1},
+		{"+0.0000000000000X-3ff", 0},
+		{".", Missing},
+		{".b", ExtendedMissing('b')},
+	}
+	for _, tt := range tests {
+		got, err := parseStataHex(tt.in)
+		if err != nil {
+			t.Errorf("%s: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want && !(IsMissing(got) && MissingCode(got) == MissingCode(tt.want)) {
+			t.Errorf("%s: got %v, want %v", tt.in, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "1.5", "+1.0X", "+1.zzX+001"} {
+		if _, err := parseStataHex(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+// sampleResults is shaped like what the epilogue writes after regress price mpg.
+const sampleResults = "s\tr\tlevel\t+1.8c00000000000X+006\n" +
+	"s\te\tN\t+1.2800000000000X+006\n" +
+	"s\te\tr2\t+1.c000000000000X-003\n" +
+	"m\te\tcmd\tregress\n" +
+	"m\te\tcmdline\tregress price mpg, vce(robust)\n" +
+	"M\te\tb\t1\t2\n" +
+	"Mr\ty1\n" +
+	"Mc\tprice:mpg price:_cons\n" +
+	"Mv\t-1.0f84f7b2f6d3cX+008\t+1.7d1a8b3a1c0b4X+00d\n" +
+	"M\te\tV\t2\t2\n" +
+	"Mr\tmpg _cons\n" +
+	"Mc\tmpg _cons\n" +
+	"Mv\t+1.0000000000000X+000\t.\n" +
+	"Mv\t.a\t+1.0000000000000X+001\n" +
+	"s\tc\tN\t+1.2800000000000X+006\n" +
+	"m\tc\tos\tUnix\n"
+
+func TestParseResults(t *testing.T) {
+	res, err := parseResults(bufio.NewScanner(strings.NewReader(sampleResults)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := res.Scalar("e(N)"); !ok || n != 74 {
+		t.Errorf("e(N) = %v, %v", n, ok)
+	}
+	if n, ok := res.Scalar("c(N)"); !ok || n != 74 {
+		t.Errorf("c(N) = %v, %v", n, ok)
+	}
+	if _, ok := res.Scalar("r(N)"); ok {
+		t.Error("r(N) should not be set")
+	}
+	if cmd, _ := res.Macro("e(cmdline)"); cmd != "regress price mpg, vce(robust)" {
+		t.Errorf("e(cmdline) = %q", cmd)
+	}
+	b, ok := res.Matrix("e(b)")
+	if !ok {
+		t.Fatal("e(b) not found")
+	}
+	if b.Rows != 1 || b.Cols != 2 || b.ColNames[1] != "price:_cons" || b.RowNames[0] != "y1" {
+		t.Errorf("unexpected e(b) %+v", b)
+	}
+	V, _ := res.Matrix("e(V)")
+	if V.At(0, 0) != 1 || V.At(1, 1) != 2 || MissingCode(V.At(0, 1)) != '.' || MissingCode(V.At(1, 0)) != 'a' {
+		t.Errorf("unexpected e(V) %v", V.Data)
+	}
+	if _, ok := res.Scalar("x(N)"); ok {
+		t.Error("invalid class accepted")
+	}
+
+	for _, bad := range []string{"s\tq\tN\t1\n", "Mv\t1\n", "M\te\tb\t2\t2\nMr\ta b\nMc\ta b\nMv\t+1.0X+000\n", "z\n"} {
+		if _, err := parseResults(bufio.NewScanner(strings.NewReader(bad))); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestRunResults(t *testing.T) {
+	// the fake ignores the epilogue and writes sampleResults to the results file it names
+	exe := writeFakeStata(t, `base=$(basename "$3" .do)
+out=$(grep -o 'results-[0-9]*\.txt' "$3" | head -1)
+printf '`+strings.ReplaceAll(sampleResults, "\t", `\t`)+`' | sed 's/\\n/\n/g' > "$out"
+echo ". regress price mpg" > "$base.log"
+`)
+	res, err := NewRunner(exe).RunResults(context.Background(), t.TempDir(), "sysuse auto\nregress price mpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r2, _ := res.Scalar("e(r2)"); r2 != 0.21875 {
+		t.Errorf("e(r2) = %v", r2)
+	}
+	if !strings.Contains(res.Log, "regress price mpg") {
+		t.Errorf("unexpected log %q", res.Log)
+	}
+	epilogue := resultsEpilogue("/tmp/results.txt", resultsCode)
+	for _, want := range []string{"_return hold", "`\"/tmp/results.txt\"'", "%21x (`c'(`n'))", "``c'(`n')'"} {
+		if !strings.Contains(epilogue, want) {
+			t.Errorf("epilogue does not contain %s", want)
+		}
+	}
+}
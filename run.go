@@ -1,10 +1,11 @@
 package gostata
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
-	"path"
+	"path/filepath"
 	"strings"
 )
 
@@ -23,40 +24,46 @@ type stata-mp -h for usage
 */
 const stataShellCommand = "stata-mp"
 
+// ErrTimeout is returned (wrapped) when a run is stopped because its context deadline expired.
+var ErrTimeout = errors.New("stata run timed out")
+
+// RunScript runs script with the default runner (see DefaultRunner) and returns the
+// "key=value" pairs it displayed.
 func RunScript(workDir, script string) (map[string]string, error) {
-	const errmsg = "error running Stata script: %s"
-	script = "qui {\n" + script + "\n}\n" 
-	fname, err := SaveToTempFile(workDir, script, "do")
-	if err != nil {
-		return nil, fmt.Errorf(errmsg, err)
-	}
-	defer os.Remove(fname) // Clean up the temporary file
-	out, err := RunStataDo(workDir, fname)
-	if err != nil {
-		return nil, fmt.Errorf(errmsg, err)
-	}
-	return GetKeyValuePairs(out), nil
+	return RunScriptContext(context.Background(), workDir, script)
 }
 
+// RunScriptContext is like RunScript but stops Stata, including any process it started,
+// when ctx is done. The temporary do-file and its log are removed in all cases.
+func RunScriptContext(ctx context.Context, workDir, script string) (map[string]string, error) {
+	return DefaultRunner().RunScript(ctx, workDir, script)
+}
+
+// RunStataDo runs doFileName with the default runner (see DefaultRunner) and returns its log.
 func RunStataDo(workDir, doFileName string) (output string, err error) {
-	err = os.Chdir(workDir) //Stata creates log file in this directory
-	if err != nil {
-		return "", err
-	}
-	cmdArgs := []string{"-q", "-e", doFileName}
-	cmd := exec.Command(stataShellCommand, cmdArgs...)
-	cmd.Dir = workDir
-	if err := cmd.Run(); err != nil {
-		return "", err
-	}
-	_, logFileName := path.Split(doFileName)
-	ext := path.Ext(logFileName)
-	logFileName = logFileName[0:len(logFileName)-len(ext)] + ".log"
-	cmdOut, err := os.ReadFile(logFileName)
-	if err != nil {
-		return "", err
+	return RunStataDoContext(context.Background(), workDir, doFileName)
+}
+
+// RunStataDoContext is like RunStataDo but kills the Stata process tree when ctx is done.
+// If the deadline of ctx expired, the error wraps both ErrTimeout and context.DeadlineExceeded;
+// if ctx was canceled, it wraps context.Canceled.
+func RunStataDoContext(ctx context.Context, workDir, doFileName string) (output string, err error) {
+	return DefaultRunner().RunDo(ctx, workDir, doFileName)
+}
+
+// contextError converts the error of a done context into the error returned by the runners.
+func contextError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
 	}
-	return string(cmdOut), nil
+	return err
+}
+
+// logName returns the path of the log Stata writes in workDir when running doFileName:
+// the base name of the do-file with a .log extension, whatever directory the do-file is in.
+func logName(workDir, doFileName string) string {
+	base := filepath.Base(doFileName)
+	return filepath.Join(workDir, base[:len(base)-len(filepath.Ext(base))]+".log")
 }
 
 func GetKeyValuePairs(s string) map[string]string {
@@ -88,11 +95,10 @@ func basename(s string) string {
 // in the system's default temp directory if dir is empty string
 // and returns the filename.
 func SaveToTempFile(dir string, content string, ext string) (string, error) {
-	tempFile, err := os.CreateTemp(dir, "tempfile-*." + ext)
+	tempFile, err := os.CreateTemp(dir, "tempfile-*."+ext)
 	if err != nil {
 		return "", err
 	}
-	fmt.Println(tempFile.Name())
 	defer tempFile.Close()
 	if _, err := tempFile.WriteString(content); err != nil {
 		return "", err
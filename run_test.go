@@ -1,19 +1,37 @@
 package gostata
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
 	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
-const (
-	testDir = "/Users/drgo/local/code/gostata/testing"
-)
+// testDir holds the do-files used by the tests that run Stata.
+var testDir, _ = filepath.Abs("testing")
 
 func getTestingPath(filename string)string {
 	return path.Join(testDir, filename)
 }
 
+// requireStata skips the test if Stata is not installed.
+func requireStata(t *testing.T) {
+	t.Helper()
+	if _, err := FindStata(); err != nil {
+		t.Skipf("%s: skipping test that runs Stata", err)
+	}
+}
+
 func TestRunStata(t *testing.T) {
+	requireStata(t)
 	output, err := RunStataDo(testDir, "do.do")
 	if err != nil {
 		t.Fatalf("%s", err)
@@ -22,3 +40,106 @@ func TestRunStata(t *testing.T) {
 	dict := GetKeyValuePairs(output)
 	t.Logf("dict: %v", dict)
 }
+
+// writeFakeStata writes an executable shell script standing in for Stata and returns its path.
+func writeFakeStata(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake Stata scripts need a POSIX shell")
+	}
+	fileName := filepath.Join(t.TempDir(), "fake-stata")
+	if err := os.WriteFile(fileName, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func TestLogName(t *testing.T) {
+	dir := filepath.Join("work", "dir")
+	want := filepath.Join(dir, "job.v2.log")
+	for _, doFile := range []string{"job.v2.do", filepath.Join("other", "job.v2.do"), filepath.Join(t.TempDir(), "job.v2.do")} {
+		if got := logName(dir, doFile); got != want {
+			t.Errorf("logName(%q) = %q, want %q", doFile, got, want)
+		}
+	}
+	if runtime.GOOS == "windows" {
+		if got := logName(`C:\work`, `C:\Temp\job.do`); got != `C:\work\job.log` {
+			t.Errorf("logName of a backslash path = %q", got)
+		}
+	}
+}
+
+func TestRunStataDoContextTimeout(t *testing.T) {
+	workDir := t.TempDir()
+	// the fake starts a child that would outlive it if only the parent were killed
+	exe := writeFakeStata(t, "sleep 30 &\necho $! > child.pid\nwait\n")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := NewRunner(exe).RunDo(ctx, workDir, "test.do")
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("run took %v to stop", elapsed)
+	}
+	pid, err := os.ReadFile(filepath.Join(workDir, "child.pid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the killed child may linger briefly as a zombie until it is reaped
+	for i := 0; i < 50; i++ {
+		stat, err := exec.Command("ps", "-o", "stat=", "-p", strings.TrimSpace(string(pid))).Output()
+		if err != nil || strings.HasPrefix(strings.TrimSpace(string(stat)), "Z") {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Errorf("child process %s still running after the timeout", pid)
+}
+
+func TestRunStataDoContextCanceled(t *testing.T) {
+	exe := writeFakeStata(t, "sleep 30\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	_, err := NewRunner(exe).RunDo(ctx, t.TempDir(), "test.do")
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected a cancellation error, got %v", err)
+	}
+}
+
+func TestRunStataDoParallel(t *testing.T) {
+	// the fake writes a log named after the do-file in its working directory, like Stata
+	exe := writeFakeStata(t, `base=$(basename "$3" .do)
+echo "dir=$(pwd)" > "$base.log"
+echo "do=$base" >> "$base.log"
+`)
+	wd, _ := os.Getwd()
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			workDir := t.TempDir()
+			doFile := fmt.Sprintf("job%d.do", i)
+			out, err := NewRunner(exe).RunDo(context.Background(), workDir, doFile)
+			if err != nil {
+				errs <- err
+				return
+			}
+			dict := GetKeyValuePairs(out)
+			if dir, _ := filepath.EvalSymlinks(workDir); dict["dir"] != dir || dict["do"] != fmt.Sprintf("job%d", i) {
+				errs <- fmt.Errorf("job %d: unexpected log %v", i, dict)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if now, _ := os.Getwd(); now != wd {
+		t.Errorf("working directory changed from %s to %s", wd, now)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package gostata
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessTree starts cmd in its own process group and makes cancellation kill the whole
+// group, so that processes started by Stata do not outlive it.
+func killProcessTree(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build windows
+
+package gostata
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// killProcessTree makes cancellation kill cmd and every process it started.
+func killProcessTree(cmd *exec.Cmd) {
+	cmd.Cancel = func() error {
+		return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+	}
+}
@@ -0,0 +1,234 @@
+package gostata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// killGrace is how long to wait for output pipes to close after the Stata process is killed.
+const killGrace = 5 * time.Second
+
+// Edition is the flavour of Stata an executable belongs to.
+type Edition string
+
+const (
+	EditionMP Edition = "MP"
+	EditionSE Edition = "SE"
+	EditionBE Edition = "BE" // Basic edition, called IC before Stata 17
+)
+
+// ErrStataNotFound is returned by FindStata when no Stata executable can be found.
+var ErrStataNotFound = errors.New("stata executable not found")
+
+// Runner runs do-files with a given Stata executable.
+// The zero value is not usable; use NewRunner or FindStata.
+type Runner struct {
+	Executable string   // path of the console (batch) Stata executable
+	Edition    Edition  // informational; inferred from the executable name by NewRunner
+	Flags      []string // extra command-line flags, passed before the do-file
+	Env        []string // extra "KEY=value" environment variables, added to the current environment
+}
+
+// NewRunner returns a Runner for executable, which may be a path or a name looked up in PATH
+// when run.
+func NewRunner(executable string) *Runner {
+	return &Runner{Executable: executable, Edition: editionOf(executable)}
+}
+
+var defaultRunner = sync.OnceValue(func() *Runner {
+	r, err := FindStata()
+	if err != nil {
+		return NewRunner(stataShellCommand)
+	}
+	return r
+})
+
+// DefaultRunner returns the runner used by the package-level Run functions: the first Stata
+// found by FindStata, or "stata-mp" looked up in PATH if none is found.
+// It is discovered once, on first use.
+func DefaultRunner() *Runner {
+	return defaultRunner()
+}
+
+// StataPathEnv names the environment variable that FindStata checks first. It may hold the
+// path of the executable or of the directory it is installed in.
+const StataPathEnv = "STATA_PATH"
+
+// stataNames are the console executables in order of preference.
+var stataNames = []string{"stata-mp", "stata-se", "stata", "StataMP-64.exe", "StataSE-64.exe", "StataBE-64.exe", "Stata-64.exe"}
+
+// stataLocations are glob patterns of the usual install directories, newest versions first
+// after sorting.
+var stataLocations = []string{
+	"/usr/local/stata*",
+	"/opt/stata*",
+	"/Applications/Stata*/Stata*.app/Contents/MacOS",
+	"/Applications/Stata*",
+	`C:\Program Files\Stata*`,
+	`C:\Program Files (x86)\Stata*`,
+}
+
+// FindStata looks for a Stata executable in the directory or file named by $STATA_PATH,
+// then in PATH, then in the usual install locations, preferring MP over SE over BE.
+func FindStata() (*Runner, error) {
+	if p := os.Getenv(StataPathEnv); p != "" {
+		if exe, ok := findInDir(p); ok {
+			return NewRunner(exe), nil
+		}
+		if isExecutable(p) {
+			return NewRunner(p), nil
+		}
+		return nil, fmt.Errorf("%w: %s=%s", ErrStataNotFound, StataPathEnv, p)
+	}
+	for _, name := range stataNames {
+		if exe, err := exec.LookPath(name); err == nil {
+			return NewRunner(exe), nil
+		}
+	}
+	for _, pattern := range stataLocations {
+		dirs, _ := filepath.Glob(pattern)
+		// stata18 before stata17 before stata
+		sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+		for _, dir := range dirs {
+			if exe, ok := findInDir(dir); ok {
+				return NewRunner(exe), nil
+			}
+		}
+	}
+	return nil, ErrStataNotFound
+}
+
+func findInDir(dir string) (string, bool) {
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return "", false
+	}
+	for _, name := range stataNames {
+		exe := filepath.Join(dir, name)
+		if isExecutable(exe) {
+			return exe, true
+		}
+	}
+	return "", false
+}
+
+func isExecutable(fileName string) bool {
+	fi, err := os.Stat(fileName)
+	if err != nil || fi.IsDir() {
+		return false
+	}
+	return runtime.GOOS == "windows" || fi.Mode()&0111 != 0
+}
+
+func editionOf(executable string) Edition {
+	name := strings.ToLower(filepath.Base(executable))
+	switch {
+	case strings.Contains(name, "mp"):
+		return EditionMP
+	case strings.Contains(name, "se"):
+		return EditionSE
+	}
+	return EditionBE
+}
+
+// RunScript runs script wrapped in a qui block and returns the "key=value" pairs it displayed.
+// The temporary do-file and its log are removed in all cases.
+func (r *Runner) RunScript(ctx context.Context, workDir, script string) (map[string]string, error) {
+	out, err := r.runDo(ctx, workDir, "qui {\n"+script+"\n}\n")
+	if err != nil {
+		return nil, err
+	}
+	return GetKeyValuePairs(out), nil
+}
+
+// runDo saves content to a temporary do-file in workDir, runs it and returns the log.
+// The do-file and its log are removed in all cases.
+func (r *Runner) runDo(ctx context.Context, workDir, content string) (string, error) {
+	const errmsg = "error running Stata script: %w"
+	fname, err := SaveToTempFile(workDir, content, "do")
+	if err != nil {
+		return "", fmt.Errorf(errmsg, err)
+	}
+	defer os.Remove(fname) // Clean up the temporary file
+	defer os.Remove(logName(workDir, fname))
+	// a relative path would be resolved by Stata against workDir, not the current directory
+	if fname, err = filepath.Abs(fname); err != nil {
+		return "", fmt.Errorf(errmsg, err)
+	}
+	out, err := r.RunDo(ctx, workDir, fname)
+	if err != nil {
+		return out, fmt.Errorf(errmsg, err)
+	}
+	return out, nil
+}
+
+// RunDo runs doFileName in batch mode with workDir as the working directory of Stata and
+// returns the log. If the do-file stopped with an error, the log is returned with a
+// *StataError. It does not change the working directory of the Go process, so runs in
+// different (or the same) directories can proceed in parallel as long as their do-files
+// have different names. When ctx is done the Stata process tree is killed.
+func (r *Runner) RunDo(ctx context.Context, workDir, doFileName string) (output string, err error) {
+	cmd := r.command(ctx, append(r.batchFlags(), doFileName)...)
+	cmd.Dir = workDir //Stata creates log file in this directory
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", contextError(ctxErr)
+		}
+		return "", err
+	}
+	cmdOut, err := os.ReadFile(logName(workDir, doFileName))
+	if err != nil {
+		return "", err
+	}
+	if serr := ParseLogError(string(cmdOut)); serr != nil {
+		return string(cmdOut), serr
+	}
+	return string(cmdOut), nil
+}
+
+// Version runs a one-line do-file to report the Stata version, eg "18" or "17.0".
+func (r *Runner) Version(ctx context.Context) (string, error) {
+	dir, err := os.MkdirTemp("", "gostata-version-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	dict, err := r.RunScript(ctx, dir, `noi display "stata_version=" c(stata_version)`)
+	if err != nil {
+		return "", err
+	}
+	version, ok := dict["stata_version"]
+	if !ok {
+		return "", fmt.Errorf("%s did not report its version", r.Executable)
+	}
+	return version, nil
+}
+
+// command returns a command running the executable with args, the runner's environment
+// and process-tree cancellation.
+func (r *Runner) command(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, r.Executable, args...)
+	if len(r.Env) > 0 {
+		cmd.Env = append(os.Environ(), r.Env...)
+	}
+	killProcessTree(cmd)
+	cmd.WaitDelay = killGrace
+	return cmd
+}
+
+// batchFlags returns the flags running a do-file and exiting: -q -e on Unix, /q /e on Windows.
+func (r *Runner) batchFlags() []string {
+	flags := []string{"-q", "-e"}
+	if runtime.GOOS == "windows" {
+		flags = []string{"/q", "/e"}
+	}
+	return append(flags, r.Flags...)
+}
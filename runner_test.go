@@ -0,0 +1,128 @@
+package gostata
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// installFake writes an executable file named name in dir.
+func installFake(t *testing.T, dir, name string) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	fileName := filepath.Join(dir, name)
+	if err := os.WriteFile(fileName, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func TestFindStata(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("install locations differ on Windows")
+	}
+	root := t.TempDir()
+	saved := stataLocations
+	defer func() { stataLocations = saved }()
+	stataLocations = []string{filepath.Join(root, "stata*")}
+	empty := filepath.Join(root, "empty")
+	os.Mkdir(empty, 0755)
+
+	t.Run("STATA_PATH directory", func(t *testing.T) {
+		dir := filepath.Join(root, "env")
+		installFake(t, dir, "stata")
+		want := installFake(t, dir, "stata-se")
+		t.Setenv(StataPathEnv, dir)
+		r, err := FindStata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Executable != want || r.Edition != EditionSE {
+			t.Errorf("got %s (%s), want %s (SE)", r.Executable, r.Edition, want)
+		}
+	})
+	t.Run("STATA_PATH file", func(t *testing.T) {
+		want := installFake(t, filepath.Join(root, "custom"), "my-stata")
+		t.Setenv(StataPathEnv, want)
+		r, err := FindStata()
+		if err != nil || r.Executable != want {
+			t.Errorf("got %v, %v; want %s", r, err, want)
+		}
+	})
+	t.Run("STATA_PATH missing", func(t *testing.T) {
+		t.Setenv(StataPathEnv, filepath.Join(root, "nowhere"))
+		if _, err := FindStata(); !errors.Is(err, ErrStataNotFound) {
+			t.Errorf("expected ErrStataNotFound, got %v", err)
+		}
+	})
+	t.Run("PATH", func(t *testing.T) {
+		dir := filepath.Join(root, "bin")
+		want := installFake(t, dir, "stata-mp")
+		t.Setenv(StataPathEnv, "")
+		t.Setenv("PATH", empty+string(os.PathListSeparator)+dir)
+		r, err := FindStata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Executable != want || r.Edition != EditionMP {
+			t.Errorf("got %s (%s), want %s (MP)", r.Executable, r.Edition, want)
+		}
+	})
+	t.Run("install locations", func(t *testing.T) {
+		t.Setenv(StataPathEnv, "")
+		t.Setenv("PATH", empty)
+		if _, err := FindStata(); !errors.Is(err, ErrStataNotFound) {
+			t.Fatalf("expected ErrStataNotFound, got %v", err)
+		}
+		installFake(t, filepath.Join(root, "stata17"), "stata-mp")
+		want := installFake(t, filepath.Join(root, "stata18"), "stata-se")
+		r, err := FindStata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Executable != want {
+			t.Errorf("got %s, want the newest version %s", r.Executable, want)
+		}
+	})
+}
+
+func TestRunnerFlagsAndEnv(t *testing.T) {
+	// the fake logs its arguments and environment; the do-file is the last argument
+	exe := writeFakeStata(t, `for a; do last=$a; done
+base=$(basename "$last" .do)
+echo "args=$*" > "$base.log"
+echo "greeting=$GREETING" >> "$base.log"
+`)
+	r := NewRunner(exe)
+	r.Flags = []string{"-b"}
+	r.Env = []string{"GREETING=hello"}
+	out, err := r.RunDo(context.Background(), t.TempDir(), "job.do")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dict := GetKeyValuePairs(out)
+	if dict["args"] != "-q -e -b job.do" || dict["greeting"] != "hello" {
+		t.Errorf("unexpected log %q", out)
+	}
+}
+
+func TestRunnerVersion(t *testing.T) {
+	exe := writeFakeStata(t, `base=$(basename "$3" .do)
+grep -q 'c(stata_version)' "$3" && echo "stata_version=18.5" > "$base.log"
+`)
+	version, err := NewRunner(exe).Version(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "18.5" {
+		t.Errorf("got version %q, want 18.5", version)
+	}
+	if e := NewRunner("/usr/local/stata18/stata-mp").Edition; e != EditionMP {
+		t.Errorf("got edition %s for stata-mp", e)
+	}
+}
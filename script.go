@@ -0,0 +1,444 @@
+package gostata
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Script builds a do-file from typed commands, checking names and quoting strings so the
+// result is valid Stata syntax. Methods return the script for chaining; the first error is
+// kept and reported by Build, eg
+//
+//	s := NewScript().
+//		Use("survey.dta").
+//		Gen("adult", "age >= 18", If("!missing(age)")).
+//		LabelDefine(yesno).
+//		LabelValues("yesno", "adult").
+//		Save("out.dta")
+//	script, err := s.Build()
+//
+// The script can be passed to RunScript or RunResults.
+type Script struct {
+	lines []string
+	err   error
+}
+
+// NewScript returns an empty script.
+func NewScript() *Script {
+	return &Script{}
+}
+
+// Qualifier restricts a command to some observations: an if or in qualifier.
+type Qualifier struct {
+	text string
+	err  error
+}
+
+// If returns an if qualifier for the Stata expression expr, eg If("age >= 18").
+func If(expr string) Qualifier {
+	if err := checkExpr(expr); err != nil {
+		return Qualifier{err: err}
+	}
+	return Qualifier{text: "if " + expr}
+}
+
+// In returns an in qualifier for observations first to last. As in Stata, negative
+// numbers count from the end: In(-5, -1) selects the last five observations.
+func In(first, last int) Qualifier {
+	if first == 0 || last == 0 {
+		return Qualifier{err: fmt.Errorf("invalid range %d/%d: observations are numbered from 1", first, last)}
+	}
+	if first > 0 && last > 0 && first > last {
+		return Qualifier{err: fmt.Errorf("invalid range %d/%d", first, last)}
+	}
+	return Qualifier{text: fmt.Sprintf("in %d/%d", first, last)}
+}
+
+// CollapseStat is a statistic computed by Collapse, eg (mean) income_mean=income.
+type CollapseStat struct {
+	Stat   string // eg mean, sum, count, max or p50
+	Target string // name of the result; defaults to Source
+	Source string // variable summarized
+}
+
+// collapseStats are the statistics of collapse other than percentiles.
+var collapseStats = map[string]bool{
+	"mean": true, "median": true, "sd": true, "semean": true, "sebinomial": true, "sepoisson": true,
+	"sum": true, "rawsum": true, "count": true, "percent": true, "max": true, "min": true,
+	"iqr": true, "first": true, "last": true, "firstnm": true, "lastnm": true,
+}
+
+var (
+	percentileStat  = regexp.MustCompile(`^p([1-9]|[1-9][0-9])$`)
+	numericFormat   = regexp.MustCompile(`^%[-~]?0?[0-9]*([.,][0-9]+)?[efg]c?$|^%21x$`)
+	stringFormat    = regexp.MustCompile(`^%[-~]?[0-9]+s$`)
+	dateFormat      = regexp.MustCompile(`^%-?(t[cCdwmqhyb]|d)[^\s"'` + "`" + `$]*$`)
+	storageTypeName = regexp.MustCompile(`^(byte|int|long|float|double|strL|str([1-9][0-9]{0,3}))$`)
+)
+
+// Build returns the script, or the first error found while building it.
+func (s *Script) Build() (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	return s.String(), nil
+}
+
+// String returns the script built so far, one command per line.
+func (s *Script) String() string {
+	if len(s.lines) == 0 {
+		return ""
+	}
+	return strings.Join(s.lines, "\n") + "\n"
+}
+
+// Err returns the first error found while building the script.
+func (s *Script) Err() error {
+	return s.err
+}
+
+// add appends a command unless an error occurred before.
+func (s *Script) add(command string, err error) *Script {
+	if s.err != nil {
+		return s
+	}
+	if err != nil {
+		name, _, _ := strings.Cut(command, " ")
+		s.err = fmt.Errorf("%s: %w", name, err)
+		return s
+	}
+	s.lines = append(s.lines, command)
+	return s
+}
+
+// Raw appends a command verbatim. It is not checked: prefer the typed methods.
+func (s *Script) Raw(command string) *Script {
+	if strings.ContainsAny(command, "\r\n") {
+		return s.add(command, fmt.Errorf("command spans several lines"))
+	}
+	return s.add(command, nil)
+}
+
+// Use loads a dataset, replacing the data in memory. If vars are given only they are loaded.
+func (s *Script) Use(file string, vars ...string) *Script {
+	q, err := QuoteString(file)
+	if err == nil {
+		err = checkNames(vars)
+	}
+	if len(vars) > 0 {
+		return s.add("use "+strings.Join(vars, " ")+" using "+q+", clear", err)
+	}
+	return s.add("use "+q+", clear", err)
+}
+
+// Save saves the data in memory to file, replacing it if it exists.
+func (s *Script) Save(file string) *Script {
+	q, err := QuoteString(file)
+	return s.add("save "+q+", replace", err)
+}
+
+// Gen creates variable name from the Stata expression expr; observations excluded by
+// the qualifiers are missing.
+func (s *Script) Gen(name, expr string, qual ...Qualifier) *Script {
+	return s.gen("generate", "", name, expr, qual)
+}
+
+// GenType is Gen with a storage type, eg "double" or "str20".
+func (s *Script) GenType(typ, name, expr string, qual ...Qualifier) *Script {
+	if !storageTypeName.MatchString(typ) {
+		return s.add("generate", fmt.Errorf("invalid storage type %q", typ))
+	}
+	return s.gen("generate", typ, name, expr, qual)
+}
+
+// Replace changes the values of variable name to expr, in the observations selected by
+// the qualifiers.
+func (s *Script) Replace(name, expr string, qual ...Qualifier) *Script {
+	return s.gen("replace", "", name, expr, qual)
+}
+
+func (s *Script) gen(command, typ, name, expr string, qual []Qualifier) *Script {
+	err := ValidateName(name)
+	if err == nil {
+		err = checkExpr(expr)
+	}
+	q, qerr := qualifiers(qual)
+	if err == nil {
+		err = qerr
+	}
+	if typ != "" {
+		command += " " + typ
+	}
+	return s.add(command+" "+name+" = "+expr+q, err)
+}
+
+// Rename renames a variable.
+func (s *Script) Rename(oldName, newName string) *Script {
+	return s.add("rename "+oldName+" "+newName, checkNames([]string{oldName, newName}))
+}
+
+// LabelVariable attaches a label to a variable.
+func (s *Script) LabelVariable(name, label string) *Script {
+	err := ValidateName(name)
+	if len(label) > maxLabelLen {
+		err = fmt.Errorf("label of %s is longer than %d characters", name, maxLabelLen)
+	}
+	q, qerr := QuoteString(label)
+	if err == nil {
+		err = qerr
+	}
+	return s.add("label variable "+name+" "+q, err)
+}
+
+// LabelData sets the dataset label.
+func (s *Script) LabelData(label string) *Script {
+	var err error
+	if len(label) > maxLabelLen {
+		err = fmt.Errorf("dataset label is longer than %d characters", maxLabelLen)
+	}
+	q, qerr := QuoteString(label)
+	if err == nil {
+		err = qerr
+	}
+	return s.add("label data "+q, err)
+}
+
+// Note adds a note to variable name, or to the dataset if name is empty.
+func (s *Script) Note(name, text string) *Script {
+	err := checkText(text)
+	if name == "" {
+		return s.add("notes: "+escapeMacros(text), err)
+	}
+	if err == nil {
+		err = ValidateName(name)
+	}
+	return s.add("notes "+name+": "+escapeMacros(text), err)
+}
+
+// Char sets characteristic char of variable name, or of the dataset if name is empty.
+func (s *Script) Char(name, char, text string) *Script {
+	err := checkText(text)
+	if name == "" {
+		name = "_dta"
+	} else if err == nil {
+		err = ValidateName(name)
+	}
+	if err == nil {
+		err = ValidateName(char)
+	}
+	return s.add("char "+name+"["+char+"] "+escapeMacros(text), err)
+}
+
+// LabelDefine defines the value label vl, replacing any label of the same name.
+func (s *Script) LabelDefine(vl *ValueLabel) *Script {
+	err := ValidateName(vl.Name)
+	var sb strings.Builder
+	sb.WriteString("label define " + vl.Name)
+	for _, v := range vl.Values() {
+		text, _ := vl.Label(v)
+		q, qerr := QuoteString(text)
+		if err == nil {
+			err = qerr
+		}
+		sb.WriteString(" " + strconv.Itoa(int(v)) + " " + q)
+	}
+	sb.WriteString(", replace")
+	if vl.Len() == 0 && err == nil {
+		err = fmt.Errorf("value label %s has no values", vl.Name)
+	}
+	return s.add(sb.String(), err)
+}
+
+// LabelValues attaches the value label called label to vars. An empty label detaches
+// the value labels of vars.
+func (s *Script) LabelValues(label string, vars ...string) *Script {
+	err := checkVarlist(vars)
+	if label == "" {
+		return s.add("label values "+strings.Join(vars, " ")+" .", err)
+	}
+	if err == nil {
+		err = ValidateName(label)
+	}
+	return s.add("label values "+strings.Join(vars, " ")+" "+label, err)
+}
+
+// Format sets the display format of vars, eg "%9.2f", "%-20s" or "%td".
+func (s *Script) Format(format string, vars ...string) *Script {
+	err := checkVarlist(vars)
+	if err == nil {
+		err = ValidateFormat(format)
+	}
+	return s.add("format "+strings.Join(vars, " ")+" "+format, err)
+}
+
+// Keep keeps the variables vars.
+func (s *Script) Keep(vars ...string) *Script {
+	return s.add("keep "+strings.Join(vars, " "), checkVarlist(vars))
+}
+
+// Drop drops the variables vars.
+func (s *Script) Drop(vars ...string) *Script {
+	return s.add("drop "+strings.Join(vars, " "), checkVarlist(vars))
+}
+
+// KeepObs keeps the observations selected by the qualifiers.
+func (s *Script) KeepObs(qual ...Qualifier) *Script {
+	return s.obs("keep", qual)
+}
+
+// DropObs drops the observations selected by the qualifiers.
+func (s *Script) DropObs(qual ...Qualifier) *Script {
+	return s.obs("drop", qual)
+}
+
+func (s *Script) obs(command string, qual []Qualifier) *Script {
+	q, err := qualifiers(qual)
+	if q == "" && err == nil {
+		err = fmt.Errorf("no if or in qualifier")
+	}
+	return s.add(command+q, err)
+}
+
+// Sort sorts the observations by vars.
+func (s *Script) Sort(vars ...string) *Script {
+	return s.add("sort "+strings.Join(vars, " "), checkVarlist(vars))
+}
+
+// Merge merges the dataset in file into the data in memory on the key variables, like
+// Dataset.Merge. A nil *MergeOptions uses the defaults.
+func (s *Script) Merge(kind MergeKind, keys []string, file string, opts *MergeOptions) *Script {
+	if opts == nil {
+		opts = &MergeOptions{}
+	}
+	err := checkVarlist(keys)
+	q, qerr := QuoteString(file)
+	if err == nil {
+		err = qerr
+	}
+	var options []string
+	switch {
+	case opts.NoGenerate:
+		options = append(options, "nogenerate")
+	case opts.Generate != "":
+		if err == nil {
+			err = ValidateName(opts.Generate)
+		}
+		options = append(options, "generate("+opts.Generate+")")
+	}
+	if len(opts.KeepUsing) > 0 {
+		if err == nil {
+			err = checkVarlist(opts.KeepUsing)
+		}
+		options = append(options, "keepusing("+strings.Join(opts.KeepUsing, " ")+")")
+	}
+	if opts.NoLabel {
+		options = append(options, "nolabel")
+	}
+	command := "merge " + kind.String() + " " + strings.Join(keys, " ") + " using " + q
+	if len(options) > 0 {
+		command += ", " + strings.Join(options, " ")
+	}
+	return s.add(command, err)
+}
+
+// Collapse replaces the data with the statistics by groups of the by variables, or a
+// single observation if there are none.
+func (s *Script) Collapse(stats []CollapseStat, by ...string) *Script {
+	var err error
+	if len(stats) == 0 {
+		err = fmt.Errorf("no statistics")
+	}
+	var sb strings.Builder
+	sb.WriteString("collapse")
+	for _, st := range stats {
+		if err == nil && !collapseStats[st.Stat] && !percentileStat.MatchString(st.Stat) {
+			err = fmt.Errorf("unknown statistic %q", st.Stat)
+		}
+		if err == nil {
+			err = ValidateName(st.Source)
+		}
+		sb.WriteString(" (" + st.Stat + ") ")
+		if st.Target != "" && st.Target != st.Source {
+			if err == nil {
+				err = ValidateName(st.Target)
+			}
+			sb.WriteString(st.Target + "=")
+		}
+		sb.WriteString(st.Source)
+	}
+	if len(by) > 0 {
+		if err == nil {
+			err = checkNames(by)
+		}
+		sb.WriteString(", by(" + strings.Join(by, " ") + ")")
+	}
+	return s.add(sb.String(), err)
+}
+
+// ValidateFormat returns an error if format is not a Stata display format such as
+// %9.0g, %10.2fc, %-20s or %tdCCYY-NN-DD.
+func ValidateFormat(format string) error {
+	if numericFormat.MatchString(format) || stringFormat.MatchString(format) || dateFormat.MatchString(format) {
+		return nil
+	}
+	return fmt.Errorf("invalid format %q", format)
+}
+
+// checkExpr rejects expressions that would not fit on a command line.
+func checkExpr(expr string) error {
+	if strings.TrimSpace(expr) == "" {
+		return fmt.Errorf("empty expression")
+	}
+	if strings.ContainsAny(expr, "\r\n") {
+		return fmt.Errorf("expression %q spans several lines", expr)
+	}
+	return nil
+}
+
+// checkText rejects text that would not fit on a command line.
+func checkText(text string) error {
+	if strings.ContainsAny(text, "\r\n") {
+		return fmt.Errorf("text %q spans several lines", text)
+	}
+	return nil
+}
+
+// checkVarlist checks a list of at least one name.
+func checkVarlist(names []string) error {
+	if len(names) == 0 {
+		return fmt.Errorf("no variables")
+	}
+	return checkNames(names)
+}
+
+func checkNames(names []string) error {
+	for _, name := range names {
+		if err := ValidateName(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// qualifiers returns the qualifiers as text, preceded by a space.
+func qualifiers(qual []Qualifier) (string, error) {
+	var sb strings.Builder
+	seen := make(map[string]bool)
+	for _, q := range qual {
+		if q.err != nil {
+			return "", q.err
+		}
+		kind, _, _ := strings.Cut(q.text, " ")
+		if kind == "" {
+			return "", fmt.Errorf("empty qualifier")
+		}
+		if seen[kind] {
+			return "", fmt.Errorf("more than one %s qualifier", kind)
+		}
+		seen[kind] = true
+		sb.WriteString(" " + q.text)
+	}
+	return sb.String(), nil
+}
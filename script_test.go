@@ -0,0 +1,96 @@
+package gostata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScript(t *testing.T) {
+	yesno := NewValueLabel("yesno")
+	yesno.Set(0, "No")
+	yesno.Set(1, `Yes, "really"`)
+	got, err := NewScript().
+		Use("data/survey 2024.dta").
+		Gen("adult", "age >= 18", If("!missing(age)")).
+		GenType("str20", "group", `"none"`).
+		Replace("group", `"senior"`, If("age >= 65"), In(1, -1)).
+		Rename("inc", "income").
+		LabelVariable("adult", "Aged 18 or more").
+		LabelDefine(yesno).
+		LabelValues("yesno", "adult").
+		Format("%9.2fc", "income").
+		Format("%tdCCYY-NN-DD", "born").
+		DropObs(If("income < 0")).
+		Keep("id", "adult", "income", "born", "group").
+		Sort("id").
+		Merge(ManyToOne, []string{"id"}, "regions.dta", &MergeOptions{NoGenerate: true, KeepUsing: []string{"region"}}).
+		Collapse([]CollapseStat{{Stat: "mean", Source: "income"}, {Stat: "p50", Target: "median_income", Source: "income"}, {Stat: "count", Target: "n", Source: "id"}}, "region").
+		Save("out.dta").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "use `\"data/survey 2024.dta\"', clear\n" +
+		"generate adult = age >= 18 if !missing(age)\n" +
+		"generate str20 group = \"none\"\n" +
+		"replace group = \"senior\" if age >= 65 in 1/-1\n" +
+		"rename inc income\n" +
+		"label variable adult `\"Aged 18 or more\"'\n" +
+		"label define yesno 0 `\"No\"' 1 `\"Yes, \"really\"\"', replace\n" +
+		"label values adult yesno\n" +
+		"format income %9.2fc\n" +
+		"format born %tdCCYY-NN-DD\n" +
+		"drop if income < 0\n" +
+		"keep id adult income born group\n" +
+		"sort id\n" +
+		"merge m:1 id using `\"regions.dta\"', nogenerate keepusing(region)\n" +
+		"collapse (mean) income (p50) median_income=income (count) n=id, by(region)\n" +
+		"save `\"out.dta\"', replace\n"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestScriptErrors(t *testing.T) {
+	empty := NewValueLabel("empty")
+	tests := []struct {
+		name   string
+		script *Script
+		want   string
+	}{
+		{"invalid variable", NewScript().Gen("2x", "1"), `generate: invalid name "2x"`},
+		{"reserved word", NewScript().Keep("id", "_n"), "reserved word"},
+		{"no variables", NewScript().Drop(), "drop: no variables"},
+		{"multiline expression", NewScript().Replace("x", "1\ndrop y"), "spans several lines"},
+		{"bad qualifier", NewScript().Gen("x", "1", In(0, 5)), "observations are numbered from 1"},
+		{"two ifs", NewScript().Gen("x", "1", If("a"), If("b")), "more than one if qualifier"},
+		{"no qualifier", NewScript().KeepObs(), "keep: no if or in qualifier"},
+		{"storage type", NewScript().GenType("string", "x", "1"), `invalid storage type "string"`},
+		{"format", NewScript().Format("9.2f", "x"), `invalid format "9.2f"`},
+		{"empty label", NewScript().LabelDefine(empty), "has no values"},
+		{"statistic", NewScript().Collapse([]CollapseStat{{Stat: "avg", Source: "x"}}), `unknown statistic "avg"`},
+		{"quote", NewScript().Save(`out"'.dta`), "unbalanced compound quotes"},
+		{"first error kept", NewScript().Sort("a b").Sort("1"), `sort: invalid name "a b"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.script.Build()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateFormat(t *testing.T) {
+	for _, f := range []string{"%9.0g", "%10.2fc", "%-9.0g", "%12,2f", "%8.0e", "%21x", "%-20s", "%~12s", "%td", "%tdCCYY-NN-DD", "%tc", "%tm", "%d"} {
+		if err := ValidateFormat(f); err != nil {
+			t.Errorf("ValidateFormat(%q): %v", f, err)
+		}
+	}
+	for _, f := range []string{"", "%", "9.0g", "%9.0", "%s", "%9.2f x", "%td`x'"} {
+		if err := ValidateFormat(f); err == nil {
+			t.Errorf("ValidateFormat(%q) accepted", f)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package gostata
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSessionClosed is returned by Session.Exec after the session was closed or its Stata
+// process ended.
+var ErrSessionClosed = errors.New("stata session closed")
+
+// Session is a console Stata process kept alive between commands, so data loaded by one
+// Exec is available to the next. Commands are run one Exec at a time; a Session is safe for
+// use by multiple goroutines.
+//
+// Each Exec saves its commands to a do-file and runs it with capture noisily do, followed by
+// a display of a unique sentinel and the return code, which marks the end of its output.
+type Session struct {
+	dir      string // holds the do-files; also the working directory of Stata
+	sentinel string
+	mu       sync.Mutex
+	n        int
+	stdin    io.WriteCloser
+	lines    chan string
+	done     chan struct{} // closed when the process has exited
+	kill     func() error
+	closed   bool
+}
+
+// StartSession starts a console Stata in workDir, or in a new temporary directory if workDir
+// is empty. The process is killed when ctx is done; use Close to end it gracefully.
+func (r *Runner) StartSession(ctx context.Context, workDir string) (*Session, error) {
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	s := &Session{
+		sentinel: "__gostata_" + hex.EncodeToString(token) + "__",
+		lines:    make(chan string, 256),
+		done:     make(chan struct{}),
+	}
+	dir, err := os.MkdirTemp(workDir, "gostata-session-*")
+	if err != nil {
+		return nil, err
+	}
+	if s.dir, err = filepath.Abs(dir); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	cmd := r.command(ctx, append([]string{"-q"}, r.Flags...)...)
+	cmd.Dir = s.dir
+	if workDir != "" {
+		cmd.Dir = workDir
+	}
+	if s.stdin, err = cmd.StdinPipe(); err != nil {
+		os.RemoveAll(s.dir)
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		os.RemoveAll(s.dir)
+		return nil, err
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(s.dir)
+		return nil, err
+	}
+	s.kill = cmd.Cancel
+	go func() {
+		sc := bufio.NewScanner(stdout)
+		sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for sc.Scan() {
+			s.lines <- strings.TrimRight(sc.Text(), "\r")
+		}
+		close(s.lines)
+		cmd.Wait()
+		close(s.done)
+	}()
+	// wait until Stata reads commands
+	if _, err := s.Exec(ctx, ""); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("starting stata session: %w", err)
+	}
+	return s, nil
+}
+
+// Exec runs commands, one or more lines of a do-file, and returns their output.
+// If a command fails the remaining commands are skipped and the output is returned with
+// a *StataError; the session remains usable. If ctx is done before the commands complete,
+// the Stata process is killed and the session closed.
+func (s *Session) Exec(ctx context.Context, commands string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return "", ErrSessionClosed
+	}
+	s.n++
+	doFile := filepath.Join(s.dir, fmt.Sprintf("cmd%d.do", s.n))
+	if err := os.WriteFile(doFile, []byte(commands+"\n"), 0o644); err != nil {
+		return "", err
+	}
+	defer os.Remove(doFile)
+	marker := fmt.Sprintf("%s%d", s.sentinel, s.n)
+	run := fmt.Sprintf("capture noisily do `\"%s\"'", doFile)
+	show := fmt.Sprintf("display \"%s \" _rc", marker)
+	if _, err := io.WriteString(s.stdin, run+"\n"+show+"\n"); err != nil {
+		s.closeLocked(true)
+		return "", fmt.Errorf("%w: %v", ErrSessionClosed, err)
+	}
+	var out []string
+	echo := &echoFilter{commands: []string{run, show}}
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				s.closeLocked(false)
+				return strings.Join(echo.flush(out), "\n"), fmt.Errorf("%w: stata exited", ErrSessionClosed)
+			}
+			rest, isMarker := strings.CutPrefix(line, marker+" ")
+			if !isMarker {
+				out = echo.add(out, line)
+				continue
+			}
+			output := strings.Join(echo.flush(out), "\n")
+			rc, err := strconv.Atoi(strings.TrimSpace(rest))
+			if err != nil {
+				return output, fmt.Errorf("invalid return code %q", rest)
+			}
+			if rc != 0 {
+				if serr := ParseLogError(output); serr != nil {
+					return output, serr
+				}
+				return output, &StataError{Code: rc}
+			}
+			return output, nil
+		case <-ctx.Done():
+			s.closeLocked(true)
+			return strings.Join(echo.flush(out), "\n"), contextError(ctx.Err())
+		}
+	}
+}
+
+// echoFilter drops the echo of the commands Exec sends around a do-file from its output.
+// Stata wraps the echo of a long command onto continuation lines starting with "> ", so
+// an echo line that begins a command is held until the lines after it show whether they
+// complete the command.
+type echoFilter struct {
+	commands []string
+	held     []string // lines that may be the echo of a wrapped command
+	text     string   // text of the held lines, without prompts and spaces
+}
+
+// add appends line to out unless it is part of the echo of a command.
+func (f *echoFilter) add(out []string, line string) []string {
+	if len(f.held) > 0 {
+		if rest, ok := strings.CutPrefix(line, "> "); ok {
+			f.held = append(f.held, line)
+			f.text += strings.ReplaceAll(rest, " ", "")
+			complete, partial := f.match(f.text)
+			if complete {
+				f.held = nil
+			}
+			if complete || partial {
+				return out
+			}
+			return f.flush(out)
+		}
+		out = f.flush(out)
+	}
+	text := strings.ReplaceAll(strings.TrimPrefix(line, ". "), " ", "")
+	complete, partial := f.match(text)
+	switch {
+	case complete:
+		return out
+	case partial:
+		f.held, f.text = []string{line}, text
+		return out
+	}
+	return append(out, line)
+}
+
+// match reports whether text, stripped of spaces, is a whole command or only its start.
+func (f *echoFilter) match(text string) (complete, partial bool) {
+	for _, c := range f.commands {
+		c = strings.ReplaceAll(c, " ", "")
+		if text == c {
+			return true, false
+		}
+		if text != "" && strings.HasPrefix(c, text) {
+			partial = true
+		}
+	}
+	return false, partial
+}
+
+// flush appends the held lines to out: they were not the echo of a command after all.
+func (f *echoFilter) flush(out []string) []string {
+	out = append(out, f.held...)
+	f.held = nil
+	return out
+}
+
+// Close ends the Stata process, killing it if it does not exit within a few seconds,
+// and removes the session's temporary files.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	io.WriteString(s.stdin, "exit, clear\n")
+	s.closeLocked(false)
+	return nil
+}
+
+// closeLocked closes stdin and waits for the process to exit, killing it at once if kill
+// is set or after killGrace otherwise.
+func (s *Session) closeLocked(kill bool) {
+	s.closed = true
+	s.stdin.Close()
+	// drain the output so the reader goroutine can finish
+	go func() {
+		for range s.lines {
+		}
+	}()
+	if kill {
+		s.kill()
+	}
+	select {
+	case <-s.done:
+	case <-time.After(killGrace):
+		s.kill()
+		<-s.done
+	}
+	os.RemoveAll(s.dir)
+}
+
+func (s *Session) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
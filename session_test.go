@@ -0,0 +1,155 @@
+package gostata
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// consoleFake emulates console Stata reading commands from stdin: it echoes the commands,
+// wrapping them at 79 characters, and the lines of each do-file, fails on a line starting
+// with "fail", remembers "set x" across commands until "clear all" and sleeps on "sleep".
+const consoleFake = `rc=0
+x=unset
+while IFS= read -r line; do
+	s=". $line"
+	while [ ${#s} -gt 79 ]; do
+		printf '%s\n' "$s" | cut -c1-79
+		s="> $(printf '%s\n' "$s" | cut -c80-)"
+	done
+	printf '%s\n' "$s"
+	case "$line" in
+	'capture noisily do '*)
+		f=${line#capture noisily do \` + "`" + `\"}
+		f=${f%\"\'}
+		rc=0
+		while IFS= read -r cmd; do
+			[ -z "$cmd" ] && continue
+			echo ". $cmd"
+			case "$cmd" in
+			fail*) echo "command fail is unrecognized"; echo "r(199);"; rc=199; break ;;
+			"set x "*) x=${cmd#set x } ;;
+			"display x") echo "$x" ;;
+			"clear all") x=unset ;;
+			sleep) sleep 30 ;;
+			esac
+		done < "$f"
+		echo "end of do-file" ;;
+	'display "'*)
+		tok=${line#display \"}
+		echo "${tok%% *} $rc" ;;
+	exit*) exit 0 ;;
+	esac
+done
+`
+
+func TestSession(t *testing.T) {
+	exe := writeFakeStata(t, consoleFake)
+	ctx := context.Background()
+	s, err := NewRunner(exe).StartSession(ctx, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Exec(ctx, "set x 42"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := s.Exec(ctx, "display x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "\n42\n") || strings.Contains(out, "capture noisily") || strings.Contains(out, "__gostata_") {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	out, err = s.Exec(ctx, "set x 1\nfail now\nset x 2")
+	var serr *StataError
+	if !errors.As(err, &serr) || serr.Code != 199 || serr.Command != "fail now" {
+		t.Fatalf("expected r(199), got %v", err)
+	}
+	if !strings.Contains(out, "command fail is unrecognized") {
+		t.Errorf("unexpected output %q", out)
+	}
+	// the session survives errors and the commands after the failing one were skipped
+	if out, err = s.Exec(ctx, "display x"); err != nil || !strings.Contains(out, "\n1\n") {
+		t.Errorf("got %q, %v", out, err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Exec(ctx, "display x"); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("expected ErrSessionClosed, got %v", err)
+	}
+}
+
+func TestSessionLongDir(t *testing.T) {
+	exe := writeFakeStata(t, consoleFake)
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), strings.Repeat("a long directory name ", 8))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewRunner(exe).StartSession(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	out, err := s.Exec(ctx, "set x 42\ndisplay x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the wrapped echo of the do command, with its continuation lines, is dropped
+	if want := ". set x 42\n. display x\n42\nend of do-file"; out != want {
+		t.Errorf("got output\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestSessionConcurrentExec(t *testing.T) {
+	exe := writeFakeStata(t, consoleFake)
+	ctx := context.Background()
+	s, err := NewRunner(exe).StartSession(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// set and display run in one Exec, so no other Exec can interleave
+			out, err := s.Exec(ctx, "set x "+string(rune('a'+i))+"\ndisplay x")
+			if err != nil || !strings.Contains(out, "\n"+string(rune('a'+i))+"\n") {
+				t.Errorf("job %d: got %q, %v", i, out, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSessionTimeout(t *testing.T) {
+	exe := writeFakeStata(t, consoleFake)
+	s, err := NewRunner(exe).StartSession(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = s.Exec(ctx, "sleep")
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Exec took %v to stop", elapsed)
+	}
+	if _, err := s.Exec(context.Background(), "display x"); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("expected ErrSessionClosed after a timeout, got %v", err)
+	}
+}
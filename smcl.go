@@ -0,0 +1,491 @@
+package gostata
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SMCLStyle is the style of a span of SMCL output.
+type SMCLStyle int
+
+const (
+	SMCLText   SMCLStyle = iota // {txt}: labels and other text
+	SMCLResult                  // {res}: results
+	SMCLError                   // {err}: error messages
+	SMCLInput                   // {inp} and {com}: commands typed by the user
+)
+
+func (s SMCLStyle) String() string {
+	switch s {
+	case SMCLResult:
+		return "result"
+	case SMCLError:
+		return "error"
+	case SMCLInput:
+		return "input"
+	}
+	return "text"
+}
+
+// Span is a run of text in a single style.
+type Span struct {
+	Text      string
+	Style     SMCLStyle
+	Bold      bool
+	Italic    bool
+	Underline bool
+	Link      string // target of {browse}, if any
+}
+
+// SMCLLine is a line of output as spans.
+type SMCLLine []Span
+
+// Text returns the line as plain text.
+func (l SMCLLine) Text() string {
+	var sb strings.Builder
+	for _, s := range l {
+		sb.WriteString(s.Text)
+	}
+	return strings.TrimRight(sb.String(), " ")
+}
+
+// SMCLDoc is a parsed SMCL document, eg a log written by log using or batch mode with -s.
+type SMCLDoc struct {
+	Lines []SMCLLine
+}
+
+// smclLineSize is the width used by {hline}, {.-}, {right} and {center}, the default
+// linesize of Stata logs.
+const smclLineSize = 79
+
+// smclMaxRepeat bounds the counts of directives such as {hline} and {space} and the copies
+// {dup} makes of its content, nested or not, so a crafted log cannot claim unbounded memory.
+const smclMaxRepeat = 10000
+
+// ParseSMCL parses SMCL text. Unknown directives are kept as text, as Stata displays them.
+func ParseSMCL(s string) *SMCLDoc {
+	p := &smclParser{}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	// {...} at the end of a line joins it to the next
+	s = strings.ReplaceAll(s, "{...}\n", "")
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	for i, line := range lines {
+		if i == 0 && strings.TrimSpace(line) == "{smcl}" {
+			continue
+		}
+		p.parse(line)
+		p.doc.Lines = append(p.doc.Lines, p.line)
+		p.line, p.col = nil, 0
+	}
+	return &p.doc
+}
+
+type smclParser struct {
+	doc    SMCLDoc
+	line   SMCLLine
+	col    int // width of the current line
+	attrs  Span
+	copies int // copies made by the enclosing {dup} directives, if any
+}
+
+// emit appends text in the current style, merging it with the previous span if possible.
+func (p *smclParser) emit(text string) {
+	if text == "" {
+		return
+	}
+	p.col += utf8.RuneCountInString(text)
+	span := p.attrs
+	if n := len(p.line); n > 0 {
+		last := &p.line[n-1]
+		span.Text = last.Text
+		if *last == span {
+			last.Text += text
+			return
+		}
+	}
+	span.Text = text
+	p.line = append(p.line, span)
+}
+
+func (p *smclParser) parse(s string) {
+	for s != "" {
+		i := strings.IndexByte(s, '{')
+		if i < 0 {
+			p.emit(s)
+			return
+		}
+		p.emit(s[:i])
+		j := matchingCurly(s, i)
+		if j < 0 {
+			p.emit(s[i:])
+			return
+		}
+		if !p.directive(s[i+1 : j]) {
+			p.emit(s[i : j+1])
+		}
+		s = s[j+1:]
+	}
+}
+
+// matchingCurly returns the index of the brace closing the one at s[i], or -1.
+func matchingCurly(s string, i int) int {
+	depth, quoted := 0, false
+	for k := i; k < len(s); k++ {
+		switch s[k] {
+		case '"':
+			quoted = !quoted
+		case '{':
+			if !quoted {
+				depth++
+			}
+		case '}':
+			if !quoted {
+				if depth--; depth == 0 {
+					return k
+				}
+			}
+		}
+	}
+	return -1
+}
+
+// directive applies a directive such as "res", "hline 13" or "ralign 9:text" and reports
+// whether it was recognized.
+func (p *smclParser) directive(d string) bool {
+	head, content, hasContent := cutUnquoted(d, ':')
+	name, args, _ := strings.Cut(strings.TrimSpace(head), " ")
+	args = strings.TrimSpace(args)
+	n, nErr := strconv.Atoi(args)
+	if args == "" {
+		nErr = nil
+	}
+	if nErr == nil && n > smclMaxRepeat {
+		nErr = strconv.ErrRange
+	}
+
+	styled := func(set func(a *Span)) bool {
+		if !hasContent {
+			set(&p.attrs)
+			return true
+		}
+		saved := p.attrs
+		set(&p.attrs)
+		p.parse(content)
+		p.attrs = saved
+		return true
+	}
+	// aligned renders content padded to width with pad, which returns the left padding
+	aligned := func(width int, pad func(room int) int) bool {
+		text := p.render(content)
+		room := width - utf8.RuneCountInString(text.Text())
+		left := max(pad(room), 0)
+		p.emit(strings.Repeat(" ", left))
+		p.parse(content)
+		p.emit(strings.Repeat(" ", max(room-left, 0)))
+		return true
+	}
+
+	switch name {
+	case "txt", "text":
+		return styled(func(a *Span) { a.Style = SMCLText })
+	case "sf":
+		return styled(func(a *Span) { a.Bold, a.Italic = false, false })
+	case "reset":
+		p.attrs = Span{}
+		return true
+	case "res", "result", "hi":
+		return styled(func(a *Span) { a.Style = SMCLResult })
+	case "err", "error":
+		return styled(func(a *Span) { a.Style = SMCLError })
+	case "inp", "input", "com", "cmd":
+		return styled(func(a *Span) { a.Style = SMCLInput })
+	case "bf":
+		return styled(func(a *Span) { a.Bold = true })
+	case "it":
+		return styled(func(a *Span) { a.Italic = true })
+	case "ul":
+		if args == "on" || args == "off" {
+			p.attrs.Underline = args == "on"
+			return true
+		}
+		return styled(func(a *Span) { a.Underline = true })
+	case "hline", ".-":
+		if nErr != nil {
+			return false
+		}
+		if args == "" {
+			n = smclLineSize - p.col
+		}
+		p.emit(strings.Repeat("-", max(n, 0)))
+		return true
+	case "col", "column":
+		if nErr != nil || args == "" {
+			return false
+		}
+		p.emit(strings.Repeat(" ", max(n-1-p.col, 0)))
+		return true
+	case "space":
+		if nErr != nil {
+			return false
+		}
+		if args == "" {
+			n = 1
+		}
+		p.emit(strings.Repeat(" ", n))
+		return true
+	case "dup":
+		copies := max(p.copies, 1) * n
+		if nErr != nil || args == "" || copies > smclMaxRepeat {
+			return false
+		}
+		saved := p.copies
+		p.copies = copies
+		for k := 0; k < n; k++ {
+			p.parse(content)
+		}
+		p.copies = saved
+		return true
+	case "c", "char":
+		text, ok := smclChar(args)
+		if !ok {
+			return false
+		}
+		p.emit(text)
+		return true
+	case "ralign", "lalign", "center", "right":
+		width := smclLineSize - p.col
+		if name == "ralign" || name == "lalign" || args != "" {
+			if nErr != nil || args == "" {
+				return false
+			}
+			width = n
+		}
+		switch name {
+		case "ralign", "right":
+			return aligned(width, func(room int) int { return room })
+		case "center":
+			return aligned(width, func(room int) int { return room / 2 })
+		}
+		return aligned(width, func(room int) int { return 0 })
+	case "browse", "help", "helpb", "stata", "view", "manhelp", "manlink", "search", "net":
+		target := strings.Trim(args, `"`)
+		if !hasContent {
+			content = target
+			if name == "manhelp" || name == "manlink" {
+				content = strings.Fields(args + " ")[0]
+			}
+		}
+		return styled(func(a *Span) {
+			if name == "browse" {
+				a.Link = target
+			}
+		})
+	case "bind":
+		p.parse(content)
+		return true
+	case "p", "pstd", "phang", "pmore", "pin", "p2col", "p_end", "p2colreset", "break", "asis", "smcl", "s6hlp", "marker", "synoptset", "bind_end", "title":
+		// paragraph layout and markers; the text keeps its line breaks
+		if hasContent {
+			p.parse(content)
+		}
+		return true
+	}
+	return false
+}
+
+// render parses s into a detached line, to measure its width.
+func (p *smclParser) render(s string) SMCLLine {
+	q := &smclParser{attrs: p.attrs, copies: p.copies}
+	q.parse(s)
+	return q.line
+}
+
+// cutUnquoted is strings.Cut ignoring separators inside double quotes.
+func cutUnquoted(s string, sep byte) (before, after string, found bool) {
+	quoted, depth := false, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case sep:
+			if !quoted && depth == 0 {
+				return s[:i], s[i+1:], true
+			}
+		}
+	}
+	return s, "", false
+}
+
+// smclChar returns the character drawn by {c args}. Line-drawing characters are rendered
+// in ASCII, as in text logs: the tees at the top and bottom of a table become dashes.
+func smclChar(args string) (string, bool) {
+	switch args {
+	case "|", "-", "+", "$", "'", "`":
+		return args, true
+	case "TT", "BT":
+		return "-", true
+	case "LT", "RT", "TLC", "TRC", "BLC", "BRC":
+		return "+", true
+	case "-(":
+		return "{", true
+	case ")-":
+		return "}", true
+	case "S|":
+		return "$", true
+	case "'g":
+		return "`", true
+	}
+	base := 10
+	if strings.HasPrefix(args, "0x") {
+		args, base = args[2:], 16
+	}
+	code, err := strconv.ParseUint(args, base, 8)
+	if err != nil {
+		return "", false
+	}
+	// codes above 127 are Latin-1
+	return string(rune(code)), true
+}
+
+// Text returns the document as plain text.
+func (d *SMCLDoc) Text() string {
+	var sb strings.Builder
+	for _, line := range d.Lines {
+		sb.WriteString(line.Text())
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// Errors returns the lines written in the error style, eg "variable x not found" and "r(111);".
+func (d *SMCLDoc) Errors() []string {
+	var errs []string
+	for _, line := range d.Lines {
+		if lineStyle(line) == SMCLError {
+			errs = append(errs, strings.TrimSpace(line.Text()))
+		}
+	}
+	return errs
+}
+
+// lineStyle returns the style of the non-blank text of line, or -1 if the line is blank
+// or mixes styles.
+func lineStyle(line SMCLLine) SMCLStyle {
+	style := SMCLStyle(-1)
+	for _, s := range line {
+		if strings.TrimSpace(s.Text) == "" {
+			continue
+		}
+		if style >= 0 && s.Style != style {
+			return -1
+		}
+		style = s.Style
+	}
+	return style
+}
+
+// HTML returns the document as a pre element. Spans are wrapped in elements of classes
+// smcl-result, smcl-error and smcl-input; bold, italic and underlined text in b, i and u.
+// Links are kept only if they are http, https, mailto or relative URLs.
+func (d *SMCLDoc) HTML() string {
+	var sb strings.Builder
+	sb.WriteString(`<pre class="smcl">`)
+	for i, line := range d.Lines {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		for _, s := range line {
+			text := html.EscapeString(s.Text)
+			if s.Bold {
+				text = "<b>" + text + "</b>"
+			}
+			if s.Italic {
+				text = "<i>" + text + "</i>"
+			}
+			if s.Underline {
+				text = "<u>" + text + "</u>"
+			}
+			if safeLink(s.Link) {
+				text = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(s.Link), text)
+			}
+			if s.Style != SMCLText {
+				text = fmt.Sprintf(`<span class="smcl-%s">%s</span>`, s.Style, text)
+			}
+			sb.WriteString(text)
+		}
+	}
+	sb.WriteString("</pre>\n")
+	return sb.String()
+}
+
+// safeLink reports whether target is an http, https, mailto or relative URL, which a page
+// can link to without running script from the log.
+func safeLink(target string) bool {
+	u, err := url.Parse(target)
+	if err != nil || target == "" || strings.TrimSpace(target) != target {
+		return false
+	}
+	switch u.Scheme {
+	case "", "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+// Markdown returns the document as Markdown: commands in stata code blocks, their output in
+// plain code blocks and error messages as quoted paragraphs.
+func (d *SMCLDoc) Markdown() string {
+	var sb strings.Builder
+	var block []string
+	kind := ""
+	flush := func() {
+		for len(block) > 0 && strings.TrimSpace(block[len(block)-1]) == "" {
+			block = block[:len(block)-1]
+		}
+		if len(block) > 0 {
+			switch kind {
+			case "error":
+				text := strings.NewReplacer(`\`, `\\`, "*", `\*`, "`", "\\`").Replace(strings.Join(block, "  \n> "))
+				sb.WriteString("> **" + text + "**\n\n")
+			default:
+				fence := "```"
+				for strings.Contains(strings.Join(block, "\n"), fence) {
+					fence += "`"
+				}
+				sb.WriteString(fence + kind + "\n" + strings.Join(block, "\n") + "\n" + fence + "\n\n")
+			}
+		}
+		block, kind = nil, ""
+	}
+	for _, line := range d.Lines {
+		k := ""
+		switch lineStyle(line) {
+		case SMCLInput:
+			k = "stata"
+		case SMCLError:
+			k = "error"
+		}
+		text := line.Text()
+		if text == "" && len(block) == 0 {
+			continue
+		}
+		if k != kind && !(text == "" && kind == "") {
+			flush()
+			if text == "" {
+				continue
+			}
+			kind = k
+		}
+		block = append(block, text)
+	}
+	flush()
+	return sb.String()
+}
@@ -0,0 +1,132 @@
+package gostata
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func readSMCL(t *testing.T) *SMCLDoc {
+	t.Helper()
+	b, err := os.ReadFile("testdata/logs/regress.smcl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ParseSMCL(string(b))
+}
+
+func TestSMCLText(t *testing.T) {
+	doc := readSMCL(t)
+	text := doc.Text()
+	for _, want := range []string{
+		"      name:  <unnamed>\n",
+		"\n. regress price mpg\n",
+		"\n-------------+----------------------------------   F(1, 72)        =     20.26\n",
+		"\n       Model |  139449474         1   139449474   Prob > F        =    0.0000\n",
+		"\n-------------+----------------------------------------------------------------\n",
+		"\n         mpg |  -238.8943   53.07669    -4.50   0.000    -344.7008   -133.0879\n",
+		"\nvariable nosuch not found\nr(111);\n",
+		"\n. display \"{braces}\"\n",
+		"\n       x|ab  | mid  |it|Stata|{unknown thing}\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text does not contain %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "{smcl}") || strings.HasPrefix(text, "\n") {
+		t.Errorf("unexpected header:\n%s", text)
+	}
+	if !strings.HasPrefix(text, strings.Repeat("-", smclLineSize)+"\n") {
+		t.Errorf("{.-} not drawn across the line:\n%s", text)
+	}
+	// the estimation table survives the conversion
+	tables, err := ParseEstimationTables(text)
+	if err != nil || len(tables) != 1 {
+		t.Fatalf("got %v, %v", tables, err)
+	}
+	if c, _ := tables[0].Coef("mpg"); c.Coef != -238.8943 || tables[0].N() != 74 {
+		t.Errorf("unexpected table %+v", tables[0])
+	}
+	if e := ParseLogError(text); e == nil || e.Code != 111 || e.Command != "summarize nosuch" {
+		t.Errorf("ParseLogError = %+v", e)
+	}
+}
+
+func TestSMCLSpans(t *testing.T) {
+	doc := readSMCL(t)
+	if errs := doc.Errors(); len(errs) != 1 || errs[0] != "variable nosuch not found" {
+		t.Errorf("Errors = %q", errs)
+	}
+	var model SMCLLine
+	for _, line := range doc.Lines {
+		if strings.HasPrefix(line.Text(), "       Model") {
+			model = line
+		}
+	}
+	if len(model) != 4 || model[0].Style != SMCLText || model[1].Style != SMCLResult || strings.TrimSpace(model[3].Text) != "0.0000" {
+		t.Errorf("unexpected spans %+v", model)
+	}
+	var bold, link, italic bool
+	for _, line := range doc.Lines {
+		for _, s := range line {
+			bold = bold || s.Bold && s.Text == "nosuch" && s.Style == SMCLError
+			link = link || s.Link == "https://www.stata.com" && s.Text == "Stata"
+			italic = italic || s.Italic && s.Text == "it"
+		}
+	}
+	if !bold || !link || !italic {
+		t.Errorf("attributes lost: bold %v, link %v, italic %v", bold, link, italic)
+	}
+}
+
+func TestSMCLRender(t *testing.T) {
+	doc := ParseSMCL("{com}. display 1 < 2\n{res}1\n{err}bad *thing*\n{txt}r(198);\n")
+	html := doc.HTML()
+	for _, want := range []string{
+		`<pre class="smcl"><span class="smcl-input">. display 1 &lt; 2</span>`,
+		`<span class="smcl-result">1</span>`,
+		`<span class="smcl-error">bad *thing*</span>`,
+		"\nr(198);</pre>",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML does not contain %q:\n%s", want, html)
+		}
+	}
+	md := doc.Markdown()
+	want := "```stata\n. display 1 < 2\n```\n\n```\n1\n```\n\n> **bad \\*thing\\***\n\n```\nr(198);\n```\n\n"
+	if md != want {
+		t.Errorf("got Markdown\n%s\nwant\n%s", md, want)
+	}
+}
+
+func TestSMCLUntrusted(t *testing.T) {
+	doc := ParseSMCL(`{browse "javascript:alert(1)":a} {browse " javascript:alert(1)":b} ` +
+		`{browse "https://www.stata.com":c} {browse "help/regress.html":d} {browse "mailto:x@y.org":e}` + "\n")
+	html := doc.HTML()
+	if strings.Contains(html, "javascript") {
+		t.Errorf("script link kept:\n%s", html)
+	}
+	for _, want := range []string{
+		`<a href="https://www.stata.com">c</a>`,
+		`<a href="help/regress.html">d</a>`,
+		`<a href="mailto:x@y.org">e</a>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML does not contain %q:\n%s", want, html)
+		}
+	}
+
+	// repeat counts are bounded, nested or not
+	for _, s := range []string{
+		"{dup 1000000000:x}",
+		"{dup 1000:{dup 1000:{dup 1000:x}}}",
+		"{space 2000000000}",
+	} {
+		if text := ParseSMCL(s).Text(); len(text) > len(s)*smclMaxRepeat {
+			t.Errorf("%s expands to %d bytes", s, len(text))
+		}
+	}
+	if got := ParseSMCL("{dup 3:{dup 2:ab}}").Text(); got != strings.Repeat("ab", 6)+"\n" {
+		t.Errorf("nested dup = %q", got)
+	}
+}
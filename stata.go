@@ -11,6 +11,8 @@ import (
 	"io"
 	"math"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 	"unsafe"
 )
@@ -20,6 +22,9 @@ const (
 	stataFmtSize   = 12
 	stataLabelSize = 81
 
+	// time stamp format eg "17 Oct 2026 09:30"
+	timeStampLayout = "02 Jan 2006 15:04"
+
 	STATA_BYTE_NA     = 127
 	STATA_SHORTINT_NA = 32767
 	STATA_INT_NA      = 2147483647
@@ -93,7 +98,7 @@ func NewHeader() *header {
 	}
 	//FIXME: leave empty for production; comment the line below
 	copy(fh.DataLabel[:], "Written by VDEC Stata File Creator")
-	copy(fh.TimeStamp[:], time.Now().Format("02 Jan 2006 15:04"))
+	copy(fh.TimeStamp[:], time.Now().Format(timeStampLayout))
 	return &fh
 }
 
@@ -115,6 +120,10 @@ type File struct {
 	fmtList  []stataFmtName //      12*nvar    char array
 	lblList  []stataVarName //       33*nvar    char array
 	vlblList []stataLabel
+	// value label tables written after the data
+	valueLabels []*ValueLabel
+	// characteristics written as expansion fields, by variable (_dta for the dataset) and name
+	chars map[string]map[string]string
 }
 
 // NewFile returns a pointer to an initialized File.
@@ -125,6 +134,76 @@ func NewFile() *File {
 	return &sf
 }
 
+// NewFileFromDataset returns a File holding the variables, data and value labels of ds.
+func NewFileFromDataset(ds *Dataset) (*File, error) {
+	sf := NewFile()
+	sf.DataLabel = stataLabel{}
+	copy(sf.DataLabel[:maxLabelLen], ds.Label)
+	if !ds.TimeStamp.IsZero() {
+		sf.TimeStamp = [18]byte{}
+		copy(sf.TimeStamp[:], ds.TimeStamp.Format(timeStampLayout))
+	}
+	for _, v := range ds.vars {
+		fld := &Field{
+			Name:       v.Name,
+			FieldType:  v.typ,
+			Label:      v.Label,
+			Format:     v.Format,
+			ValueLabel: v.ValueLabel,
+		}
+		switch v.typ {
+		case StataByteId:
+			data := make([]Byte, len(v.nums))
+			for i, x := range v.nums {
+				data[i] = encodeByte(x)
+			}
+			fld.data = data
+		case StataIntId:
+			data := make([]Int, len(v.nums))
+			for i, x := range v.nums {
+				data[i] = encodeInt(x)
+			}
+			fld.data = data
+		case StataLongId:
+			data := make([]Long, len(v.nums))
+			for i, x := range v.nums {
+				data[i] = encodeLong(x)
+			}
+			fld.data = data
+		case StataFloatId:
+			data := make([]Float, len(v.nums))
+			for i, x := range v.nums {
+				data[i] = encodeFloat(x)
+			}
+			fld.data = data
+		case StataDoubleId:
+			data := make([]Double, len(v.nums))
+			for i, x := range v.nums {
+				data[i] = encodeDouble(x)
+			}
+			fld.data = data
+		default:
+			fld.data = v.strs
+		}
+		sf.fields = append(sf.fields, fld)
+	}
+	for _, vl := range ds.ValueLabels() {
+		sf.AddValueLabel(vl)
+	}
+	if err := sf.addCharacteristics("_dta", ds.Notes, ds.Chars); err != nil {
+		return nil, err
+	}
+	for _, v := range ds.vars {
+		if err := sf.addCharacteristics(v.Name, v.Notes, v.Chars); err != nil {
+			return nil, err
+		}
+	}
+	sf.NumVars = int16(len(sf.fields))
+	sf.NumObs = int32(ds.nobs)
+	sf.recordSize = calcRecordSize(sf.fields)
+	return sf, nil
+}
+
 func NewFileFromStruct(data interface{}) (*File, error) {
 	fields, err := ExtractFields(data)
 	if err != nil {
@@ -191,6 +270,65 @@ func (sf *File) AddField(name, label string, slice interface{}) *Field {
 	return fld
 }
 
+// AddValueLabel adds a value label table to be written after the data.
+// Fields refer to it by setting their ValueLabel to vl.Name.
+func (sf *File) AddValueLabel(vl *ValueLabel) {
+	sf.valueLabels = append(sf.valueLabels, vl)
+}
+
+// addCharacteristics stores the notes and characteristics of variable owner, or of the
+// dataset if owner is _dta. Like Stata, notes are stored as characteristics note1, note2...
+// with their number in note0.
+func (sf *File) addCharacteristics(owner string, notes []string, chars map[string]string) error {
+	if len(notes) == 0 && len(chars) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(chars)+len(notes)+1)
+	for name, text := range chars {
+		if err := ValidateName(name); err != nil {
+			return fmt.Errorf("characteristic %s[%s]: %w", owner, name, err)
+		}
+		m[name] = text
+	}
+	if len(notes) > 0 {
+		m["note0"] = strconv.Itoa(len(notes))
+		for i, note := range notes {
+			m["note"+strconv.Itoa(i+1)] = note
+		}
+	}
+	if sf.chars == nil {
+		sf.chars = make(map[string]map[string]string)
+	}
+	sf.chars[owner] = m
+	return nil
+}
+
+// splitNotes separates the notes stored by addCharacteristics from the other characteristics.
+func splitNotes(m map[string]string) (notes []string, chars map[string]string) {
+	n, _ := strconv.Atoi(m["note0"])
+	for i := 1; i <= n; i++ {
+		if note, ok := m["note"+strconv.Itoa(i)]; ok {
+			notes = append(notes, note)
+		}
+	}
+	for name, text := range m {
+		if isNoteName(name, n) {
+			continue
+		}
+		if chars == nil {
+			chars = make(map[string]string)
+		}
+		chars[name] = text
+	}
+	return notes, chars
+}
+
+// isNoteName reports whether name is note0 to noteN.
+func isNoteName(name string, n int) bool {
+	k, err := strconv.Atoi(strings.TrimPrefix(name, "note"))
+	return n > 0 && strings.HasPrefix(name, "note") && err == nil && k >= 0 && k <= n
+}
+
 // AddFieldMeta adds a description of a field in a record
 // argument typ uses one of the following Stata variable types
 //
@@ -226,7 +364,7 @@ func (sf *File) AddFieldMeta(name, label string, typ byte) *Field {
 		}
 		// string
 		sf.recordSize += int(typ)
-		format = "%" + string(typ) + "s" //eg %15s
+		format = "%" + strconv.Itoa(int(typ)) + "s" //eg %15s
 	}
 	fld := &Field{
 		Name:      name,
@@ -239,10 +377,19 @@ func (sf *File) AddFieldMeta(name, label string, typ byte) *Field {
 	return fld
 }
 
-// WriteTo writes the data to an io.Writer.
+// WriteTo writes the complete file (header, descriptors, data and value labels) to an io.Writer.
 // warning: the number of written byte is not used, always zero
 func (sf *File) WriteTo(w io.Writer) (int64, error) {
-	return 0, sf.writeData(w)
+	if err := sf.writeHeader(w); err != nil {
+		return 0, err
+	}
+	if err := sf.writeDescriptors(w); err != nil {
+		return 0, err
+	}
+	if err := sf.writeData(w); err != nil {
+		return 0, err
+	}
+	return 0, sf.writeValueLabels(w)
 }
 
 func (sf *File) writeHeader(w io.Writer) error {
@@ -262,7 +409,8 @@ func (sf *File) writeDescriptors(w io.Writer) error {
 		copy(sf.varList[i][:], f.Name) //only copy up to the size of stataVarName and pad with zeros
 		sf.typList[i] = f.FieldType
 		copy(sf.fmtList[i][:], f.Format)
-		copy(sf.vlblList[i][:], f.Label)
+		copy(sf.lblList[i][:], f.ValueLabel)
+		copy(sf.vlblList[i][:maxLabelLen], f.Label)
 	}
 
 	if err := binary.Write(w, littleEndian, sf.typList); err != nil {
@@ -279,17 +427,56 @@ func (sf *File) writeDescriptors(w io.Writer) error {
 	if err := binary.Write(w, littleEndian, sf.fmtList); err != nil {
 		return err
 	}
-	//write empty value lables
+	//write value label names
 	if err := binary.Write(w, littleEndian, sf.lblList); err != nil {
 		return err
 	}
 	if err := binary.Write(w, littleEndian, sf.vlblList); err != nil {
 		return err
 	}
-	// write an empty expansion field (5 bytes of zeros)
+	if err := sf.writeCharacteristics(w); err != nil {
+		return err
+	}
+	// end the expansion fields with an empty one (5 bytes of zeros)
 	return binary.Write(w, littleEndian, [5]byte{0, 0, 0, 0, 0})
 }
 
+// writeCharacteristics writes the characteristics as expansion fields of type 1:
+//
+//	Contents            Length    Format       Comments
+//	data type                1    byte         1
+//	len                      4    int          length of the contents
+//	varname                 33    char         variable name or _dta
+//	charname                33    char         characteristic name
+//	contents      len-66 bytes    char         text, \0 terminated
+func (sf *File) writeCharacteristics(w io.Writer) error {
+	owners := []string{"_dta"}
+	for _, f := range sf.fields {
+		owners = append(owners, f.Name)
+	}
+	for _, owner := range owners {
+		m := sf.chars[owner]
+		for _, name := range sortedKeys(m) {
+			var varName, charName stataVarName
+			copy(varName[:maxNameLen], owner)
+			copy(charName[:maxNameLen], name)
+			field := []interface{}{
+				byte(1),
+				int32(2*stataVarSize + len(m[name]) + 1),
+				varName,
+				charName,
+				append([]byte(m[name]), 0),
+			}
+			for _, data := range field {
+				if err := binary.Write(w, littleEndian, data); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
 // writeData loops over the field vectors and write their binary representation to an io.Writer
 // uses unsafe to  avoid using potentially slower binary.Write.
 func (sf *File) writeData(w io.Writer) error {
@@ -327,7 +514,14 @@ func (sf *File) writeData(w io.Writer) error {
 				copy(bs[offset:], base[:])
 				offset += 8
 			default:
-				return fmt.Errorf("Field type [%d] not supported in field %s", f.FieldType, f.Name)
+				if !isStrType(f.FieldType) {
+					return fmt.Errorf("Field type [%d] not supported in field %s", f.FieldType, f.Name)
+				}
+				// strings are zero-padded to the field width
+				next := offset + int(f.FieldType)
+				n := copy(bs[offset:next], f.data.([]string)[i])
+				clear(bs[offset+n : next])
+				offset = next
 			}
 		}
 		if _, err := w.Write(bs); err != nil {
@@ -337,6 +531,48 @@ func (sf *File) writeData(w io.Writer) error {
 	return nil
 }
 
+// writeValueLabels writes the value label tables that follow the data
+//
+//	Contents            Length    Format       Comments
+//	len                   4       int          length of table
+//	labname              33       char         \0 terminated
+//	padding               3
+//	n                     4       int          number of entries
+//	txtlen                4       int          length of txt[]
+//	off[]               4*n       int array    txt[] offset table
+//	val[]               4*n       int array    sorted value table
+//	txt[]            txtlen       char         text table
+func (sf *File) writeValueLabels(w io.Writer) error {
+	for _, vl := range sf.valueLabels {
+		values := vl.Values()
+		off := make([]int32, len(values))
+		var txt []byte
+		for i, v := range values {
+			off[i] = int32(len(txt))
+			txt = append(txt, vl.labels[v]...)
+			txt = append(txt, 0)
+		}
+		var name stataVarName
+		copy(name[:maxNameLen], vl.Name)
+		table := []interface{}{
+			int32(8 + 8*len(values) + len(txt)),
+			name,
+			[3]byte{},
+			int32(len(values)),
+			int32(len(txt)),
+			off,
+			values,
+			txt,
+		}
+		for _, data := range table {
+			if err := binary.Write(w, littleEndian, data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // BeginWrite must be called once after defining all fields and before writing records
 // fileName will be created or truncated if it already exists
 // caveat: must set the number of observations before calling this method
@@ -415,10 +651,11 @@ func (sf *File) AppendDouble(v Double) {
 	sf.offset += 8
 }
 
+// AppendStringN appends v as a string field of width n, truncated or padded with zeros.
 func (sf *File) AppendStringN(v string, n int) {
-    b := []byte(v)
-    copy(sf.recBuf[sf.offset:], b[:])
-    sf.offset += n
+	field := sf.recBuf[sf.offset : sf.offset+n]
+	clear(field[copy(field, v):])
+	sf.offset += n
 }
 
 func (sf *File) AppendBytesN(v []byte, n int) {
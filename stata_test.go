@@ -2,7 +2,6 @@ package gostata
 
 import (
 	"math/rand"
-	"os"
 	"strings"
 	"testing"
 	"unsafe"
@@ -54,6 +53,16 @@ func TestRecordWrite(t *testing.T) {
 	is.NoErr(sf.RecordEnd())
 	is.NoErr(sf.EndWrite())
 
+	ds, err := ReadFile(getTestingPath("two_records.dta"))
+	is.NoErr(err)
+	is.Equal(ds.NumObs(), 2)
+	is.Equal(ds.Var("bytefld").Float(0), 1.0)
+	is.Equal(ds.Var("intfld").Float(1), 9999.0)
+	is.Equal(ds.Var("str9fld").Str(0), "123456789")
+	is.Equal(ds.Var("str9fld").Str(1), "1234567")
+	is.Equal(ds.Var("doublefld").Float(1), 3.142)
+
+	requireStata(t)
 	dict, err := RunScript(testDir, `
 	qui {
     use two_records.dta
@@ -97,9 +106,22 @@ func TestFile_WriteTo(t *testing.T) {
 	f64 := []Double{6.5, 7.5, 3.5, 4.5, 5.5, 6.5}
 	sf.AddField("f64", "float64", f64)
 
-	if err := sf.WriteFile("small.dta"); err != nil {
+	if err := sf.WriteFile(getTestingPath("small.dta")); err != nil {
+		t.Fatal(err)
+	}
+	ds, err := ReadFile(getTestingPath("small.dta"))
+	if err != nil {
 		t.Fatal(err)
 	}
+	sums, err := ds.Summarize("i8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sums[0].N != 6 || sums[0].Mean != 3.5 {
+		t.Errorf("Expected N=6 and mean(i8)=3.5, found N=%d and mean(i8)=%v", sums[0].N, sums[0].Mean)
+	}
+
+	requireStata(t)
 	output, err := RunStataDo(testDir, "do.do")
 	if err != nil {
 		t.Fatal(err)
@@ -124,9 +146,22 @@ func TestFile_WriteToLarge(t *testing.T) {
 	}
 	sf.AddField("f64", "float64", f64)
 
-	if err := sf.WriteFile("large.dta"); err != nil {
+	if err := sf.WriteFile(getTestingPath("large.dta")); err != nil {
 		t.Fatal(err)
 	}
+	ds, err := ReadFile(getTestingPath("large.dta"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sums, err := ds.Summarize("f64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sums[0].N != N || sums[0].Mean > 0.01 || sums[0].Mean < -0.01 {
+		t.Errorf("Expected N=100000 and mean(f64)=0, found N=%d and mean(f64)=%v", sums[0].N, sums[0].Mean)
+	}
+
+	requireStata(t)
 	output, err := RunStataDo(testDir, "large.do")
 	if err != nil {
 		t.Fatal(err)
@@ -166,17 +201,16 @@ func TestWriteStataFromStruct(t *testing.T) {
 	//         t.Fatal(err)
 	// }
 	//
-	// Basic check: file should exist
-	if _, err := os.Stat(fileName); os.IsNotExist(err) {
-		t.Errorf("File %s not created", fileName)
-	}
-
-	// You would typically run Stata here and then verify the data
-	// For example, using a system call to Stata in your test:
-	// cmd := exec.Command("stata", "-b", "do", "verify_stata.do") // verify_stata.do would check the file
-	// if err := cmd.Run(); err != nil {
-	//  t.Errorf("Stata verification failed: %v", err)
-	// }
+	ds, err := ReadFile(fileName)
+	is.NoErr(err)
+	is.Equal(ds.NumObs(), 0)
+	is.Equal(ds.VarNames(), []string{"my_name", "age", "height", "isvalid"})
+	is.Equal(ds.Var("my_name").TypeName(), "str10")
+	is.Equal(ds.Var("my_name").Label, "My Name")
+	is.Equal(ds.Var("age").TypeName(), "int")
+	is.Equal(ds.Var("height").TypeName(), "double")
+	is.Equal(ds.Var("height").Format, "%6.2f")
+	is.Equal(ds.Var("isvalid").TypeName(), "byte")
 }
 
 // The default number generator is deterministic, so it'll
@@ -0,0 +1,99 @@
+package gostata
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// StataError is returned when a do-file stopped with an error. Stata exits with status 0
+// in batch mode even then, so the error is detected from the r(###); line in the log.
+type StataError struct {
+	Code    int    // the return code, eg 601 for "file not found"
+	Message string // the error message printed before the return code
+	Command string // the command that failed, as echoed in the log, if any
+	Excerpt string // the lines of the log around the error
+}
+
+func (e *StataError) Error() string {
+	msg := fmt.Sprintf("stata error r(%d)", e.Code)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Command != "" {
+		msg += " (in: " + e.Command + ")"
+	}
+	return msg
+}
+
+var (
+	returnCodeLine = regexp.MustCompile(`^r\((\d+)\);\s*$`)
+	// commands are echoed after a dot prompt; lines of a block or loop are numbered
+	commandLine = regexp.MustCompile(`^(\. |\s*\d+\. )`)
+)
+
+// excerptLines is the most lines of the log kept before the return code in StataError.Excerpt.
+const excerptLines = 10
+
+// isBlockEnd reports whether line echoes a command that only closes a block, such as the
+// "}" ending a loop.
+func isBlockEnd(line string) bool {
+	return strings.TrimSpace(commandLine.ReplaceAllString(line, "")) == "}"
+}
+
+// ParseLogError returns the first error recorded in a Stata log, or nil if there is none.
+func ParseLogError(log string) *StataError {
+	lines := strings.Split(strings.ReplaceAll(log, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		m := returnCodeLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		code, _ := strconv.Atoi(m[1])
+		e := &StataError{Code: code}
+		// the message runs back from the return code to the last echoed command
+		start := i
+		for start > 0 && !commandLine.MatchString(lines[start-1]) {
+			start--
+		}
+		var msg []string
+		for _, l := range lines[start:i] {
+			if strings.HasPrefix(l, "> ") {
+				continue // continuation of the command
+			}
+			if l = strings.TrimSpace(l); l != "" {
+				msg = append(msg, l)
+			}
+		}
+		e.Message = strings.Join(msg, " ")
+		if start > 0 {
+			// Stata echoes the body of a loop before running it: the failing command is the
+			// last echoed line that does not just close a block
+			at := start - 1
+			for at > 0 && isBlockEnd(lines[at]) {
+				prev := at - 1
+				for prev > 0 && !commandLine.MatchString(lines[prev]) {
+					prev--
+				}
+				if !commandLine.MatchString(lines[prev]) {
+					break
+				}
+				at = prev
+			}
+			cmd := commandLine.ReplaceAllString(lines[at], "")
+			for _, l := range lines[at+1 : i] {
+				if rest, ok := strings.CutPrefix(l, "> "); ok {
+					cmd = strings.TrimSuffix(strings.TrimSpace(cmd), "///") + " " + rest
+				} else if commandLine.MatchString(l) {
+					break
+				}
+			}
+			e.Command = strings.Join(strings.Fields(cmd), " ")
+			start = at
+		}
+		e.Excerpt = strings.Join(lines[max(start, i-excerptLines):i+1], "\n")
+		return e
+	}
+	return nil
+}
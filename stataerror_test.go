@@ -0,0 +1,92 @@
+package gostata
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseLogError(t *testing.T) {
+	tests := []struct {
+		name, log string
+		want      *StataError
+	}{
+		{"no error", "\n. sysuse auto\n(1978 automobile data)\n\n. count\n  74\n\nend of do-file\n", nil},
+		{"file not found", `
+. display "start"
+start
+
+. use nofile
+file nofile.dta not found
+r(601);
+
+end of do-file
+r(601);
+`, &StataError{Code: 601, Message: "file nofile.dta not found", Command: "use nofile"}},
+		{"continued command", `
+. regress price mpg weight ///
+> foreign nosuch
+variable nosuch not found
+r(111);
+
+end of do-file
+r(111);
+`, &StataError{Code: 111, Message: "variable nosuch not found", Command: "regress price mpg weight foreign nosuch"}},
+		{"inside a loop", `
+. forvalues i = 1/2 {
+  2.   summarize x` + "`i'" + `
+  3. }
+variable x1 not found
+r(111);
+`, &StataError{Code: 111, Message: "variable x1 not found", Command: "summarize x`i'"}},
+		{"continued command inside a loop", `
+. foreach v in a b {
+  2.   regress price ///
+> ` + "`v'" + `
+  3.   }
+  4. }
+variable a not found
+r(111);
+`, &StataError{Code: 111, Message: "variable a not found", Command: "regress price `v'"}},
+		{"no echoed command", "invalid syntax\nr(198);\n", &StataError{Code: 198, Message: "invalid syntax"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseLogError(tt.log)
+			if tt.want == nil {
+				if got != nil {
+					t.Fatalf("unexpected error %v", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("error not detected")
+			}
+			if got.Code != tt.want.Code || got.Message != tt.want.Message || got.Command != tt.want.Command {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if !strings.HasSuffix(got.Excerpt, "r("+strconv.Itoa(tt.want.Code)+");") {
+				t.Errorf("excerpt does not end with the return code: %q", got.Excerpt)
+			}
+		})
+	}
+}
+
+func TestRunDoStataError(t *testing.T) {
+	exe := writeFakeStata(t, `base=$(basename "$3" .do)
+printf '\n. use nofile\nfile nofile.dta not found\nr(601);\n\nend of do-file\nr(601);\n' > "$base.log"
+`)
+	_, err := NewRunner(exe).RunScript(context.Background(), t.TempDir(), "use nofile")
+	var serr *StataError
+	if !errors.As(err, &serr) {
+		t.Fatalf("expected a *StataError, got %v", err)
+	}
+	if serr.Code != 601 || serr.Message != "file nofile.dta not found" {
+		t.Errorf("unexpected error %+v", serr)
+	}
+	if want := "stata error r(601): file nofile.dta not found (in: use nofile)"; serr.Error() != want {
+		t.Errorf("got %q, want %q", serr.Error(), want)
+	}
+}
@@ -0,0 +1,250 @@
+package gostata
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Summary holds the statistics reported by Stata's summarize for one variable.
+// Missing values are excluded; statistics that cannot be computed are Missing.
+type Summary struct {
+	Name string
+	N    int
+	Sum  float64
+	Mean float64
+	SD   float64 // sample standard deviation (N-1 denominator)
+	Min  float64
+	Max  float64
+}
+
+// Summarize computes summary statistics for the named variables, or for all variables if none
+// are named. As in Stata, string variables have N=0.
+func (ds *Dataset) Summarize(names ...string) ([]Summary, error) {
+	vars := ds.vars
+	if len(names) > 0 {
+		var err error
+		if vars, err = ds.lookup(names); err != nil {
+			return nil, err
+		}
+	}
+	sums := make([]Summary, len(vars))
+	for i, v := range vars {
+		sums[i] = summarize(v)
+	}
+	return sums, nil
+}
+
+func summarize(v *Variable) Summary {
+	s := Summary{Name: v.Name, Mean: Missing, SD: Missing, Min: Missing, Max: Missing}
+	if v.IsString() {
+		return s
+	}
+	// Welford's algorithm avoids the loss of precision of the textbook formula
+	var mean, m2 float64
+	for _, x := range v.nums {
+		if IsMissing(x) {
+			continue
+		}
+		if s.N == 0 || x < s.Min {
+			s.Min = x
+		}
+		if s.N == 0 || x > s.Max {
+			s.Max = x
+		}
+		s.N++
+		s.Sum += x
+		d := x - mean
+		mean += d / float64(s.N)
+		m2 += d * (x - mean)
+	}
+	if s.N > 0 {
+		s.Mean = mean
+	}
+	if s.N > 1 {
+		s.SD = math.Sqrt(m2 / float64(s.N-1))
+	}
+	return s
+}
+
+// Category is a distinct value of a tabulated variable.
+type Category struct {
+	Num   float64 // value of a numeric variable
+	Str   string  // value of a string variable
+	Label string  // value label, if any
+	isStr bool
+}
+
+// String returns the value label if there is one, otherwise the value as Stata displays it.
+func (c Category) String() string {
+	if c.Label != "" {
+		return c.Label
+	}
+	if c.isStr {
+		return c.Str
+	}
+	return formatCategory(c.Num)
+}
+
+func formatCategory(x float64) string {
+	if code := MissingCode(x); code != 0 {
+		if code == '.' {
+			return "."
+		}
+		return "." + string(code)
+	}
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
+
+// Table is a one-way or two-way frequency table produced by Tabulate.
+type Table struct {
+	Vars   []string   // the tabulated variables
+	Rows   []Category // values of the first variable in ascending order
+	Cols   []Category // values of the second variable; nil for a one-way table
+	Counts [][]int    // Counts[i][j] is the frequency of Rows[i] and Cols[j]; one column for a one-way table
+	Total  int
+}
+
+// RowTotal returns the frequency of Rows[i].
+func (t *Table) RowTotal(i int) int {
+	n := 0
+	for _, c := range t.Counts[i] {
+		n += c
+	}
+	return n
+}
+
+// ColTotal returns the frequency of Cols[j].
+func (t *Table) ColTotal(j int) int {
+	n := 0
+	for _, row := range t.Counts {
+		n += row[j]
+	}
+	return n
+}
+
+// Percent returns the percentage of observations in Rows[i].
+func (t *Table) Percent(i int) float64 {
+	if t.Total == 0 {
+		return Missing
+	}
+	return 100 * float64(t.RowTotal(i)) / float64(t.Total)
+}
+
+// Freq returns the frequency of the row (and, for two-way tables, column) categories
+// whose String() is row (and col), or 0 if there is none.
+func (t *Table) Freq(row string, col ...string) int {
+	i := findCategory(t.Rows, row)
+	if i < 0 {
+		return 0
+	}
+	if len(col) == 0 {
+		return t.RowTotal(i)
+	}
+	j := findCategory(t.Cols, col[0])
+	if j < 0 {
+		return 0
+	}
+	return t.Counts[i][j]
+}
+
+func findCategory(cats []Category, s string) int {
+	for i, c := range cats {
+		if c.String() == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// Tabulate counts the observations for each value of one variable, or each combination of
+// values of two variables, like Stata's tabulate. Observations with missing values are
+// excluded unless missing is true.
+func (ds *Dataset) Tabulate(missing bool, names ...string) (*Table, error) {
+	if len(names) < 1 || len(names) > 2 {
+		return nil, fmt.Errorf("tabulate: one or two variables required, %d given", len(names))
+	}
+	vars, err := ds.lookup(names)
+	if err != nil {
+		return nil, err
+	}
+	t := &Table{Vars: names}
+	rows := ds.categories(vars[0], missing)
+	t.Rows = rows.cats
+	var cols categoryIndex
+	if len(vars) == 2 {
+		cols = ds.categories(vars[1], missing)
+		t.Cols = cols.cats
+	}
+	t.Counts = make([][]int, len(t.Rows))
+	for i := range t.Counts {
+		t.Counts[i] = make([]int, max(len(t.Cols), 1))
+	}
+	for obs := 0; obs < ds.nobs; obs++ {
+		i, ok := rows.index[categoryKey(vars[0], obs)]
+		if !ok {
+			continue
+		}
+		j := 0
+		if len(vars) == 2 {
+			if j, ok = cols.index[categoryKey(vars[1], obs)]; !ok {
+				continue
+			}
+		}
+		t.Counts[i][j]++
+		t.Total++
+	}
+	return t, nil
+}
+
+type categoryIndex struct {
+	index map[string]int
+	cats  []Category
+}
+
+// categories returns the sorted distinct values of v.
+func (ds *Dataset) categories(v *Variable, missing bool) categoryIndex {
+	seen := make(map[string]bool)
+	var rows []int
+	for obs := 0; obs < ds.nobs; obs++ {
+		if !missing && isMissingObs(v, obs) {
+			continue
+		}
+		k := categoryKey(v, obs)
+		if _, ok := seen[k]; !ok {
+			seen[k] = true
+			rows = append(rows, obs)
+		}
+	}
+	sort.Slice(rows, func(a, b int) bool {
+		return compareObs([]*Variable{v}, rows[a], []*Variable{v}, rows[b]) < 0
+	})
+	vl := ds.labels[v.ValueLabel]
+	ci := categoryIndex{index: make(map[string]int, len(rows)), cats: make([]Category, len(rows))}
+	for i, obs := range rows {
+		c := Category{Num: v.Float(obs), Str: v.Str(obs), isStr: v.IsString()}
+		if vl != nil && !v.IsString() && !IsMissing(c.Num) && c.Num == math.Trunc(c.Num) {
+			c.Label, _ = vl.Label(int32(c.Num))
+		}
+		ci.cats[i] = c
+		ci.index[categoryKey(v, obs)] = i
+	}
+	return ci
+}
+
+func categoryKey(v *Variable, obs int) string {
+	if v.IsString() {
+		return v.strs[obs]
+	}
+	return strconv.FormatUint(math.Float64bits(v.nums[obs]), 16)
+}
+
+// isMissingObs reports whether observation obs of v is missing: a missing value for numeric
+// variables and "" for strings.
+func isMissingObs(v *Variable, obs int) bool {
+	if v.IsString() {
+		return v.strs[obs] == ""
+	}
+	return IsMissing(v.nums[obs])
+}
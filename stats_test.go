@@ -0,0 +1,117 @@
+package gostata
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+// TestSummarizeSmall checks what testing/do.do checks in Stata, on a file read back from disk.
+func TestSummarizeSmall(t *testing.T) {
+	is := is.New(t)
+	sf := NewFile()
+	sf.AddField("i8", "int8", []Byte{1, 2, 3, 4, 5, 6})
+	sf.AddField("f64", "float64", []Double{6.5, 7.5, 3.5, 4.5, 5.5, 6.5})
+	fileName := filepath.Join(t.TempDir(), "small.dta")
+	is.NoErr(sf.WriteFile(fileName))
+
+	ds, err := ReadFile(fileName)
+	is.NoErr(err)
+	is.Equal(ds.NumObs(), 6)
+	sums, err := ds.Summarize("i8")
+	is.NoErr(err)
+	s := sums[0]
+	is.Equal(s.N, 6)
+	is.Equal(s.Mean, 3.5)
+	is.Equal(s.Min, 1.0)
+	is.Equal(s.Max, 6.0)
+	is.Equal(s.Sum, 21.0)
+	is.True(math.Abs(s.SD-1.870828693) < 1e-9)
+}
+
+// TestSummarizeLarge mirrors testing/large.do.
+func TestSummarizeLarge(t *testing.T) {
+	is := is.New(t)
+	const N = 100000
+	r := rand.New(rand.NewSource(1))
+	values := make([]float64, N)
+	for i := range values {
+		values[i] = r.NormFloat64()
+	}
+	ds := NewDataset()
+	_, err := ds.AddNumeric("f64", StataDoubleId, values)
+	is.NoErr(err)
+	fileName := filepath.Join(t.TempDir(), "large.dta")
+	is.NoErr(ds.WriteFile(fileName))
+	ds, err = ReadFile(fileName)
+	is.NoErr(err)
+	sums, err := ds.Summarize()
+	is.NoErr(err)
+	is.Equal(sums[0].N, N)
+	is.True(math.Abs(sums[0].Mean) < 0.01)
+	is.True(math.Abs(sums[0].SD-1) < 0.01)
+}
+
+func TestSummarizeMissing(t *testing.T) {
+	is := is.New(t)
+	ds := NewDataset()
+	_, err := ds.AddNumeric("x", StataFloatId, []float64{Missing, 2, ExtendedMissing('a'), 4})
+	is.NoErr(err)
+	_, err = ds.AddNumeric("y", StataByteId, []float64{Missing, 1, Missing, Missing})
+	is.NoErr(err)
+	_, err = ds.AddString("s", []string{"a", "b", "c", "d"})
+	is.NoErr(err)
+	sums, err := ds.Summarize()
+	is.NoErr(err)
+	is.Equal(sums[0].N, 2)
+	is.Equal(sums[0].Mean, 3.0)
+	is.Equal(sums[0].Max, 4.0)
+	is.Equal(sums[1].N, 1)
+	is.True(IsMissing(sums[1].SD))
+	is.Equal(sums[2].N, 0)
+	is.True(IsMissing(sums[2].Mean))
+	_, err = ds.Summarize("nope")
+	is.True(err != nil)
+}
+
+func TestTabulate(t *testing.T) {
+	is := is.New(t)
+	ds := NewDataset()
+	sex, err := ds.AddNumeric("sex", StataByteId, []float64{1, 2, 2, 1, 2, Missing})
+	is.NoErr(err)
+	sex.ValueLabel = "sexlbl"
+	vl := NewValueLabel("sexlbl")
+	vl.Set(1, "male")
+	vl.Set(2, "female")
+	is.NoErr(ds.DefineLabel(vl))
+	_, err = ds.AddString("grp", []string{"b", "a", "b", "b", "", "a"})
+	is.NoErr(err)
+
+	tab, err := ds.Tabulate(false, "sex")
+	is.NoErr(err)
+	is.Equal(tab.Total, 5)
+	is.Equal(len(tab.Rows), 2)
+	is.Equal(tab.Rows[0].String(), "male")
+	is.Equal(tab.Freq("female"), 3)
+	is.Equal(tab.Percent(0), 40.0)
+
+	tab, err = ds.Tabulate(true, "sex")
+	is.NoErr(err)
+	is.Equal(tab.Total, 6)
+	is.Equal(tab.Freq("."), 1)
+
+	tab, err = ds.Tabulate(false, "sex", "grp")
+	is.NoErr(err)
+	is.Equal(tab.Total, 4)
+	is.Equal(tab.Cols[0].String(), "a")
+	is.Equal(tab.Freq("male", "b"), 2)
+	is.Equal(tab.Freq("female", "a"), 1)
+	is.Equal(tab.Freq("female", "b"), 1)
+	is.Equal(tab.ColTotal(1), 3)
+
+	_, err = ds.Tabulate(false)
+	is.True(err != nil)
+}
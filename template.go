@@ -0,0 +1,206 @@
+package gostata
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DoTemplate is a do-file template: a text/template with functions that insert Go values
+// as valid, safely quoted Stata code. Values interpolated directly, as in {{.Name}}, are
+// inserted as is; pass them through one of these functions instead:
+//
+//	quote    a string in compound double quotes, with ` and $ escaped: `"it's $5"' -> `"it's \$5"'
+//	name     a variable, macro or file handle name, which must be a valid Stata name
+//	varlist  a list of names separated by spaces
+//	num      a number, exactly: 0.1 gives 0.1, Missing gives .
+//	value    a literal of any supported type: string, integer, float, bool or time.Time (a %td date)
+//	local    a local macro definition: {{local "n" .N}} gives local n 10000
+//	global   a global macro definition
+//	locals   local definitions for the entries of a map, one per line in name order
+type DoTemplate struct {
+	t *template.Template
+}
+
+// doFuncs are the functions available in templates.
+var doFuncs = template.FuncMap{
+	"quote":   QuoteString,
+	"name":    quoteName,
+	"varlist": Varlist,
+	"num":     FormatNumber,
+	"value":   FormatValue,
+	"local": func(name string, v any) (string, error) {
+		return macroDefinition("local", name, v)
+	},
+	"global": func(name string, v any) (string, error) {
+		return macroDefinition("global", name, v)
+	},
+	"locals": Locals,
+}
+
+// NewDoTemplate parses text as a do-file template.
+func NewDoTemplate(name, text string) (*DoTemplate, error) {
+	t, err := template.New(name).Funcs(doFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &DoTemplate{t: t}, nil
+}
+
+// Execute returns the do-file for data.
+func (t *DoTemplate) Execute(data any) (string, error) {
+	var sb strings.Builder
+	if err := t.t.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// QuoteString returns s as a Stata string literal in compound double quotes, escaping the
+// macro characters ` and $ so they are not expanded. Strings that contain a line break or
+// unbalanced compound quotes cannot be quoted.
+func QuoteString(s string) (string, error) {
+	if strings.ContainsAny(s, "\n\r") {
+		return "", fmt.Errorf("cannot quote %q: strings cannot contain line breaks", s)
+	}
+	// compound quotes nest, so embedded `" and "' must be balanced
+	depth := 0
+	for i := 0; i+1 < len(s); i++ {
+		switch s[i : i+2] {
+		case "`\"":
+			depth++
+			i++
+		case "\"'":
+			if depth--; depth < 0 {
+				return "", fmt.Errorf("cannot quote %q: unbalanced compound quotes", s)
+			}
+			i++
+		}
+	}
+	if depth != 0 {
+		return "", fmt.Errorf("cannot quote %q: unbalanced compound quotes", s)
+	}
+	return "`\"" + escapeMacros(s) + "\"'", nil
+}
+
+// escapeMacros prefixes ` and $ with a backslash so that Stata does not expand them.
+func escapeMacros(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		// `" opens a nested compound quote and must stay as is
+		if c == '$' || c == '`' && (i+1 == len(s) || s[i+1] != '"') {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+func quoteName(name string) (string, error) {
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// Varlist returns names separated by spaces, after checking that each is a valid Stata name.
+func Varlist(names []string) (string, error) {
+	if err := checkNames(names); err != nil {
+		return "", err
+	}
+	return strings.Join(names, " "), nil
+}
+
+// FormatNumber returns x as a Stata numeric literal that reads back as exactly x.
+// Missing values give . or .a to .z; infinities and NaN, which Stata lacks, are an error.
+func FormatNumber(x float64) (string, error) {
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return "", fmt.Errorf("%v has no Stata equivalent", x)
+	}
+	if code := MissingCode(x); code == '.' {
+		return ".", nil
+	} else if code != 0 {
+		return "." + string(code), nil
+	}
+	return strconv.FormatFloat(x, 'g', -1, 64), nil
+}
+
+// FormatValue returns v as a Stata literal: strings are quoted with QuoteString, numbers
+// formatted with FormatNumber, booleans give 1 or 0 and times a td() date. Slices give
+// their elements separated by spaces.
+func FormatValue(v any) (string, error) {
+	switch x := v.(type) {
+	case string:
+		return QuoteString(x)
+	case bool:
+		if x {
+			return "1", nil
+		}
+		return "0", nil
+	case time.Time:
+		return "td(" + strings.ToLower(x.Format("02Jan2006")) + ")", nil
+	case float64:
+		return FormatNumber(x)
+	case float32:
+		return FormatNumber(float64(x))
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Slice, reflect.Array:
+		items := make([]string, rv.Len())
+		for i := range items {
+			s, err := FormatValue(rv.Index(i).Interface())
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, " "), nil
+	}
+	return "", fmt.Errorf("cannot convert %T to a Stata value", v)
+}
+
+func macroDefinition(kind, name string, v any) (string, error) {
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+	value, err := FormatValue(v)
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %w", kind, name, err)
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		// keep the quotes of the elements: the outer compound quotes are stripped
+		value = "`\"" + value + "\"'"
+	}
+	return kind + " " + name + " " + value, nil
+}
+
+// Locals returns local macro definitions for the entries of values, one per line in
+// name order, eg to pass the parameters of a simulation to a do-file.
+func Locals(values map[string]any) (string, error) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	for _, name := range names {
+		def, err := macroDefinition("local", name, values[name])
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(def)
+		sb.WriteByte('\n')
+	}
+	return sb.String(), nil
+}
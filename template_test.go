@@ -0,0 +1,140 @@
+package gostata
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuoteString(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", "`\"\"'"},
+		{"plain", "`\"plain\"'"},
+		{`say "hi"`, "`\"say \"hi\"\"'"},
+		{"it's", "`\"it's\"'"},
+		{"cost $5", "`\"cost \\$5\"'"},
+		{"`n'", "`\"\\`n'\"'"},
+		{"a `\"nested\"' b", "`\"a `\"nested\"' b\"'"},
+	}
+	for _, tt := range tests {
+		got, err := QuoteString(tt.in)
+		if err != nil {
+			t.Errorf("QuoteString(%q): %v", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("QuoteString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+	for _, in := range []string{"two\nlines", "end\"' rm", "`\"open"} {
+		if got, err := QuoteString(in); err == nil {
+			t.Errorf("QuoteString(%q) = %s, want error", in, got)
+		}
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		in   any
+		want string
+	}{
+		{10000, "10000"},
+		{int8(-3), "-3"},
+		{uint16(7), "7"},
+		{0.1, "0.1"},
+		{float32(0.5), "0.5"},
+		{1e-20, "1e-20"},
+		{Missing, "."},
+		{ExtendedMissing('b'), ".b"},
+		{true, "1"},
+		{false, "0"},
+		{time.Date(2026, 3, 7, 0, 0, 0, 0, time.UTC), "td(07mar2026)"},
+		{"x", "`\"x\"'"},
+		{[]string{"a b", "c"}, "`\"a b\"' `\"c\"'"},
+		{[]int{1, 2}, "1 2"},
+	}
+	for _, tt := range tests {
+		got, err := FormatValue(tt.in)
+		if err != nil {
+			t.Errorf("FormatValue(%v): %v", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("FormatValue(%v) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+	for _, in := range []any{math.NaN(), math.Inf(1), struct{}{}, []any{"ok", math.Inf(-1)}} {
+		if got, err := FormatValue(in); err == nil {
+			t.Errorf("FormatValue(%v) = %s, want error", in, got)
+		}
+	}
+}
+
+func TestLocals(t *testing.T) {
+	got, err := Locals(map[string]any{
+		"n":                10000,
+		"annual_vacc_prob": 0.6,
+		"label":            "Flu $season",
+		"vars":             []string{"flu", "nonflu"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "local annual_vacc_prob 0.6\n" +
+		"local label `\"Flu \\$season\"'\n" +
+		"local n 10000\n" +
+		"local vars `\"`\"flu\"' `\"nonflu\"'\"'\n"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if _, err := Locals(map[string]any{"bad name": 1}); err == nil {
+		t.Error("invalid macro name accepted")
+	}
+}
+
+func TestDoTemplate(t *testing.T) {
+	tmpl, err := NewDoTemplate("sim", `set seed {{num .Seed}}
+{{local "n" .N}}
+{{locals .Params}}
+{{global "title" .Title}}
+clear
+set obs `+"`n'"+`
+gen {{name .Var}} = runiform() < `+"`test_prob'"+`
+keep {{varlist .Keep}}
+save {{quote .Out}}, replace
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]any{
+		"Seed":   9999.0,
+		"N":      10000,
+		"Params": map[string]any{"test_prob": 0.1, "flu_peroid": 120},
+		"Title":  "Sim `run' $1",
+		"Var":    "tested",
+		"Keep":   []string{"tested"},
+		"Out":    "/tmp/out dir/sim.dta",
+	}
+	got, err := tmpl.Execute(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "set seed 9999\n" +
+		"local n 10000\n" +
+		"local flu_peroid 120\nlocal test_prob 0.1\n\n" +
+		"global title `\"Sim \\`run' \\$1\"'\n" +
+		"clear\n" +
+		"set obs `n'\n" +
+		"gen tested = runiform() < `test_prob'\n" +
+		"keep tested\n" +
+		"save `\"/tmp/out dir/sim.dta\"', replace\n"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	data["Var"] = "drop x"
+	if _, err := tmpl.Execute(data); err == nil || !strings.Contains(err.Error(), "drop x") {
+		t.Errorf("invalid name: got error %v", err)
+	}
+	delete(data, "Var")
+	if _, err := tmpl.Execute(data); err == nil {
+		t.Error("missing key accepted")
+	}
+}
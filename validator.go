@@ -0,0 +1,542 @@
+package gostata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// Severity classifies a Problem found by Validate.
+type Severity int
+
+const (
+	SeverityError   Severity = iota // the file is malformed: Stata or Reader may refuse it or misread it
+	SeverityWarning                 // the file can be read but breaks a convention, eg a non-canonical missing value
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Problem is a defect of a dta file found by Validate.
+type Problem struct {
+	Offset   int64  // offset in the file of the first byte concerned
+	Section  string // header, descriptors, characteristics, data or value labels
+	Severity Severity
+	Message  string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("offset %d: %s: %s: %s", p.Offset, p.Section, p.Severity, p.Message)
+}
+
+// HasErrors reports whether problems include a SeverityError.
+func HasErrors(problems []Problem) bool {
+	for _, p := range problems {
+		if p.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// dta format 113 to 115 layout
+const (
+	headerSize     = 109 // version to time stamp
+	stampSize      = 18
+	labelTableHead = 4 + stataVarSize + 3 // length, name and padding of a value label table
+)
+
+// Validate walks the dta file of size bytes in r and reports the structural problems it
+// finds, with their byte offsets: invalid header fields, descriptors that do not fit in the
+// file, invalid type codes, names and labels without a terminating NUL, a file length that
+// does not match the number and size of the observations (as left by a File whose EndWrite
+// was interrupted), invalid value label tables, and non-canonical missing values.
+//
+// Validation stops at the first problem that makes the rest of the file unreadable, eg an
+// invalid type code, which hides the size of the observations. The error is only non-nil
+// if r cannot be read.
+func Validate(r io.ReaderAt, size int64) ([]Problem, error) {
+	v := &validator{r: bufio.NewReaderSize(io.NewSectionReader(r, 0, size), 64*1024), size: size}
+	steps := []func() (bool, error){v.header, v.descriptors, v.characteristics, v.data, v.valueLabels}
+	for _, step := range steps {
+		ok, err := step()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+	}
+	return v.problems, nil
+}
+
+// ValidateFile validates the dta file fileName; see Validate.
+func ValidateFile(fileName string) ([]Problem, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Validate(f, fi.Size())
+}
+
+// validator holds the state of Validate as it walks a file.
+type validator struct {
+	r        *bufio.Reader
+	off      int64 // offset of the next byte of r
+	size     int64
+	section  string
+	problems []Problem
+
+	version    byte
+	order      binary.ByteOrder
+	nvar, nobs int
+	types      []byte
+	names      []string
+	labelNames []string // value labels attached to the variables
+	labelOffs  []int64  // offsets of labelNames
+	recSize    int64
+}
+
+func (v *validator) errorf(off int64, format string, a ...any) {
+	v.problems = append(v.problems, Problem{off, v.section, SeverityError, fmt.Sprintf(format, a...)})
+}
+
+func (v *validator) warnf(off int64, format string, a ...any) {
+	v.problems = append(v.problems, Problem{off, v.section, SeverityWarning, fmt.Sprintf(format, a...)})
+}
+
+// read returns the next n bytes of the file, which hold what. If the file ends before, it
+// reports the truncation and returns nil.
+func (v *validator) read(n int64, what string) ([]byte, error) {
+	if n > v.size-v.off {
+		v.errorf(v.off, "file ends %d bytes into the %d bytes of %s", v.size-v.off, n, what)
+		return nil, nil
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(v.r, b); err != nil {
+		return nil, fmt.Errorf("reading offset %d: %w", v.off, err)
+	}
+	v.off += n
+	return b, nil
+}
+
+// cField returns the text of the NUL-terminated field b at offset off, reporting what
+// if it has no NUL.
+func (v *validator) cField(b []byte, off int64, what string) string {
+	if bytes.IndexByte(b, 0) < 0 {
+		v.errorf(off, "%s is not terminated by a NUL byte", what)
+	}
+	return cString(b)
+}
+
+func (v *validator) header() (bool, error) {
+	v.section = "header"
+	if p, _ := v.r.Peek(len("<stata_dta>")); string(p) == "<stata_dta>" {
+		v.errorf(0, "dta format 117 or later, only formats 113 to 115 are supported")
+		return false, nil
+	}
+	b, err := v.read(headerSize, "the header")
+	if b == nil {
+		return false, err
+	}
+	v.version = b[0]
+	if v.version < 113 || v.version > 115 {
+		v.errorf(0, "invalid or unsupported format %d, expected 113, 114 or 115", v.version)
+		return false, nil
+	}
+	switch b[1] {
+	case 1:
+		v.order = binary.BigEndian
+	case 2:
+		v.order = binary.LittleEndian
+	default:
+		v.errorf(1, "invalid byte order %d, expected 1 (HILO) or 2 (LOHI)", b[1])
+		return false, nil
+	}
+	if b[2] != 1 {
+		v.errorf(2, "invalid file type %d, expected 1", b[2])
+	}
+	nvar, nobs := int16(v.order.Uint16(b[4:])), int32(v.order.Uint32(b[6:]))
+	if nvar < 0 {
+		v.errorf(4, "negative number of variables %d", nvar)
+	}
+	if nobs < 0 {
+		v.errorf(6, "negative number of observations %d", nobs)
+	}
+	if nvar < 0 || nobs < 0 {
+		return false, nil
+	}
+	v.nvar, v.nobs = int(nvar), int(nobs)
+	v.cField(b[10:10+stataLabelSize], 10, "the dataset label")
+	const stampOff = 10 + stataLabelSize
+	stamp := v.cField(b[stampOff:stampOff+stampSize], stampOff, "the time stamp")
+	if _, err := time.Parse("_2 Jan 2006 15:04", stamp); stamp != "" && err != nil {
+		v.warnf(stampOff, "time stamp %q is not in the form 02 Jan 2006 15:04", stamp)
+	}
+	return true, nil
+}
+
+func (v *validator) descriptors() (bool, error) {
+	v.section = "descriptors"
+	fmtSize := stataFmtSize
+	if v.version >= 114 {
+		fmtSize = 49
+	}
+	nvar := v.nvar
+	start := v.off
+	b, err := v.read(int64(nvar*(1+stataVarSize+2+fmtSize+stataVarSize+stataLabelSize)+2),
+		fmt.Sprintf("the descriptors of %d variables", nvar))
+	if b == nil {
+		return false, err
+	}
+	// offsets of typlist, varlist, srtlist, fmtlist, lbllist and variable labels within b
+	typOff := 0
+	varOff := typOff + nvar
+	srtOff := varOff + nvar*stataVarSize
+	fmtOff := srtOff + 2*(nvar+1)
+	lblOff := fmtOff + nvar*fmtSize
+	vlblOff := lblOff + nvar*stataVarSize
+	field := func(base, size, i int) ([]byte, int64) {
+		at := base + i*size
+		return b[at : at+size], start + int64(at)
+	}
+
+	ok := true
+	v.types = b[typOff:varOff]
+	for i, typ := range v.types {
+		if !validType(typ) {
+			v.errorf(start+int64(typOff+i), "variable %d: invalid type code %d", i+1, typ)
+			ok = false
+		}
+	}
+	seen := make(map[string]bool, nvar)
+	v.names = make([]string, nvar)
+	for i := range v.names {
+		fb, off := field(varOff, stataVarSize, i)
+		name := v.cField(fb, off, fmt.Sprintf("the name of variable %d", i+1))
+		if err := ValidateName(name); err != nil {
+			v.errorf(off, "variable %d: %v", i+1, err)
+		} else if seen[name] {
+			v.errorf(off, "variable %d: duplicate name %s", i+1, name)
+		}
+		seen[name] = true
+		v.names[i] = name
+	}
+	v.checkSortList(b[srtOff:fmtOff], start+int64(srtOff))
+	for i, typ := range v.types {
+		fb, off := field(fmtOff, fmtSize, i)
+		format := v.cField(fb, off, fmt.Sprintf("the format of %s", v.names[i]))
+		switch {
+		case ValidateFormat(format) != nil:
+			v.warnf(off, "variable %s: invalid format %q", v.names[i], format)
+		case isStrType(typ) != stringFormat.MatchString(format):
+			v.warnf(off, "variable %s: format %q does not suit type %s", v.names[i], format, typeName(typ))
+		}
+	}
+	v.labelNames = make([]string, nvar)
+	v.labelOffs = make([]int64, nvar)
+	for i, typ := range v.types {
+		fb, off := field(lblOff, stataVarSize, i)
+		name := v.cField(fb, off, fmt.Sprintf("the value label name of %s", v.names[i]))
+		v.labelNames[i], v.labelOffs[i] = name, off
+		switch {
+		case name == "":
+		case ValidateName(name) != nil:
+			v.errorf(off, "variable %s: invalid value label name %q", v.names[i], name)
+		case isStrType(typ):
+			v.warnf(off, "variable %s: value label %s attached to a string variable", v.names[i], name)
+		}
+	}
+	for i := range v.types {
+		fb, off := field(vlblOff, stataLabelSize, i)
+		v.cField(fb, off, fmt.Sprintf("the label of %s", v.names[i]))
+	}
+	return ok, nil
+}
+
+// checkSortList checks the srtlist b at offset off: the 1-based numbers of the sort
+// variables followed by 0.
+func (v *validator) checkSortList(b []byte, off int64) {
+	used := make(map[int]bool)
+	for k := 0; k < len(b)/2; k++ {
+		n := int(int16(v.order.Uint16(b[2*k:])))
+		switch {
+		case n == 0:
+			return
+		case n < 0 || n > v.nvar:
+			v.errorf(off+int64(2*k), "sort list refers to variable %d of %d", n, v.nvar)
+		case used[n]:
+			v.errorf(off+int64(2*k), "sort list repeats variable %d", n)
+		}
+		used[n] = true
+	}
+	v.errorf(off, "sort list is not terminated by 0")
+}
+
+// characteristics checks the expansion fields between the descriptors and the data.
+func (v *validator) characteristics() (bool, error) {
+	v.section = "characteristics"
+	for {
+		start := v.off
+		b, err := v.read(5, "an expansion field header")
+		if b == nil {
+			return false, err
+		}
+		typ, n := b[0], int32(v.order.Uint32(b[1:]))
+		if typ == 0 {
+			if n != 0 {
+				v.errorf(start, "end of the expansion fields has length %d, expected 0", n)
+			}
+			return true, nil
+		}
+		if n < 0 {
+			v.errorf(start+1, "expansion field of negative length %d", n)
+			return false, nil
+		}
+		data, err := v.read(int64(n), "an expansion field")
+		if data == nil {
+			return false, err
+		}
+		if typ != 1 {
+			v.warnf(start, "expansion field of unknown type %d", typ)
+			continue
+		}
+		if n < 2*stataVarSize+1 {
+			v.errorf(start, "characteristic of %d bytes, too short for its names and text", n)
+			continue
+		}
+		owner := v.cField(data[:stataVarSize], start+5, "the variable name of a characteristic")
+		v.cField(data[stataVarSize:2*stataVarSize], start+5+stataVarSize, "the name of a characteristic")
+		if data[n-1] != 0 {
+			v.errorf(start+5+int64(n)-1, "text of characteristic %s is not terminated by a NUL byte", owner)
+		}
+		if owner != "_dta" && !v.isVar(owner) {
+			v.warnf(start+5, "characteristic of unknown variable %s", owner)
+		}
+	}
+}
+
+func (v *validator) isVar(name string) bool {
+	for _, n := range v.names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// nonCanonical counts the non-canonical values of a variable.
+type nonCanonical struct {
+	count int
+	obs   int   // first observation
+	off   int64 // offset of the first value
+	what  string
+}
+
+// data checks that the file holds the observations declared in the header and that
+// numeric values use the canonical missing values.
+func (v *validator) data() (bool, error) {
+	v.section = "data"
+	for _, typ := range v.types {
+		v.recSize += int64(fieldWidth(typ))
+	}
+	start := v.off
+	nobs := v.nobs
+	if v.recSize > 0 && int64(nobs)*v.recSize > v.size-start {
+		held := int((v.size - start) / v.recSize)
+		v.errorf(start+int64(held)*v.recSize,
+			"file ends in observation %d: the header declares %d observations of %d bytes, the file holds %d (was the file truncated?)",
+			held+1, nobs, v.recSize, held)
+		nobs = held
+	}
+	bad := make([]nonCanonical, len(v.types))
+	rec := make([]byte, v.recSize)
+	for i := 0; i < nobs; i++ {
+		if _, err := io.ReadFull(v.r, rec); err != nil {
+			return false, fmt.Errorf("reading offset %d: %w", v.off, err)
+		}
+		at := 0
+		for k, typ := range v.types {
+			if what := v.checkValue(typ, rec[at:]); what != "" {
+				if bad[k].count == 0 {
+					bad[k] = nonCanonical{obs: i + 1, off: v.off + int64(at), what: what}
+				}
+				bad[k].count++
+			}
+			at += fieldWidth(typ)
+		}
+		v.off += v.recSize
+	}
+	for k, b := range bad {
+		if b.count > 0 {
+			v.warnf(b.off, "variable %s: %d non-canonical values, the first in observation %d: %s",
+				v.names[k], b.count, b.obs, b.what)
+		}
+	}
+	return nobs == v.nobs, nil
+}
+
+// checkValue returns a description of the value of type typ at the start of b if it is
+// outside the range of the type or a non-canonical missing value, and "" otherwise.
+func (v *validator) checkValue(typ byte, b []byte) string {
+	switch typ {
+	case StataByteId:
+		if x := int8(b[0]); x < DtaMinByte {
+			return fmt.Sprintf("byte %d is below the minimum %d", x, DtaMinByte)
+		}
+	case StataIntId:
+		if x := int16(v.order.Uint16(b)); x < DtaMinInt {
+			return fmt.Sprintf("int %d is below the minimum %d", x, DtaMinInt)
+		}
+	case StataLongId:
+		if x := int32(v.order.Uint32(b)); x < DtaMinLong {
+			return fmt.Sprintf("long %d is below the minimum %d", x, DtaMinLong)
+		}
+	case StataFloatId:
+		bits := v.order.Uint32(b)
+		if bits&0x7fffffff <= dtaMaxFloatBits {
+			return ""
+		}
+		if bits >= dtaMissingFloat && bits < 0x80000000 &&
+			(bits-dtaMissingFloat)%dtaFloatStep == 0 && (bits-dtaMissingFloat)/dtaFloatStep < dtaNumCodes {
+			return ""
+		}
+		return fmt.Sprintf("float %#08x is not a missing value", bits)
+	case StataDoubleId:
+		bits := v.order.Uint64(b)
+		if bits&math.MaxInt64 <= dtaMaxDoubleBits {
+			return ""
+		}
+		if bits >= dtaMissingDouble && bits < 1<<63 &&
+			(bits-dtaMissingDouble)%dtaDoubleStep == 0 && (bits-dtaMissingDouble)/dtaDoubleStep < dtaNumCodes {
+			return ""
+		}
+		return fmt.Sprintf("double %#016x is not a missing value", bits)
+	}
+	return ""
+}
+
+// fieldWidth returns the size in bytes of a value of type typ.
+func fieldWidth(typ byte) int {
+	switch typ {
+	case StataByteId:
+		return 1
+	case StataIntId:
+		return 2
+	case StataLongId, StataFloatId:
+		return 4
+	case StataDoubleId:
+		return 8
+	}
+	return int(typ)
+}
+
+// valueLabels checks the value label tables that fill the rest of the file.
+func (v *validator) valueLabels() (bool, error) {
+	v.section = "value labels"
+	if !v.plausibleLabelTable() {
+		// the bytes after the data are more observations, not value labels
+		extra := v.size - v.off
+		if v.recSize > 0 && extra%v.recSize == 0 {
+			v.errorf(v.off, "%d bytes after the data are %d observations of %d bytes: the header declares %d observations instead of %d (was the file closed before the header was updated?)",
+				extra, extra/v.recSize, v.recSize, v.nobs, int64(v.nobs)+extra/v.recSize)
+			return false, nil
+		}
+	}
+	defined := make(map[string]bool)
+	for v.off < v.size {
+		start := v.off
+		head, err := v.read(labelTableHead, "a value label table header")
+		if head == nil {
+			return false, err
+		}
+		n := int32(v.order.Uint32(head))
+		name := v.cField(head[4:4+stataVarSize], start+4, "the name of a value label")
+		if err := ValidateName(name); err != nil {
+			v.errorf(start+4, "value label: %v", err)
+		} else if defined[name] {
+			v.errorf(start+4, "value label %s is defined twice", name)
+		}
+		defined[name] = true
+		if n < 8 {
+			v.errorf(start, "value label %s: table length %d is less than 8", name, n)
+			return false, nil
+		}
+		table, err := v.read(int64(n), "value label "+name)
+		if table == nil {
+			return false, err
+		}
+		v.checkLabelTable(name, table, start+labelTableHead)
+	}
+	for i, name := range v.labelNames {
+		if name != "" && !defined[name] {
+			v.warnf(v.labelOffs[i], "variable %s: value label %s is not defined", v.names[i], name)
+		}
+	}
+	return true, nil
+}
+
+// plausibleLabelTable reports whether the file ends after the data or continues with
+// what looks like a value label table.
+func (v *validator) plausibleLabelTable() bool {
+	extra := v.size - v.off
+	if extra == 0 {
+		return true
+	}
+	head, _ := v.r.Peek(labelTableHead + 8)
+	if len(head) < labelTableHead+8 {
+		return false
+	}
+	n := int64(int32(v.order.Uint32(head)))
+	count := int64(int32(v.order.Uint32(head[labelTableHead:])))
+	txtLen := int64(int32(v.order.Uint32(head[labelTableHead+4:])))
+	return bytes.IndexByte(head[4:4+stataVarSize], 0) >= 0 && count >= 0 && txtLen >= 0 &&
+		n == 8+8*count+txtLen && labelTableHead+n <= extra
+}
+
+// checkLabelTable checks the table of value label name at offset off: the number of
+// entries n, the length of the text, n text offsets, n values and the text.
+func (v *validator) checkLabelTable(name string, table []byte, off int64) {
+	n := int64(int32(v.order.Uint32(table)))
+	txtLen := int64(int32(v.order.Uint32(table[4:])))
+	if n < 0 || txtLen < 0 || 8+8*n+txtLen != int64(len(table)) {
+		v.errorf(off, "value label %s: %d entries and %d bytes of text do not fill the table of %d bytes",
+			name, n, txtLen, len(table))
+		return
+	}
+	offs, values, txt := table[8:8+4*n], table[8+4*n:8+8*n], table[8+8*n:]
+	for i := int64(0); i < n; i++ {
+		at := int64(int32(v.order.Uint32(offs[4*i:])))
+		value := int32(v.order.Uint32(values[4*i:]))
+		switch {
+		case at < 0 || at >= txtLen:
+			v.errorf(off+8+4*i, "value label %s: text offset %d of value %d is outside the text of %d bytes",
+				name, at, value, txtLen)
+		case bytes.IndexByte(txt[at:], 0) < 0:
+			v.errorf(off+8+8*n+at, "value label %s: text of value %d is not terminated by a NUL byte", name, value)
+		}
+		if i == 0 {
+			continue
+		}
+		switch prev := int32(v.order.Uint32(values[4*(i-1):])); {
+		case value == prev:
+			v.errorf(off+8+4*n+4*i, "value label %s: value %d is labelled twice", name, value)
+		case value < prev:
+			v.warnf(off+8+4*n+4*i, "value label %s: values are not sorted, %d follows %d", name, value, prev)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package gostata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// validatorFile returns a dta file with a byte variable b labelled by yesno and a double d.
+// The data start at offset 440 with records of 9 bytes.
+func validatorFile(t *testing.T) []byte {
+	t.Helper()
+	ds := NewDataset()
+	b, _ := ds.AddNumeric("b", StataByteId, []float64{1, 0, 1})
+	b.ValueLabel = "yesno"
+	ds.AddNumeric("d", StataDoubleId, []float64{1.5, Missing, ExtendedMissing('z')})
+	vl := NewValueLabel("yesno")
+	vl.Set(0, "No")
+	vl.Set(1, "Yes")
+	if err := ds.DefineLabel(vl); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := ds.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func validateBytes(t *testing.T, b []byte) []Problem {
+	t.Helper()
+	problems, err := Validate(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return problems
+}
+
+// checkProblems checks that problems are exactly those described by want: an offset,
+// severity and part of the message each.
+func checkProblems(t *testing.T, problems []Problem, want ...Problem) {
+	t.Helper()
+	if len(problems) != len(want) {
+		t.Errorf("got %d problems, want %d: %v", len(problems), len(want), problems)
+		return
+	}
+	for i, p := range problems {
+		w := want[i]
+		if p.Offset != w.Offset || p.Severity != w.Severity || !strings.Contains(p.Message, w.Message) {
+			t.Errorf("problem %d: got %v, want offset %d %s containing %q", i, p, w.Offset, w.Severity, w.Message)
+		}
+	}
+}
+
+func TestValidateValid(t *testing.T) {
+	checkProblems(t, validateBytes(t, validatorFile(t)))
+	for _, name := range []string{"testdata/stata/nonint.dta", "testdata/stata/encodecp.dta", "testdata/golden/conformance-113.dta"} {
+		problems, err := ValidateFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(problems) > 0 {
+			t.Errorf("%s: %v", name, problems)
+		}
+	}
+}
+
+func TestValidateHeader(t *testing.T) {
+	b := validatorFile(t)
+	b[0] = 110
+	checkProblems(t, validateBytes(t, b), Problem{0, "", SeverityError, "unsupported format 110"})
+
+	b = validatorFile(t)
+	b[2] = 0
+	binary.LittleEndian.PutUint16(b[4:], 0xffff)
+	copy(b[10:], strings.Repeat("x", stataLabelSize))
+	checkProblems(t, validateBytes(t, b),
+		Problem{2, "", SeverityError, "invalid file type 0"},
+		Problem{4, "", SeverityError, "negative number of variables -1"},
+	)
+
+	b = validatorFile(t)
+	copy(b[10:], strings.Repeat("x", stataLabelSize))
+	copy(b[91:], "yesterday\x00")
+	checkProblems(t, validateBytes(t, b),
+		Problem{10, "", SeverityError, "dataset label is not terminated"},
+		Problem{91, "", SeverityWarning, `time stamp "yesterday"`},
+	)
+
+	checkProblems(t, validateBytes(t, []byte("<stata_dta><header>")),
+		Problem{0, "", SeverityError, "format 117 or later"})
+	checkProblems(t, validateBytes(t, b[:50]),
+		Problem{0, "", SeverityError, "file ends 50 bytes into the 109 bytes of the header"})
+}
+
+func TestValidateDescriptors(t *testing.T) {
+	b := validatorFile(t)
+	b[110] = 0 // type of d
+	copy(b[111:], strings.Repeat("a", stataVarSize))
+	checkProblems(t, validateBytes(t, b),
+		Problem{110, "", SeverityError, "variable 2: invalid type code 0"},
+		Problem{111, "", SeverityError, "name of variable 1 is not terminated"},
+		Problem{111, "", SeverityError, "variable 1: invalid name"},
+	)
+
+	b = validatorFile(t)
+	copy(b[144:], "b\x00")                    // name of d
+	binary.LittleEndian.PutUint16(b[177:], 3) // sort by a third variable
+	copy(b[195:], "%9s\x00")                  // format of d
+	checkProblems(t, validateBytes(t, b),
+		Problem{144, "", SeverityError, "variable 2: duplicate name b"},
+		Problem{177, "", SeverityError, "sort list refers to variable 3 of 2"},
+		Problem{195, "", SeverityWarning, `format "%9s" does not suit type double`},
+	)
+
+	checkProblems(t, validateBytes(t, validatorFile(t)[:300]),
+		Problem{109, "", SeverityError, "file ends 191 bytes into the 326 bytes of the descriptors of 2 variables"})
+}
+
+func TestValidateData(t *testing.T) {
+	b := validatorFile(t)
+	binary.LittleEndian.PutUint64(b[441:], math.Float64bits(math.NaN()))
+	binary.LittleEndian.PutUint64(b[459:], math.Float64bits(ExtendedMissing('a'))+1)
+	b[449] = 0x80 // byte -128
+	checkProblems(t, validateBytes(t, b),
+		Problem{449, "", SeverityWarning, "variable b: 1 non-canonical values, the first in observation 2: byte -128"},
+		Problem{441, "", SeverityWarning, "variable d: 2 non-canonical values, the first in observation 1: double 0x7ff8000000000001"},
+	)
+
+	// the header declares more observations than the file holds
+	checkProblems(t, validateBytes(t, validatorFile(t)[:460]),
+		Problem{458, "", SeverityError, "file ends in observation 3: the header declares 3 observations of 9 bytes, the file holds 2"})
+}
+
+func TestValidateInterruptedWrite(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "partial.dta")
+	sf := NewFile()
+	sf.AddFieldMeta("x", "", StataLongId)
+	sf.AddFieldMeta("s", "", 3)
+	if err := sf.BeginWrite(name); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		sf.AppendLong(Long(i))
+		sf.AppendStringN("abc", 3)
+		if err := sf.RecordEnd(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// stop before EndWrite rewrites the header
+	if err := sf.w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	sf.f.Close()
+	problems, err := ValidateFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkProblems(t, problems, Problem{fi.Size() - 28, "", SeverityError,
+		"28 bytes after the data are 4 observations of 7 bytes: the header declares 0 observations instead of 4"})
+}
+
+func TestValidateValueLabels(t *testing.T) {
+	b := validatorFile(t)
+	table := int64(bytes.LastIndex(b, []byte("yesno\x00"))) - 4
+	// entry count, text length, 2 offsets, 2 values, 7 bytes of text
+	values := table + labelTableHead + 16
+	binary.LittleEndian.PutUint32(b[values+4:], 0) // second value equals the first
+	b[len(b)-1] = 'x'                              // unterminated "Yes"
+	checkProblems(t, validateBytes(t, b),
+		Problem{int64(len(b)) - 4, "", SeverityError, "value label yesno: text of value 0 is not terminated"},
+		Problem{values + 4, "", SeverityError, "value label yesno: value 0 is labelled twice"},
+	)
+
+	b = validatorFile(t)
+	binary.LittleEndian.PutUint32(b[table+labelTableHead:], 5)
+	copy(b[table+4:], "nolabel\x00")
+	checkProblems(t, validateBytes(t, b),
+		Problem{table + labelTableHead, "", SeverityError, "value label nolabel: 5 entries and 7 bytes of text do not fill the table of 31 bytes"},
+		Problem{207, "", SeverityWarning, "variable b: value label yesno is not defined"},
+	)
+}
+
+func TestSeverityAndProblemString(t *testing.T) {
+	p := Problem{Offset: 12, Section: "data", Severity: SeverityWarning, Message: "odd"}
+	if got := p.String(); got != "offset 12: data: warning: odd" {
+		t.Errorf("got %q", got)
+	}
+	if HasErrors([]Problem{p}) || !HasErrors([]Problem{p, {Severity: SeverityError}}) {
+		t.Error("HasErrors")
+	}
+}